@@ -0,0 +1,163 @@
+package bounce
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"handyhub-email-svc/internal/models"
+	"handyhub-email-svc/internal/smtp"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+var ErrNotDSN = errors.New("message is not a delivery status notification")
+
+// Report is a parsed RFC 3464 delivery status notification.
+type Report struct {
+	// OriginalMessageID is the Message-ID of the email the report is about
+	OriginalMessageID string
+	Recipients        []RecipientStatus
+	ReceivedAt        time.Time
+}
+
+type RecipientStatus struct {
+	Recipient  string
+	Action     string
+	Status     string
+	Diagnostic string
+}
+
+// ParseDSN extracts the delivery status of a multipart/report message.
+func ParseDSN(r io.Reader) (*Report, error) {
+	msg, err := mail.ReadMessage(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read message: %w", err)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/report" || !strings.EqualFold(params["report-type"], "delivery-status") {
+		return nil, ErrNotDSN
+	}
+
+	report := &Report{ReceivedAt: time.Now().UTC()}
+	if date, err := msg.Header.Date(); err == nil {
+		report.ReceivedAt = date.UTC()
+	}
+
+	reader := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read report part: %w", err)
+		}
+
+		partType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		switch partType {
+		case "message/delivery-status", "message/global-delivery-status":
+			recipients, err := parseDeliveryStatus(part)
+			if err != nil {
+				return nil, err
+			}
+			report.Recipients = append(report.Recipients, recipients...)
+		case "message/rfc822", "text/rfc822-headers", "message/global", "message/global-headers":
+			if id := originalMessageID(part); id != "" {
+				report.OriginalMessageID = id
+			}
+		}
+	}
+
+	if len(report.Recipients) == 0 {
+		return nil, fmt.Errorf("%w: no per-recipient fields", ErrNotDSN)
+	}
+	return report, nil
+}
+
+// parseDeliveryStatus reads the per-message block followed by one block of
+// fields per recipient, blocks are separated by blank lines.
+func parseDeliveryStatus(r io.Reader) ([]RecipientStatus, error) {
+	tp := textproto.NewReader(bufio.NewReader(r))
+
+	if _, err := tp.ReadMIMEHeader(); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failed to read per-message fields: %w", err)
+	}
+
+	var recipients []RecipientStatus
+	for {
+		fields, err := tp.ReadMIMEHeader()
+		if len(fields) > 0 {
+			recipient := typedValue(fields.Get("Final-Recipient"))
+			if recipient == "" {
+				recipient = typedValue(fields.Get("Original-Recipient"))
+			}
+			recipients = append(recipients, RecipientStatus{
+				Recipient:  recipient,
+				Action:     strings.ToLower(strings.TrimSpace(fields.Get("Action"))),
+				Status:     strings.TrimSpace(strings.SplitN(fields.Get("Status"), " ", 2)[0]),
+				Diagnostic: typedValue(fields.Get("Diagnostic-Code")),
+			})
+		}
+		if err == io.EOF {
+			return recipients, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read per-recipient fields: %w", err)
+		}
+	}
+}
+
+// typedValue strips the address or diagnostic type, e.g. "rfc822; a@b.c".
+func typedValue(value string) string {
+	if semi := strings.IndexByte(value, ';'); semi >= 0 {
+		value = value[semi+1:]
+	}
+	return strings.TrimSpace(value)
+}
+
+func originalMessageID(r io.Reader) string {
+	headers, err := textproto.NewReader(bufio.NewReader(r)).ReadMIMEHeader()
+	if err != nil && len(headers) == 0 {
+		return ""
+	}
+	return smtp.FormatMessageID(headers.Get("Message-Id"))
+}
+
+// Events converts the report into delivery events. Permanent failures
+// (5.x.x) are bounces, transient ones and delays are deferrals.
+func (r *Report) Events() []models.DeliveryEvent {
+	events := make([]models.DeliveryEvent, 0, len(r.Recipients))
+	for _, recipient := range r.Recipients {
+		var eventType string
+		switch {
+		case recipient.Action == "failed" && strings.HasPrefix(recipient.Status, "5"):
+			eventType = models.EventBounced
+		case recipient.Action == "failed" || recipient.Action == "delayed":
+			eventType = models.EventDeferred
+		case recipient.Action == "delivered" || recipient.Action == "relayed" || recipient.Action == "expanded":
+			eventType = models.EventDelivered
+		default:
+			continue
+		}
+
+		reason := recipient.Status
+		if recipient.Diagnostic != "" {
+			reason = strings.TrimSpace(recipient.Status + " " + recipient.Diagnostic)
+		}
+		events = append(events, models.DeliveryEvent{
+			Type:      eventType,
+			Provider:  "dsn",
+			Recipient: recipient.Recipient,
+			MessageID: r.OriginalMessageID,
+			Reason:    reason,
+			Timestamp: r.ReceivedAt,
+		})
+	}
+	return events
+}
@@ -0,0 +1,155 @@
+package bounce
+
+import (
+	"errors"
+	"handyhub-email-svc/internal/models"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func openFixture(t *testing.T, name string) *os.File {
+	t.Helper()
+	file, err := os.Open(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { file.Close() })
+	return file
+}
+
+func TestParseDSN(t *testing.T) {
+	tests := []struct {
+		fixture    string
+		messageID  string
+		receivedAt time.Time
+		recipients []RecipientStatus
+		events     []string
+	}{
+		{
+			fixture:    "postfix-5xx.eml",
+			messageID:  "<1760433160.a1b2c3@example.com>",
+			receivedAt: time.Date(2025, 10, 14, 9, 12, 41, 0, time.UTC),
+			recipients: []RecipientStatus{{
+				Recipient:  "nobody@gmail.com",
+				Action:     "failed",
+				Status:     "5.1.1",
+				Diagnostic: "550-5.1.1 The email account that you tried to reach does not exist. 550 5.1.1 https://support.google.com/mail/?p=NoSuchUser",
+			}},
+			events: []string{models.EventBounced},
+		},
+		{
+			// Exim sends no Original-Recipient and a Message-Id without brackets
+			fixture:    "exim-4xx-delayed.eml",
+			messageID:  "<1760433001.d4e5f6@example.com>",
+			receivedAt: time.Date(2025, 10, 15, 9, 30, 2, 0, time.UTC),
+			recipients: []RecipientStatus{{
+				Recipient:  "ivan@mail.example.org",
+				Action:     "delayed",
+				Status:     "4.7.1",
+				Diagnostic: "451 4.7.1 Greylisted, please try again later",
+			}},
+			events: []string{models.EventDeferred},
+		},
+		{
+			fixture:    "multiple-recipients.eml",
+			messageID:  "<1760600708.f7a8b9@example.com>",
+			receivedAt: time.Date(2025, 10, 16, 7, 45, 10, 0, time.UTC),
+			recipients: []RecipientStatus{
+				{
+					Recipient:  "gone@outlook.example.com",
+					Action:     "failed",
+					Status:     "5.1.10",
+					Diagnostic: "550 5.1.10 RESOLVER.ADR.RecipientNotFound; Recipient not found by SMTP address lookup",
+				},
+				{Recipient: "full@outlook.example.com", Action: "failed", Status: "4.2.2", Diagnostic: "452 4.2.2 Mailbox full"},
+				{Recipient: "ok@outlook.example.com", Action: "relayed", Status: "2.0.0"},
+			},
+			// a 4.x.x failure is not permanent, it is not a bounce
+			events: []string{models.EventBounced, models.EventDeferred, models.EventDelivered},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			report, err := ParseDSN(openFixture(t, tt.fixture))
+			if err != nil {
+				t.Fatalf("ParseDSN: %v", err)
+			}
+			if report.OriginalMessageID != tt.messageID {
+				t.Errorf("OriginalMessageID = %q, want %q", report.OriginalMessageID, tt.messageID)
+			}
+			if !report.ReceivedAt.Equal(tt.receivedAt) {
+				t.Errorf("ReceivedAt = %v, want %v", report.ReceivedAt, tt.receivedAt)
+			}
+			if len(report.Recipients) != len(tt.recipients) {
+				t.Fatalf("Recipients = %+v, want %+v", report.Recipients, tt.recipients)
+			}
+			for i, want := range tt.recipients {
+				if got := report.Recipients[i]; got != want {
+					t.Errorf("Recipients[%d] = %+v, want %+v", i, got, want)
+				}
+			}
+
+			events := report.Events()
+			if len(events) != len(tt.events) {
+				t.Fatalf("Events = %+v, want types %v", events, tt.events)
+			}
+			for i, event := range events {
+				if event.Type != tt.events[i] {
+					t.Errorf("Events[%d].Type = %q, want %q", i, event.Type, tt.events[i])
+				}
+				if event.Provider != "dsn" || event.MessageID != tt.messageID || event.Recipient != tt.recipients[i].Recipient {
+					t.Errorf("Events[%d] = %+v", i, event)
+				}
+				if !strings.HasPrefix(event.Reason, tt.recipients[i].Status) {
+					t.Errorf("Events[%d].Reason = %q, want the status first", i, event.Reason)
+				}
+			}
+		})
+	}
+}
+
+func TestParseDSNOriginalRecipientFallback(t *testing.T) {
+	raw := "From: MAILER-DAEMON@mx.example.com\n" +
+		"Content-Type: multipart/report; report-type=delivery-status; boundary=b\n" +
+		"\n" +
+		"--b\n" +
+		"Content-Type: message/delivery-status\n" +
+		"\n" +
+		"Reporting-MTA: dns; mx.example.com\n" +
+		"\n" +
+		"Original-Recipient: rfc822; ann@example.org\n" +
+		"Action: failed\n" +
+		"Status: 5.2.1 (mailbox disabled)\n" +
+		"\n" +
+		"--b--\n"
+
+	report, err := ParseDSN(strings.NewReader(raw))
+	if err != nil {
+		t.Fatalf("ParseDSN: %v", err)
+	}
+	want := RecipientStatus{Recipient: "ann@example.org", Action: "failed", Status: "5.2.1"}
+	if len(report.Recipients) != 1 || report.Recipients[0] != want {
+		t.Fatalf("Recipients = %+v, want [%+v]", report.Recipients, want)
+	}
+	if report.OriginalMessageID != "" {
+		t.Errorf("OriginalMessageID = %q without the original headers", report.OriginalMessageID)
+	}
+}
+
+func TestParseDSNIgnoresOtherMail(t *testing.T) {
+	for _, fixture := range []string{"out-of-office.eml", "read-receipt.eml"} {
+		t.Run(fixture, func(t *testing.T) {
+			if _, err := ParseDSN(openFixture(t, fixture)); !errors.Is(err, ErrNotDSN) {
+				t.Fatalf("ParseDSN = %v, want ErrNotDSN", err)
+			}
+		})
+	}
+
+	empty := "Content-Type: multipart/report; report-type=delivery-status; boundary=b\n\n--b\nContent-Type: text/plain\n\nHi\n--b--\n"
+	if _, err := ParseDSN(strings.NewReader(empty)); !errors.Is(err, ErrNotDSN) {
+		t.Fatalf("report without a delivery-status part: %v, want ErrNotDSN", err)
+	}
+}
@@ -0,0 +1,168 @@
+package bounce
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// imapClient implements the handful of IMAP4rev1 (RFC 3501) commands needed
+// to fetch unseen bounce messages from a mailbox over implicit TLS.
+type imapClient struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	tag    int
+}
+
+type imapResponse struct {
+	lines    []string
+	literals [][]byte
+}
+
+func dialIMAP(host string, port int, timeout time.Duration) (*imapClient, error) {
+	dialer := &net.Dialer{Timeout: timeout}
+	conn, err := tls.DialWithDialer(dialer, "tcp", net.JoinHostPort(host, strconv.Itoa(port)), &tls.Config{ServerName: host})
+	if err != nil {
+		return nil, err
+	}
+
+	c := &imapClient{conn: conn, reader: bufio.NewReader(conn)}
+	greeting, err := c.readLine()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if !strings.HasPrefix(greeting, "* OK") {
+		conn.Close()
+		return nil, fmt.Errorf("unexpected IMAP greeting: %s", greeting)
+	}
+	return c, nil
+}
+
+func (c *imapClient) login(username, password string) error {
+	_, err := c.command("LOGIN %s %s", quote(username), quote(password))
+	return err
+}
+
+func (c *imapClient) selectMailbox(mailbox string) error {
+	_, err := c.command("SELECT %s", quote(mailbox))
+	return err
+}
+
+func (c *imapClient) searchUnseen() ([]string, error) {
+	resp, err := c.command("UID SEARCH UNSEEN")
+	if err != nil {
+		return nil, err
+	}
+
+	var uids []string
+	for _, line := range resp.lines {
+		if strings.HasPrefix(line, "* SEARCH") {
+			uids = append(uids, strings.Fields(strings.TrimPrefix(line, "* SEARCH"))...)
+		}
+	}
+	return uids, nil
+}
+
+func (c *imapClient) fetch(uid string) ([]byte, error) {
+	resp, err := c.command("UID FETCH %s BODY.PEEK[]", uid)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.literals) == 0 {
+		return nil, fmt.Errorf("message %s not found", uid)
+	}
+	return resp.literals[0], nil
+}
+
+func (c *imapClient) markSeen(uid string) error {
+	_, err := c.command(`UID STORE %s +FLAGS.SILENT (\Seen)`, uid)
+	return err
+}
+
+func (c *imapClient) logout() error {
+	defer c.conn.Close()
+	_, err := c.command("LOGOUT")
+	return err
+}
+
+// command sends a tagged command and collects untagged lines and literals
+// until the tagged completion response.
+func (c *imapClient) command(format string, args ...any) (*imapResponse, error) {
+	c.tag++
+	tag := fmt.Sprintf("a%d", c.tag)
+	if _, err := fmt.Fprintf(c.conn, "%s %s\r\n", tag, fmt.Sprintf(format, args...)); err != nil {
+		return nil, err
+	}
+
+	resp := &imapResponse{}
+	for {
+		line, err := c.readLine()
+		if err != nil {
+			return nil, err
+		}
+
+		for {
+			size, ok := literalSize(line)
+			if !ok {
+				break
+			}
+			literal := make([]byte, size)
+			if _, err := io.ReadFull(c.reader, literal); err != nil {
+				return nil, err
+			}
+			resp.literals = append(resp.literals, literal)
+			rest, err := c.readLine()
+			if err != nil {
+				return nil, err
+			}
+			line += rest
+		}
+
+		if strings.HasPrefix(line, tag+" ") {
+			status := strings.TrimPrefix(line, tag+" ")
+			if !strings.HasPrefix(status, "OK") {
+				return nil, fmt.Errorf("IMAP command failed: %s", status)
+			}
+			return resp, nil
+		}
+		resp.lines = append(resp.lines, line)
+	}
+}
+
+func (c *imapClient) readLine() (string, error) {
+	if err := c.conn.SetReadDeadline(time.Now().Add(time.Minute)); err != nil {
+		return "", err
+	}
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// literalSize parses the "{N}" suffix announcing an N byte literal.
+func literalSize(line string) (int, bool) {
+	if !strings.HasSuffix(line, "}") {
+		return 0, false
+	}
+	open := strings.LastIndexByte(line, '{')
+	if open < 0 {
+		return 0, false
+	}
+	size, err := strconv.Atoi(line[open+1 : len(line)-1])
+	if err != nil {
+		return 0, false
+	}
+	return size, true
+}
+
+func quote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+}
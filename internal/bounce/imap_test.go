@@ -0,0 +1,106 @@
+package bounce
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeIMAPServer answers each tagged command with the scripted untagged
+// lines and completes it with status, "OK" when empty.
+type fakeIMAPServer struct {
+	t        *testing.T
+	replies  map[string][]string
+	status   map[string]string
+	commands chan string
+}
+
+func newIMAPClient(t *testing.T, server *fakeIMAPServer) *imapClient {
+	t.Helper()
+	clientConn, serverConn := net.Pipe()
+	server.t = t
+	server.commands = make(chan string, 16)
+	go server.serve(serverConn)
+	t.Cleanup(func() { clientConn.Close() })
+	return &imapClient{conn: clientConn, reader: bufio.NewReader(clientConn)}
+}
+
+func (s *fakeIMAPServer) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		tag, command, _ := strings.Cut(strings.TrimRight(line, "\r\n"), " ")
+		s.commands <- command
+
+		var response strings.Builder
+		for _, reply := range s.replies[command] {
+			response.WriteString(reply)
+		}
+		status := s.status[command]
+		if status == "" {
+			status = "OK done"
+		}
+		fmt.Fprintf(&response, "%s %s\r\n", tag, status)
+		if _, err := conn.Write([]byte(response.String())); err != nil {
+			return
+		}
+	}
+}
+
+func TestIMAPSearchUnseen(t *testing.T) {
+	client := newIMAPClient(t, &fakeIMAPServer{replies: map[string][]string{
+		"UID SEARCH UNSEEN": {"* SEARCH 4 9 12\r\n"},
+	}})
+
+	uids, err := client.searchUnseen()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(uids, ",") != "4,9,12" {
+		t.Fatalf("uids = %v", uids)
+	}
+}
+
+func TestIMAPFetchLiteral(t *testing.T) {
+	raw, err := os.ReadFile(filepath.Join("testdata", "postfix-5xx.eml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := newIMAPClient(t, &fakeIMAPServer{replies: map[string][]string{
+		"UID FETCH 9 BODY.PEEK[]": {fmt.Sprintf("* 3 FETCH (UID 9 BODY[] {%d}\r\n%s)\r\n", len(raw), raw)},
+	}})
+
+	got, err := client.fetch("9")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(raw) {
+		t.Fatalf("fetched %d bytes, want the %d byte message", len(got), len(raw))
+	}
+}
+
+func TestIMAPCommandFailure(t *testing.T) {
+	server := &fakeIMAPServer{status: map[string]string{
+		`LOGIN "bounces" "se\"cret"`: "NO [AUTHENTICATIONFAILED] Invalid credentials",
+		"UID FETCH 7 BODY.PEEK[]":    "OK no such message",
+	}}
+	client := newIMAPClient(t, server)
+
+	if err := client.login("bounces", `se"cret`); err == nil || !strings.Contains(err.Error(), "AUTHENTICATIONFAILED") {
+		t.Fatalf("login = %v, want the NO response", err)
+	}
+	if command := <-server.commands; command != `LOGIN "bounces" "se\"cret"` {
+		t.Fatalf("sent %q", command)
+	}
+	if _, err := client.fetch("7"); err == nil {
+		t.Fatal("fetch without a literal succeeded")
+	}
+}
@@ -0,0 +1,205 @@
+package bounce
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"handyhub-email-svc/internal/config"
+	"handyhub-email-svc/internal/delivery"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+var log = logrus.StandardLogger()
+
+// errRecord marks storage failures, the bounce is kept and retried.
+var errRecord = errors.New("failed to record bounce")
+
+// Processor polls a drop directory (flat or Maildir) and optionally an IMAP
+// mailbox for delivery status notifications and records them as delivery
+// events.
+type Processor struct {
+	cfg      config.BouncesConfig
+	recorder *delivery.Recorder
+	stop     chan struct{}
+	wg       sync.WaitGroup
+}
+
+func NewProcessor(cfg config.BouncesConfig, recorder *delivery.Recorder) *Processor {
+	return &Processor{
+		cfg:      cfg,
+		recorder: recorder,
+		stop:     make(chan struct{}),
+	}
+}
+
+func (p *Processor) Start() {
+	interval := time.Duration(p.cfg.PollInterval) * time.Second
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		log.WithField("interval", interval).Info("Bounce processor started")
+		for {
+			p.poll()
+			select {
+			case <-p.stop:
+				log.Info("Bounce processor stopped")
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (p *Processor) Stop() {
+	close(p.stop)
+	p.wg.Wait()
+}
+
+func (p *Processor) poll() {
+	if p.cfg.DropDir != "" {
+		if err := p.scanDirectory(p.cfg.DropDir); err != nil {
+			log.WithError(err).Error("Failed to scan bounce directory")
+		}
+	}
+	if p.cfg.IMAP.Enabled {
+		if err := p.fetchIMAP(); err != nil {
+			log.WithError(err).Error("Failed to fetch bounces over IMAP")
+		}
+	}
+}
+
+// handle records the bounce in raw. Messages that are not DSNs are reported
+// as processed so they don't get fetched again.
+func (p *Processor) handle(raw []byte, source string) error {
+	report, err := ParseDSN(bytes.NewReader(raw))
+	if errors.Is(err, ErrNotDSN) {
+		log.WithField("source", source).Debug("Skipping message that is not a DSN")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	applied, err := p.recorder.Record(report.Events())
+	if err != nil {
+		return fmt.Errorf("%w: %v", errRecord, err)
+	}
+
+	log.WithFields(logrus.Fields{
+		"source":     source,
+		"message_id": report.OriginalMessageID,
+		"recipients": len(report.Recipients),
+		"applied":    applied,
+	}).Info("Bounce processed")
+	return nil
+}
+
+// scanDirectory processes dir/new of a Maildir, moving handled files to
+// dir/cur, or the files of a flat drop directory, moving them to
+// dir/processed. Files that fail to parse go to dir/failed, files hit by
+// storage errors stay in place for the next poll.
+func (p *Processor) scanDirectory(dir string) error {
+	incoming, processed := dir, filepath.Join(dir, "processed")
+	maildir := false
+	if info, err := os.Stat(filepath.Join(dir, "new")); err == nil && info.IsDir() {
+		incoming, processed, maildir = filepath.Join(dir, "new"), filepath.Join(dir, "cur"), true
+	}
+	failed := filepath.Join(dir, "failed")
+
+	entries, err := os.ReadDir(incoming)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		path := filepath.Join(incoming, entry.Name())
+
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			log.WithError(err).WithField("file", path).Error("Failed to read bounce file")
+			continue
+		}
+
+		target := filepath.Join(processed, entry.Name())
+		if maildir {
+			target += ":2,S"
+		}
+		if err := p.handle(raw, path); err != nil {
+			if errors.Is(err, errRecord) {
+				log.WithError(err).WithField("file", path).Error("Failed to record bounce, will retry")
+				continue
+			}
+			log.WithError(err).WithField("file", path).Warn("Failed to parse bounce")
+			target = filepath.Join(failed, entry.Name())
+		}
+
+		if err := moveFile(path, target); err != nil {
+			log.WithError(err).WithField("file", path).Error("Failed to move bounce file")
+		}
+	}
+	return nil
+}
+
+func (p *Processor) fetchIMAP() error {
+	cfg := p.cfg.IMAP
+	client, err := dialIMAP(cfg.Host, cfg.Port, 30*time.Second)
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s: %w", cfg.Host, err)
+	}
+	defer client.logout()
+
+	if err := client.login(cfg.Username, cfg.Password); err != nil {
+		return err
+	}
+	if err := client.selectMailbox(cfg.Mailbox); err != nil {
+		return err
+	}
+
+	uids, err := client.searchUnseen()
+	if err != nil {
+		return err
+	}
+
+	for _, uid := range uids {
+		raw, err := client.fetch(uid)
+		if err != nil {
+			return err
+		}
+
+		if err := p.handle(raw, "imap:"+uid); err != nil {
+			if errors.Is(err, errRecord) {
+				log.WithError(err).WithField("uid", uid).Error("Failed to record bounce, will retry")
+				continue
+			}
+			log.WithError(err).WithField("uid", uid).Warn("Failed to parse bounce")
+		}
+
+		if err := client.markSeen(uid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func moveFile(from, to string) error {
+	if err := os.MkdirAll(filepath.Dir(to), os.ModePerm); err != nil {
+		return err
+	}
+	return os.Rename(from, to)
+}
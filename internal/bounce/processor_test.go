@@ -0,0 +1,81 @@
+package bounce
+
+import (
+	"handyhub-email-svc/internal/config"
+	"handyhub-email-svc/internal/delivery"
+	"handyhub-email-svc/internal/storage"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func copyFixture(t *testing.T, fixture, dir string) {
+	t.Helper()
+	raw, err := os.ReadFile(filepath.Join("testdata", fixture))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, fixture), raw, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHandleIgnoresOtherMail(t *testing.T) {
+	// the recorder is nil, handle must return before recording anything
+	p := NewProcessor(config.BouncesConfig{}, nil)
+	for _, fixture := range []string{"out-of-office.eml", "read-receipt.eml"} {
+		raw, err := os.ReadFile(filepath.Join("testdata", fixture))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := p.handle(raw, "imap:1"); err != nil {
+			t.Errorf("handle(%s) = %v, want nil so it is marked seen", fixture, err)
+		}
+	}
+}
+
+func TestScanDirectory(t *testing.T) {
+	dir := t.TempDir()
+	for _, fixture := range []string{"postfix-5xx.eml", "out-of-office.eml", "read-receipt.eml"} {
+		copyFixture(t, fixture, dir)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "broken.eml"), []byte("no headers"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	p := NewProcessor(config.BouncesConfig{}, delivery.NewRecorder(storage.NewConsoleStorage(), nil))
+	if err := p.scanDirectory(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"postfix-5xx.eml":   "processed",
+		"out-of-office.eml": "processed",
+		"read-receipt.eml":  "processed",
+		"broken.eml":        "failed",
+	}
+	for name, subdir := range want {
+		if _, err := os.Stat(filepath.Join(dir, subdir, name)); err != nil {
+			t.Errorf("%s not moved to %s/: %v", name, subdir, err)
+		}
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			t.Errorf("%s left in the drop directory", name)
+		}
+	}
+}
+
+func TestScanMaildir(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "new"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	copyFixture(t, "read-receipt.eml", filepath.Join(dir, "new"))
+
+	p := NewProcessor(config.BouncesConfig{}, nil)
+	if err := p.scanDirectory(dir); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "cur", "read-receipt.eml:2,S")); err != nil {
+		t.Fatalf("message not moved to cur/ as seen: %v", err)
+	}
+}
@@ -9,13 +9,22 @@ import (
 )
 
 type Configuration struct {
-	Database Database       `mapstructure:"database"`
-	Storage  StorageConfig  `mapstructure:"storage"`
-	Server   ServerSettings `mapstructure:"server"`
-	App      Application    `mapstructure:"app"`
-	Logs     LogsSettings   `mapstructure:"logs"`
-	Queue    QueueConfig    `mapstructure:"queue"`
-	SMTP     SMTPConfig     `mapstructure:"smtp"`
+	Database    Database          `mapstructure:"database"`
+	Storage     StorageConfig     `mapstructure:"storage"`
+	Server      ServerSettings    `mapstructure:"server"`
+	App         Application       `mapstructure:"app"`
+	Logs        LogsSettings      `mapstructure:"logs"`
+	Queue       QueueConfig       `mapstructure:"queue"`
+	SMTP        SMTPConfig        `mapstructure:"smtp"`
+	Validation  ValidationConfig  `mapstructure:"validation"`
+	Content     ContentConfig     `mapstructure:"content"`
+	Webhooks    WebhooksConfig    `mapstructure:"webhooks"`
+	Bounces     BouncesConfig     `mapstructure:"bounces"`
+	Suppression SuppressionConfig `mapstructure:"suppression"`
+	Tracking    TrackingConfig    `mapstructure:"tracking"`
+	Preferences PreferencesConfig `mapstructure:"preferences"`
+	Templates   TemplatesConfig   `mapstructure:"templates"`
+	Idempotency IdempotencyConfig `mapstructure:"idempotency"`
 }
 
 type Database struct {
@@ -58,32 +67,79 @@ type QueueConfig struct {
 }
 
 type RabbitMQConfig struct {
-	Url            string `mapstructure:"url"`
-	Exchange       string `mapstructure:"exchange"`
-	ExchangeType   string `mapstructure:"exchange-type"`
-	EmailQueue     string `mapstructure:"email-queue"`
-	PrefetchCount  int    `mapstructure:"prefetch-count"`
-	ReconnectDelay int    `mapstructure:"reconnect-delay"`
-	Timeout        int    `mapstructure:"timeout"`
-	RoutingKey     string `mapstructure:"routing-key"`
-	PrefetchSize   int    `mapstructure:"prefetch-size"`
-	Global         bool   `mapstructure:"global"`
-	Durable        bool   `mapstructure:"durable"`
-	AutoDelete     bool   `mapstructure:"auto-delete"`
-	Internal       bool   `mapstructure:"internal"`
-	NoWait         bool   `mapstructure:"no-wait"`
-	Exclusive      bool   `mapstructure:"exclusive"`
-	AutoAck        bool   `mapstructure:"auto-ack"`
-	NoLocal        bool   `mapstructure:"no-local"`
-	Consumer       string `mapstructure:"consumer"`
+	Url               string           `mapstructure:"url"`
+	Exchange          string           `mapstructure:"exchange"`
+	ExchangeType      string           `mapstructure:"exchange-type"`
+	EmailQueue        string           `mapstructure:"email-queue"`
+	PrefetchCount     int              `mapstructure:"prefetch-count"`
+	MaxPriority       int              `mapstructure:"max-priority"`
+	ReconnectDelay    int              `mapstructure:"reconnect-delay"`
+	MaxReconnectDelay int              `mapstructure:"max-reconnect-delay"`
+	Timeout           int              `mapstructure:"timeout"`
+	RoutingKey        string           `mapstructure:"routing-key"`
+	PrefetchSize      int              `mapstructure:"prefetch-size"`
+	Global            bool             `mapstructure:"global"`
+	Durable           bool             `mapstructure:"durable"`
+	AutoDelete        bool             `mapstructure:"auto-delete"`
+	Internal          bool             `mapstructure:"internal"`
+	NoWait            bool             `mapstructure:"no-wait"`
+	Exclusive         bool             `mapstructure:"exclusive"`
+	AutoAck           bool             `mapstructure:"auto-ack"`
+	NoLocal           bool             `mapstructure:"no-local"`
+	Consumer          string           `mapstructure:"consumer"`
+	Workers           int              `mapstructure:"workers"`
+	DrainTimeout      int              `mapstructure:"drain-timeout"`
+	Retry             RetryConfig      `mapstructure:"retry"`
+	DeadLetter        DeadLetterConfig `mapstructure:"dead-letter"`
+	Events            EventsConfig     `mapstructure:"events"`
+}
+
+// EventsConfig publishes email.sent, email.failed and email.suppressed
+// events to Exchange, the email exchange when empty.
+type EventsConfig struct {
+	Enabled  bool   `mapstructure:"enabled"`
+	Exchange string `mapstructure:"exchange"`
+}
+
+// DeadLetterConfig collects messages that cannot be processed in Queue,
+// routed there through Exchange.
+type DeadLetterConfig struct {
+	Enabled  bool   `mapstructure:"enabled"`
+	Exchange string `mapstructure:"exchange"`
+	Queue    string `mapstructure:"queue"`
+}
+
+// RetryConfig delays retries of failed messages in TTL queues, the delay
+// doubles from InitialDelay up to MaxDelay seconds.
+type RetryConfig struct {
+	Enabled      bool `mapstructure:"enabled"`
+	MaxAttempts  int  `mapstructure:"max-attempts"`
+	InitialDelay int  `mapstructure:"initial-delay"`
+	MaxDelay     int  `mapstructure:"max-delay"`
 }
 
 type SMTPConfig struct {
-	Provider    string         `mapstructure:"provider"`
-	DefaultFrom string         `mapstructure:"default-from"`
-	Gmail       GmailConfig    `mapstructure:"gmail"`
-	SendGrid    SendGridConfig `mapstructure:"sendgrid"`
-	MailHog     MailHogConfig  `mapstructure:"mailhog"`
+	// Provider is the name of the instance used when a message doesn't select one
+	Provider    string                    `mapstructure:"provider"`
+	DefaultFrom string                    `mapstructure:"default-from"`
+	Providers   map[string]ProviderConfig `mapstructure:"providers"`
+	SMIME       SMIMEConfig               `mapstructure:"smime"`
+	// MessageIDDomain is the right-hand side of generated Message-IDs,
+	// defaults to the domain of DefaultFrom
+	MessageIDDomain string `mapstructure:"message-id-domain"`
+}
+
+// ProviderConfig is a named provider instance, only the fields relevant to
+// its type are used.
+type ProviderConfig struct {
+	Type     string `mapstructure:"type"`
+	From     string `mapstructure:"from"`
+	Host     string `mapstructure:"host"`
+	Port     int    `mapstructure:"port"`
+	Username string `mapstructure:"username"`
+	Password string `mapstructure:"password"`
+	ApiKey   string `mapstructure:"api-key"`
+	Url      string `mapstructure:"url"`
 }
 
 type GmailConfig struct {
@@ -103,6 +159,129 @@ type MailHogConfig struct {
 	Port int    `mapstructure:"port"`
 }
 
+type SMIMEConfig struct {
+	Enabled         bool            `mapstructure:"enabled"`
+	CertificatesDir string          `mapstructure:"certificates-dir"`
+	Identities      []SMIMEIdentity `mapstructure:"identities"`
+}
+
+type SMIMEIdentity struct {
+	From string `mapstructure:"from"`
+	Cert string `mapstructure:"cert"`
+	Key  string `mapstructure:"key"`
+}
+
+type ValidationConfig struct {
+	Enabled        bool     `mapstructure:"enabled"`
+	BlockedDomains []string `mapstructure:"blocked-domains"`
+	CheckMX        bool     `mapstructure:"check-mx"`
+	MXTimeout      int      `mapstructure:"mx-timeout"`
+}
+
+type ContentConfig struct {
+	InlineCSS bool `mapstructure:"inline-css"`
+	// MarkdownLayout is the template layout wrapping body_markdown emails
+	MarkdownLayout string `mapstructure:"markdown-layout"`
+}
+
+type WebhooksConfig struct {
+	SendGrid SendGridWebhookConfig `mapstructure:"sendgrid"`
+	Mailgun  MailgunWebhookConfig  `mapstructure:"mailgun"`
+	Postmark PostmarkWebhookConfig `mapstructure:"postmark"`
+}
+
+type SendGridWebhookConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// PublicKey is the base64 verification key from the SendGrid settings
+	PublicKey string `mapstructure:"public-key"`
+	MaxAge    int    `mapstructure:"max-age"`
+}
+
+type MailgunWebhookConfig struct {
+	Enabled    bool   `mapstructure:"enabled"`
+	SigningKey string `mapstructure:"signing-key"`
+	MaxAge     int    `mapstructure:"max-age"`
+}
+
+type PostmarkWebhookConfig struct {
+	Enabled  bool   `mapstructure:"enabled"`
+	Username string `mapstructure:"username"`
+	Password string `mapstructure:"password"`
+}
+
+type BouncesConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// DropDir is a Maildir (with new/ and cur/) or a flat directory of .eml files
+	DropDir      string     `mapstructure:"drop-dir"`
+	PollInterval int        `mapstructure:"poll-interval"`
+	IMAP         IMAPConfig `mapstructure:"imap"`
+}
+
+type IMAPConfig struct {
+	Enabled  bool   `mapstructure:"enabled"`
+	Host     string `mapstructure:"host"`
+	Port     int    `mapstructure:"port"`
+	Username string `mapstructure:"username"`
+	Password string `mapstructure:"password"`
+	Mailbox  string `mapstructure:"mailbox"`
+}
+
+type SuppressionConfig struct {
+	Enabled    bool   `mapstructure:"enabled"`
+	Collection string `mapstructure:"collection"`
+	// ExpiryDays maps a suppression reason to its lifetime, 0 or absent never expires
+	ExpiryDays map[string]int `mapstructure:"expiry-days"`
+}
+
+type TrackingConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// BaseURL is the public URL of this service the pixel and redirects point to
+	BaseURL string `mapstructure:"base-url"`
+	Secret  string `mapstructure:"secret"`
+	Opens   bool   `mapstructure:"opens"`
+	Clicks  bool   `mapstructure:"clicks"`
+}
+
+type PreferencesConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// BaseURL is the public URL of this service the unsubscribe links point to
+	BaseURL    string           `mapstructure:"base-url"`
+	Secret     string           `mapstructure:"secret"`
+	Collection string           `mapstructure:"collection"`
+	Categories []CategoryConfig `mapstructure:"categories"`
+}
+
+type CategoryConfig struct {
+	Name        string `mapstructure:"name"`
+	Description string `mapstructure:"description"`
+	// Required categories, e.g. account notifications, cannot be unsubscribed
+	Required bool `mapstructure:"required"`
+}
+
+type TemplatesConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Source is "directory" or "database"
+	Source     string `mapstructure:"source"`
+	Dir        string `mapstructure:"dir"`
+	Collection string `mapstructure:"collection"`
+	// PartialsCollection holds the layouts and partials of stored templates
+	PartialsCollection string `mapstructure:"partials-collection"`
+	// CacheTTL is how long parsed templates are reused, in seconds
+	CacheTTL int `mapstructure:"cache-ttl"`
+	// DefaultLocale is used when no variant matches the recipient locale
+	DefaultLocale string `mapstructure:"default-locale"`
+}
+
+type IdempotencyConfig struct {
+	Enabled    bool   `mapstructure:"enabled"`
+	Collection string `mapstructure:"collection"`
+	// Lease is how long a delivery holds its key, in seconds. A redelivery
+	// after a crash waits for it to run out before sending again.
+	Lease int `mapstructure:"lease"`
+	// Retention is how long processed keys are remembered, in hours
+	Retention int `mapstructure:"retention"`
+}
+
 func Load() *Configuration {
 
 	cfg := read()
@@ -124,15 +303,18 @@ func Load() *Configuration {
 	}
 
 	smtpHost := os.Getenv("SMTP_HOST")
-	if smtpHost != "" {
-		cfg.SMTP.MailHog.Host = smtpHost
-	}
-
-	smtpPort := os.Getenv("SMTP_PORT")
-	if smtpPort != "" {
-		if port, err := strconv.Atoi(smtpPort); err == nil {
-			cfg.SMTP.MailHog.Port = port
+	smtpPort, _ := strconv.Atoi(os.Getenv("SMTP_PORT"))
+	for name, provider := range cfg.SMTP.Providers {
+		if provider.Type != "mailhog" {
+			continue
+		}
+		if smtpHost != "" {
+			provider.Host = smtpHost
+		}
+		if smtpPort != 0 {
+			provider.Port = smtpPort
 		}
+		cfg.SMTP.Providers[name] = provider
 	}
 
 	return cfg
@@ -148,13 +330,13 @@ func read() *Configuration {
 	err := viper.ReadInConfig()
 
 	if err != nil {
-		logrus.Panic("Error reading config file, %s", err)
+		logrus.Panicf("Error reading config file, %s", err)
 	}
 
 	err = viper.Unmarshal(&config)
 
 	if err != nil {
-		logrus.Panic("Error unmarshalling config file, %s", err)
+		logrus.Panicf("Error unmarshalling config file, %s", err)
 	}
 
 	return &config
@@ -0,0 +1,373 @@
+package content
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// InlineCSS moves rules from <style> blocks into style attributes, because
+// Gmail and Outlook partially ignore embedded stylesheets. Rules that cannot
+// be inlined (media queries, pseudo-classes, other at-rules) are kept in a
+// <style> block in the head. Blocks marked data-inline="false" are untouched.
+func InlineCSS(body string) (string, error) {
+	doc, err := html.Parse(strings.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("failed to parse HTML: %w", err)
+	}
+
+	var rules []cssRule
+	var preserved []string
+	for _, style := range findStyleElements(doc) {
+		parsed, kept := parseStylesheet(nodeText(style))
+		rules = append(rules, parsed...)
+		preserved = append(preserved, kept...)
+		style.Parent.RemoveChild(style)
+	}
+
+	if len(rules) > 0 {
+		applyRules(doc, rules)
+	}
+	if len(preserved) > 0 {
+		appendHeadStyle(doc, strings.Join(preserved, "\n"))
+	}
+
+	var b strings.Builder
+	if err := html.Render(&b, doc); err != nil {
+		return "", fmt.Errorf("failed to render HTML: %w", err)
+	}
+	return b.String(), nil
+}
+
+type cssDeclaration struct {
+	property  string
+	value     string
+	important bool
+}
+
+type cssRule struct {
+	selector     *cssSelector
+	declarations []cssDeclaration
+	order        int
+}
+
+// parseStylesheet returns the inlinable rules and the raw text of everything
+// that has to stay in a stylesheet.
+func parseStylesheet(css string) ([]cssRule, []string) {
+	css = stripComments(css)
+
+	var rules []cssRule
+	var preserved []string
+	for i := 0; i < len(css); {
+		for i < len(css) && isSpace(css[i]) {
+			i++
+		}
+		if i >= len(css) {
+			break
+		}
+
+		if css[i] == '@' {
+			end := atRuleEnd(css, i)
+			rule := strings.TrimSpace(css[i:end])
+			if !strings.HasPrefix(strings.ToLower(rule), "@charset") {
+				preserved = append(preserved, rule)
+			}
+			i = end
+			continue
+		}
+
+		open := strings.IndexByte(css[i:], '{')
+		if open < 0 {
+			break
+		}
+		open += i
+		close := blockEnd(css, open)
+		selectors := css[i:open]
+		block := css[open+1 : close-1]
+		i = close
+
+		declarations := parseDeclarations(block)
+		if len(declarations) == 0 {
+			continue
+		}
+
+		var kept []string
+		for _, raw := range splitTopLevel(selectors, ',') {
+			raw = strings.TrimSpace(raw)
+			if raw == "" {
+				continue
+			}
+			selector, ok := parseSelector(raw)
+			if !ok {
+				kept = append(kept, raw)
+				continue
+			}
+			rules = append(rules, cssRule{selector: selector, declarations: declarations})
+		}
+		if len(kept) > 0 {
+			preserved = append(preserved, strings.Join(kept, ", ")+" {"+strings.TrimSpace(block)+"}")
+		}
+	}
+
+	return rules, preserved
+}
+
+func parseDeclarations(block string) []cssDeclaration {
+	var declarations []cssDeclaration
+	for _, raw := range splitTopLevel(block, ';') {
+		colon := strings.IndexByte(raw, ':')
+		if colon < 0 {
+			continue
+		}
+		property := strings.ToLower(strings.TrimSpace(raw[:colon]))
+		value := strings.TrimSpace(raw[colon+1:])
+		if property == "" || value == "" {
+			continue
+		}
+
+		important := false
+		if idx := strings.LastIndex(strings.ToLower(value), "!important"); idx >= 0 {
+			important = true
+			value = strings.TrimSpace(value[:idx])
+		}
+		declarations = append(declarations, cssDeclaration{property: property, value: value, important: important})
+	}
+	return declarations
+}
+
+type matchedDeclaration struct {
+	cssDeclaration
+	specificity [3]int
+	order       int
+}
+
+func applyRules(doc *html.Node, rules []cssRule) {
+	for i := range rules {
+		rules[i].order = i
+	}
+
+	walkElements(doc, func(n *html.Node) {
+		var matched []matchedDeclaration
+		for _, rule := range rules {
+			if !rule.selector.matches(n) {
+				continue
+			}
+			for _, d := range rule.declarations {
+				matched = append(matched, matchedDeclaration{cssDeclaration: d, specificity: rule.selector.specificity, order: rule.order})
+			}
+		}
+		if len(matched) == 0 {
+			return
+		}
+
+		// inline declarations beat any selector unless the rule is !important
+		inline := parseDeclarations(attr(n, "style"))
+		for _, d := range inline {
+			matched = append(matched, matchedDeclaration{cssDeclaration: d, specificity: [3]int{1 << 16}, order: len(rules)})
+		}
+
+		sort.SliceStable(matched, func(i, j int) bool {
+			a, b := matched[i], matched[j]
+			if a.important != b.important {
+				return !a.important
+			}
+			if a.specificity != b.specificity {
+				return lessSpecific(a.specificity, b.specificity)
+			}
+			return a.order < b.order
+		})
+
+		var properties []string
+		values := make(map[string]string)
+		for _, d := range matched {
+			if _, ok := values[d.property]; !ok {
+				properties = append(properties, d.property)
+			}
+			values[d.property] = d.value
+		}
+
+		parts := make([]string, 0, len(properties))
+		for _, p := range properties {
+			parts = append(parts, p+": "+values[p])
+		}
+		setAttr(n, "style", strings.Join(parts, "; ")+";")
+	})
+}
+
+func lessSpecific(a, b [3]int) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+	return false
+}
+
+func findStyleElements(doc *html.Node) []*html.Node {
+	var styles []*html.Node
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.DataAtom == atom.Style && isInlinable(n) {
+			styles = append(styles, n)
+			return
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+	return styles
+}
+
+func isInlinable(style *html.Node) bool {
+	if strings.EqualFold(attr(style, "data-inline"), "false") {
+		return false
+	}
+	media := strings.ToLower(strings.TrimSpace(attr(style, "media")))
+	return media == "" || media == "all" || media == "screen"
+}
+
+func walkElements(n *html.Node, fn func(*html.Node)) {
+	if n.Type == html.ElementNode {
+		switch n.DataAtom {
+		case atom.Head, atom.Script, atom.Style, atom.Template:
+			return
+		}
+		fn(n)
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		walkElements(c, fn)
+	}
+}
+
+func appendHeadStyle(doc *html.Node, css string) {
+	head := findElement(doc, atom.Head)
+	if head == nil {
+		return
+	}
+	style := &html.Node{Type: html.ElementNode, Data: "style", DataAtom: atom.Style}
+	style.AppendChild(&html.Node{Type: html.TextNode, Data: css})
+	head.AppendChild(style)
+}
+
+func findElement(n *html.Node, a atom.Atom) *html.Node {
+	if n.Type == html.ElementNode && n.DataAtom == a {
+		return n
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if found := findElement(c, a); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+func nodeText(n *html.Node) string {
+	var b strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.TextNode {
+			b.WriteString(c.Data)
+		}
+	}
+	return b.String()
+}
+
+func setAttr(n *html.Node, key, value string) {
+	for i := range n.Attr {
+		if n.Attr[i].Key == key {
+			n.Attr[i].Val = value
+			return
+		}
+	}
+	n.Attr = append(n.Attr, html.Attribute{Key: key, Val: value})
+}
+
+func stripComments(css string) string {
+	var b strings.Builder
+	for {
+		start := strings.Index(css, "/*")
+		if start < 0 {
+			b.WriteString(css)
+			return b.String()
+		}
+		b.WriteString(css[:start])
+		end := strings.Index(css[start+2:], "*/")
+		if end < 0 {
+			return b.String()
+		}
+		css = css[start+2+end+2:]
+	}
+}
+
+// atRuleEnd returns the index just past an at-rule starting at i, either its
+// terminating semicolon or its closing brace.
+func atRuleEnd(css string, i int) int {
+	for j := i; j < len(css); j++ {
+		switch css[j] {
+		case ';':
+			return j + 1
+		case '{':
+			return blockEnd(css, j)
+		}
+	}
+	return len(css)
+}
+
+// blockEnd returns the index just past the brace matching the one at open.
+func blockEnd(css string, open int) int {
+	depth := 0
+	var quote byte
+	for j := open; j < len(css); j++ {
+		c := css[j]
+		switch {
+		case quote != 0:
+			if c == quote && css[j-1] != '\\' {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '{':
+			depth++
+		case c == '}':
+			depth--
+			if depth == 0 {
+				return j + 1
+			}
+		}
+	}
+	return len(css)
+}
+
+// splitTopLevel splits s on sep outside of quotes, parentheses and brackets.
+func splitTopLevel(s string, sep byte) []string {
+	var parts []string
+	depth := 0
+	var quote byte
+	start := 0
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == quote && s[i-1] != '\\' {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '(' || c == '[':
+			depth++
+		case c == ')' || c == ']':
+			depth--
+		case c == sep && depth == 0:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
@@ -0,0 +1,194 @@
+package content
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestInlineCSS(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		// want are substrings of the output, absent are not in it
+		want   []string
+		absent []string
+	}{
+		{
+			name: "type selector",
+			body: `<style>p { color: red; }</style><p>Hi</p>`,
+			want: []string{`<p style="color: red;">Hi</p>`},
+		},
+		{
+			name: "id beats class beats type",
+			body: `<style>#a { color: red; } .b { color: green; } p { color: blue; }</style><p id="a" class="b">Hi</p>`,
+			want: []string{`style="color: red;"`},
+		},
+		{
+			name: "class beats type regardless of order",
+			body: `<style>.b { color: green; } p { color: blue; }</style><p class="b">Hi</p>`,
+			want: []string{`style="color: green;"`},
+		},
+		{
+			name: "later rule wins at equal specificity",
+			body: `<style>.a { color: red; } .b { color: green; }</style><p class="a b">Hi</p>`,
+			want: []string{`style="color: green;"`},
+		},
+		{
+			name: "descendant and child combinators",
+			body: `<style>div p { color: red; } div > span { color: green; }</style><div><p>A</p><b><span>B</span></b><span>C</span></div>`,
+			want: []string{`<p style="color: red;">A</p>`, `<b><span>B</span></b>`, `<span style="color: green;">C</span>`},
+		},
+		{
+			name: "attribute selector",
+			body: `<style>a[href^="https"] { color: red; }</style><a href="https://x.test">A</a><a href="mailto:a@x.test">B</a>`,
+			want: []string{`<a href="https://x.test" style="color: red;">A</a>`, `<a href="mailto:a@x.test">B</a>`},
+		},
+		{
+			name: "inline style beats selectors",
+			body: `<style>#a { color: red; }</style><p id="a" style="color: blue">Hi</p>`,
+			want: []string{`style="color: blue;"`},
+		},
+		{
+			name: "important beats inline style",
+			body: `<style>p { color: red !important; }</style><p style="color: blue">Hi</p>`,
+			want: []string{`style="color: red;"`},
+		},
+		{
+			name: "important beats higher specificity",
+			body: `<style>p { color: red !important; } #a { color: blue; }</style><p id="a">Hi</p>`,
+			want: []string{`style="color: red;"`},
+		},
+		{
+			name: "pseudo-class stays in the head",
+			body: `<html><head><style>a:hover { color: red; } a { color: blue; }</style></head><body><a href="#">A</a></body></html>`,
+			want: []string{`<head><style>a:hover {color: red;}</style></head>`, `<a href="#" style="color: blue;">A</a>`},
+		},
+		{
+			name: "sibling combinators stay in the head",
+			body: `<style>h1 + p { color: red; } h1 ~ p { color: blue; }</style><h1>T</h1><p>A</p>`,
+			want: []string{`h1 + p {color: red;}`, `h1 ~ p {color: blue;}`, `<p>A</p>`},
+		},
+		{
+			name: "media queries stay in the head",
+			body: `<style>@media (max-width: 600px) { p { color: red; } } p { margin: 0; }</style><p>A</p>`,
+			want: []string{`@media (max-width: 600px) { p { color: red; } }`, `<p style="margin: 0;">A</p>`},
+		},
+		{
+			name: "selector list is split",
+			body: `<style>p, a:hover { color: red; }</style><p>A</p>`,
+			want: []string{`<p style="color: red;">A</p>`, `a:hover {color: red;}`},
+		},
+		{
+			name:   "comments are ignored",
+			body:   `<style>/* p { color: blue; } */ p { color: red; }</style><p>A</p>`,
+			want:   []string{`<p style="color: red;">A</p>`},
+			absent: []string{"blue"},
+		},
+		{
+			name: "data-inline false is untouched",
+			body: `<html><head><style data-inline="false">p { color: red; }</style></head><body><p>A</p></body></html>`,
+			want: []string{`<style data-inline="false">p { color: red; }</style>`, `<p>A</p>`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := InlineCSS(tt.body)
+			if err != nil {
+				t.Fatalf("InlineCSS: %v", err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("output does not contain %q:\n%s", want, got)
+				}
+			}
+			for _, absent := range tt.absent {
+				if strings.Contains(got, absent) {
+					t.Errorf("output contains %q:\n%s", absent, got)
+				}
+			}
+		})
+	}
+}
+
+func TestParseSelector(t *testing.T) {
+	tests := []struct {
+		raw         string
+		ok          bool
+		specificity [3]int
+	}{
+		{raw: "p", ok: true, specificity: [3]int{0, 0, 1}},
+		{raw: "*", ok: true, specificity: [3]int{0, 0, 0}},
+		{raw: ".a.b", ok: true, specificity: [3]int{0, 2, 0}},
+		{raw: "#x", ok: true, specificity: [3]int{1, 0, 0}},
+		{raw: "div#x.a p", ok: true, specificity: [3]int{1, 1, 2}},
+		{raw: "td[align=center]", ok: true, specificity: [3]int{0, 1, 1}},
+		{raw: "ul > li", ok: true, specificity: [3]int{0, 0, 2}},
+		{raw: "[class~=a]", ok: true, specificity: [3]int{0, 1, 0}},
+		{raw: `a[href="https://x.test"]`, ok: true, specificity: [3]int{0, 1, 1}},
+		{raw: "a:hover"},
+		{raw: "p::first-line"},
+		{raw: "h1 + p"},
+		{raw: "h1 ~ p"},
+		{raw: "> p"},
+		{raw: "p >"},
+		{raw: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			selector, ok := parseSelector(tt.raw)
+			if ok != tt.ok {
+				t.Fatalf("parseSelector(%q) ok = %v, want %v", tt.raw, ok, tt.ok)
+			}
+			if ok && selector.specificity != tt.specificity {
+				t.Fatalf("parseSelector(%q) specificity = %v, want %v", tt.raw, selector.specificity, tt.specificity)
+			}
+		})
+	}
+}
+
+func TestSelectorMatches(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(`<table class="main"><tr><td id="cell" align="center" class="x y">A</td></tr></table>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cell *html.Node
+	walkElements(doc, func(n *html.Node) {
+		if attr(n, "id") == "cell" {
+			cell = n
+		}
+	})
+
+	tests := []struct {
+		raw  string
+		want bool
+	}{
+		{raw: "td", want: true},
+		{raw: "TD", want: true},
+		{raw: ".x.y", want: true},
+		{raw: ".x.z", want: false},
+		{raw: "#cell", want: true},
+		{raw: "table.main td", want: true},
+		{raw: "table > td", want: false},
+		{raw: "tr > td", want: true},
+		{raw: "[align]", want: true},
+		{raw: `td[align="center"]`, want: true},
+		{raw: "td[align=left]", want: false},
+		{raw: "[class~=y]", want: true},
+		{raw: "[class|=x]", want: false},
+		{raw: `[id*="ce"]`, want: true},
+		{raw: "div td", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			selector, ok := parseSelector(tt.raw)
+			if !ok {
+				t.Fatalf("parseSelector(%q) failed", tt.raw)
+			}
+			if got := selector.matches(cell); got != tt.want {
+				t.Fatalf("%q matches = %v, want %v", tt.raw, got, tt.want)
+			}
+		})
+	}
+}
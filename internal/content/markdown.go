@@ -0,0 +1,609 @@
+package content
+
+import (
+	"html"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Markdown renders the subset of Markdown used in notification bodies:
+// headings, paragraphs, emphasis, inline and fenced code, block quotes,
+// lists, rules, links and images. Raw HTML is escaped, never passed through,
+// and only http, https and mailto URLs become links, so the output is safe
+// to send as is.
+type Markdown struct {
+	HTML string
+	Text string
+}
+
+// MarkdownPlaceholders are accepted as link targets besides absolute URLs,
+// they are replaced with the recipient's links after conversion.
+var MarkdownPlaceholders = []string{"{{unsubscribe_url}}", "{{preferences_url}}"}
+
+func RenderMarkdown(source string) *Markdown {
+	blocks := parseBlocks(strings.Split(normalizeNewlines(source), "\n"))
+
+	var h, t strings.Builder
+	renderHTMLBlocks(&h, blocks, false)
+	renderTextBlocks(&t, blocks, "", false)
+	return &Markdown{
+		HTML: strings.TrimSpace(h.String()),
+		// spaces are kept, a body may start with an indented code block
+		Text: strings.Trim(t.String(), "\n") + "\n",
+	}
+}
+
+const (
+	blockParagraph = iota
+	blockHeading
+	blockCode
+	blockQuote
+	blockList
+	blockRule
+)
+
+type block struct {
+	kind  int
+	level int
+	// lines of paragraphs, headings and code blocks
+	lines    []string
+	children []*block
+	ordered  bool
+	start    int
+	items    []listItem
+}
+
+type listItem struct {
+	blocks []*block
+	// loose items contain blank lines and keep their paragraphs apart
+	loose bool
+}
+
+var (
+	headingLine   = regexp.MustCompile(`^ {0,3}(#{1,6})(?:[ \t]+(.*?))?(?:[ \t]+#+)?[ \t]*$`)
+	ruleLine      = regexp.MustCompile(`^ {0,3}(?:(?:-[ \t]*){3,}|(?:\*[ \t]*){3,}|(?:_[ \t]*){3,})$`)
+	fenceLine     = regexp.MustCompile("^ {0,3}(```+|~~~+)")
+	bulletItem    = regexp.MustCompile(`^ {0,3}([-*+])[ \t]+(.*)$`)
+	orderedItem   = regexp.MustCompile(`^ {0,3}(\d{1,9})[.)][ \t]+(.*)$`)
+	quoteLine     = regexp.MustCompile(`^ {0,3}>[ ]?(.*)$`)
+	setextHeading = regexp.MustCompile(`^ {0,3}(=+|-+)[ \t]*$`)
+)
+
+func normalizeNewlines(s string) string {
+	return strings.NewReplacer("\r\n", "\n", "\r", "\n").Replace(s)
+}
+
+func isBlank(line string) bool {
+	return strings.TrimSpace(line) == ""
+}
+
+func parseBlocks(lines []string) []*block {
+	var blocks []*block
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		switch {
+		case isBlank(line):
+			i++
+
+		case fenceLine.MatchString(line):
+			fence := fenceLine.FindStringSubmatch(line)[1]
+			code := &block{kind: blockCode}
+			for i++; i < len(lines); i++ {
+				if strings.HasPrefix(strings.TrimLeft(lines[i], " "), fence[:3]) {
+					i++
+					break
+				}
+				code.lines = append(code.lines, lines[i])
+			}
+			blocks = append(blocks, code)
+
+		case headingLine.MatchString(line):
+			m := headingLine.FindStringSubmatch(line)
+			blocks = append(blocks, &block{kind: blockHeading, level: len(m[1]), lines: []string{m[2]}})
+			i++
+
+		case ruleLine.MatchString(line):
+			blocks = append(blocks, &block{kind: blockRule})
+			i++
+
+		case quoteLine.MatchString(line):
+			var quoted []string
+			for ; i < len(lines) && quoteLine.MatchString(lines[i]); i++ {
+				quoted = append(quoted, quoteLine.FindStringSubmatch(lines[i])[1])
+			}
+			blocks = append(blocks, &block{kind: blockQuote, children: parseBlocks(quoted)})
+
+		case bulletItem.MatchString(line), orderedItem.MatchString(line):
+			var list *block
+			list, i = parseList(lines, i)
+			blocks = append(blocks, list)
+
+		case strings.HasPrefix(line, "    ") || strings.HasPrefix(line, "\t"):
+			code := &block{kind: blockCode}
+			for ; i < len(lines) && (strings.HasPrefix(lines[i], "    ") || strings.HasPrefix(lines[i], "\t") || isBlank(lines[i])); i++ {
+				code.lines = append(code.lines, strings.TrimPrefix(strings.TrimPrefix(lines[i], "\t"), "    "))
+			}
+			for len(code.lines) > 0 && isBlank(code.lines[len(code.lines)-1]) {
+				code.lines = code.lines[:len(code.lines)-1]
+			}
+			blocks = append(blocks, code)
+
+		default:
+			paragraph := &block{kind: blockParagraph}
+			for ; i < len(lines) && !isBlank(lines[i]) && (len(paragraph.lines) == 0 || !startsBlock(lines[i])); i++ {
+				if len(paragraph.lines) > 0 && setextHeading.MatchString(lines[i]) {
+					level := 1
+					if strings.Contains(lines[i], "-") {
+						level = 2
+					}
+					paragraph.kind, paragraph.level = blockHeading, level
+					i++
+					break
+				}
+				paragraph.lines = append(paragraph.lines, lines[i])
+			}
+			blocks = append(blocks, paragraph)
+		}
+	}
+	return blocks
+}
+
+// startsBlock reports whether a line interrupts a paragraph.
+func startsBlock(line string) bool {
+	return fenceLine.MatchString(line) || headingLine.MatchString(line) || quoteLine.MatchString(line) ||
+		bulletItem.MatchString(line) || orderedItem.MatchString(line) ||
+		(ruleLine.MatchString(line) && !setextHeading.MatchString(line))
+}
+
+// parseList reads list items with their indented continuation lines, which
+// may hold nested lists.
+func parseList(lines []string, i int) (*block, int) {
+	list := &block{kind: blockList}
+	if m := orderedItem.FindStringSubmatch(lines[i]); m != nil {
+		list.ordered = true
+		list.start, _ = strconv.Atoi(m[1])
+	}
+
+	for i < len(lines) {
+		var content string
+		if m := orderedItem.FindStringSubmatch(lines[i]); m != nil && list.ordered {
+			content = m[2]
+		} else if m := bulletItem.FindStringSubmatch(lines[i]); m != nil && !list.ordered {
+			content = m[2]
+		} else {
+			break
+		}
+
+		item := []string{content}
+		loose := false
+		for i++; i < len(lines); i++ {
+			line := lines[i]
+			if isBlank(line) {
+				// a blank line ends the list unless an item or indented text follows
+				if i+1 < len(lines) && (isIndented(lines[i+1]) || sameListItem(lines[i+1], list.ordered)) {
+					item = append(item, "")
+					loose = loose || isIndented(lines[i+1])
+					continue
+				}
+				break
+			}
+			if isIndented(line) {
+				item = append(item, strings.TrimLeft(line, " \t"))
+				continue
+			}
+			if sameListItem(line, list.ordered) || startsBlock(line) {
+				break
+			}
+			// lazy continuation of the item paragraph
+			item = append(item, line)
+		}
+		list.items = append(list.items, listItem{blocks: parseBlocks(item), loose: loose})
+		if i < len(lines) && isBlank(lines[i]) && i+1 < len(lines) && sameListItem(lines[i+1], list.ordered) {
+			i++
+		}
+	}
+	return list, i
+}
+
+func isIndented(line string) bool {
+	return strings.HasPrefix(line, "  ") || strings.HasPrefix(line, "\t")
+}
+
+func sameListItem(line string, ordered bool) bool {
+	if ordered {
+		return orderedItem.MatchString(line)
+	}
+	return bulletItem.MatchString(line)
+}
+
+// renderHTMLBlocks writes blocks as HTML, tight list items get their
+// paragraphs without <p>.
+func renderHTMLBlocks(b *strings.Builder, blocks []*block, tight bool) {
+	for _, bl := range blocks {
+		switch bl.kind {
+		case blockParagraph:
+			if tight {
+				b.WriteString(inlineHTML(strings.Join(bl.lines, "\n")) + "\n")
+				continue
+			}
+			b.WriteString("<p>")
+			b.WriteString(inlineHTML(strings.Join(bl.lines, "\n")))
+			b.WriteString("</p>\n")
+		case blockHeading:
+			tag := "h" + strconv.Itoa(bl.level)
+			b.WriteString("<" + tag + ">" + inlineHTML(strings.Join(bl.lines, " ")) + "</" + tag + ">\n")
+		case blockCode:
+			b.WriteString("<pre><code>")
+			b.WriteString(html.EscapeString(strings.Join(bl.lines, "\n")))
+			b.WriteString("</code></pre>\n")
+		case blockQuote:
+			b.WriteString("<blockquote>\n")
+			renderHTMLBlocks(b, bl.children, false)
+			b.WriteString("</blockquote>\n")
+		case blockRule:
+			b.WriteString("<hr>\n")
+		case blockList:
+			tag := "ul"
+			if bl.ordered {
+				tag = "ol"
+			}
+			b.WriteString("<" + tag)
+			if bl.ordered && bl.start != 1 {
+				b.WriteString(` start="` + strconv.Itoa(bl.start) + `"`)
+			}
+			b.WriteString(">\n")
+			for _, item := range bl.items {
+				b.WriteString("<li>")
+				var itemHTML strings.Builder
+				renderHTMLBlocks(&itemHTML, item.blocks, !item.loose)
+				b.WriteString(strings.TrimSuffix(itemHTML.String(), "\n"))
+				b.WriteString("</li>\n")
+			}
+			b.WriteString("</" + tag + ">\n")
+		}
+	}
+}
+
+func renderTextBlocks(b *strings.Builder, blocks []*block, indent string, tight bool) {
+	for i, bl := range blocks {
+		if i > 0 && !tight {
+			b.WriteString(strings.TrimRight(indent, " ") + "\n")
+		}
+		switch bl.kind {
+		case blockParagraph:
+			writeIndented(b, indent, inlineText(strings.Join(bl.lines, "\n")))
+		case blockHeading:
+			title := inlineText(strings.Join(bl.lines, " "))
+			writeIndented(b, indent, title)
+			if bl.level <= 2 {
+				underline := "="
+				if bl.level == 2 {
+					underline = "-"
+				}
+				writeIndented(b, indent, strings.Repeat(underline, len([]rune(title))))
+			}
+		case blockCode:
+			for _, line := range bl.lines {
+				writeIndented(b, indent, "    "+line)
+			}
+		case blockQuote:
+			renderTextBlocks(b, bl.children, indent+"> ", false)
+		case blockRule:
+			writeIndented(b, indent, "----")
+		case blockList:
+			for n, item := range bl.items {
+				marker := "- "
+				if bl.ordered {
+					marker = strconv.Itoa(bl.start+n) + ". "
+				}
+				var itemText strings.Builder
+				renderTextBlocks(&itemText, item.blocks, "", !item.loose)
+				lines := strings.Split(strings.TrimRight(itemText.String(), "\n"), "\n")
+				for j, line := range lines {
+					prefix := strings.Repeat(" ", len(marker))
+					if j == 0 {
+						prefix = marker
+					}
+					writeIndented(b, indent, strings.TrimRight(prefix+line, " "))
+				}
+			}
+		}
+	}
+}
+
+func writeIndented(b *strings.Builder, indent, text string) {
+	for _, line := range strings.Split(text, "\n") {
+		b.WriteString(strings.TrimRight(indent+line, " "))
+		b.WriteString("\n")
+	}
+}
+
+// inline is a span of a paragraph.
+type inline struct {
+	kind     int
+	text     string
+	url      string
+	children []inline
+}
+
+const (
+	spanText = iota
+	spanStrong
+	spanEmphasis
+	spanCode
+	spanLink
+	spanImage
+	spanBreak
+)
+
+var (
+	linkSpan     = regexp.MustCompile(`^(!?)\[([^\]]*)\]\(\s*<?([^\s()<>]*(?:\([^\s()<>]*\))?[^\s()<>]*)>?(?:\s+"[^"]*")?\s*\)`)
+	autolinkSpan = regexp.MustCompile(`^<((?:https?://|mailto:)[^\s<>]+)>`)
+	bareURL      = regexp.MustCompile(`^https?://[^\s<>]*[^\s<>.,;:!?"')\]]`)
+	rawHTML      = regexp.MustCompile(`^(?s:<!--.*?-->|</?([A-Za-z][A-Za-z0-9-]*)(?:\s[^<>]*)?/?>)`)
+	// closingCode ends the raw HTML elements whose content is never linked
+	closingCode = map[string]*regexp.Regexp{
+		"code": regexp.MustCompile(`(?i)</code\s*>`),
+		"pre":  regexp.MustCompile(`(?i)</pre\s*>`),
+	}
+)
+
+// parseInline splits text into spans. Emphasis must be closed on the same
+// paragraph, unmatched markers are kept as text.
+func parseInline(s string) []inline {
+	var spans []inline
+	var text strings.Builder
+	flush := func() {
+		if text.Len() > 0 {
+			spans = append(spans, inline{kind: spanText, text: text.String()})
+			text.Reset()
+		}
+	}
+
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s) && strings.ContainsRune("\\`*_{}[]()#+-.!<>|~", rune(s[i+1])):
+			text.WriteByte(s[i+1])
+			i += 2
+			continue
+
+		case c == '\\' && i+1 < len(s) && s[i+1] == '\n':
+			flush()
+			spans = append(spans, inline{kind: spanBreak})
+			i += 2
+			continue
+
+		case c == '\n':
+			if strings.HasSuffix(text.String(), "  ") {
+				trimmed := strings.TrimRight(text.String(), " ")
+				text.Reset()
+				text.WriteString(trimmed)
+				flush()
+				spans = append(spans, inline{kind: spanBreak})
+			} else {
+				text.WriteByte('\n')
+			}
+			i++
+			continue
+
+		case c == '`':
+			ticks := len(s[i:]) - len(strings.TrimLeft(s[i:], "`"))
+			delimiter := s[i : i+ticks]
+			if end := strings.Index(s[i+ticks:], delimiter); end >= 0 {
+				flush()
+				code := s[i+ticks : i+ticks+end]
+				spans = append(spans, inline{kind: spanCode, text: strings.TrimSpace(code)})
+				i += ticks + end + ticks
+				continue
+			}
+
+		case c == '[' || (c == '!' && i+1 < len(s) && s[i+1] == '['):
+			if m := linkSpan.FindStringSubmatch(s[i:]); m != nil {
+				flush()
+				kind := spanLink
+				if m[1] == "!" {
+					kind = spanImage
+				}
+				spans = append(spans, inline{kind: kind, url: m[3], text: m[2], children: parseInline(m[2])})
+				i += len(m[0])
+				continue
+			}
+
+		case c == '<':
+			if m := autolinkSpan.FindStringSubmatch(s[i:]); m != nil {
+				flush()
+				spans = append(spans, inline{kind: spanLink, url: m[1], text: m[1], children: []inline{{kind: spanText, text: m[1]}}})
+				i += len(m[0])
+				continue
+			}
+			// raw HTML is escaped as written, URLs in it are not linked
+			if n := rawHTMLLength(s[i:]); n > 0 {
+				text.WriteString(s[i : i+n])
+				i += n
+				continue
+			}
+
+		case c == 'h' && (i == 0 || !isWordByte(s[i-1])):
+			if m := bareURL.FindString(s[i:]); m != "" {
+				flush()
+				spans = append(spans, inline{kind: spanLink, url: m, text: m, children: []inline{{kind: spanText, text: m}}})
+				i += len(m)
+				continue
+			}
+
+		case c == '*' || c == '_':
+			if span, n := parseEmphasis(s[i:]); n > 0 {
+				flush()
+				spans = append(spans, span)
+				i += n
+				continue
+			}
+		}
+		text.WriteByte(c)
+		i++
+	}
+	flush()
+	return spans
+}
+
+// parseEmphasis matches **strong**, __strong__, *emphasis* and _emphasis_
+// at the start of s and returns the span and the bytes consumed.
+func parseEmphasis(s string) (inline, int) {
+	// ***both*** is a strong span inside emphasis
+	if len(s) > 3 && s[1] == s[0] && s[2] == s[0] {
+		if strong, n := parseEmphasis(s[1:]); strong.kind == spanStrong && 1+n < len(s) && s[1+n] == s[0] {
+			return inline{kind: spanEmphasis, children: []inline{strong}}, n + 2
+		}
+	}
+	for _, marker := range []struct {
+		delimiter string
+		kind      int
+	}{{s[:1] + s[:1], spanStrong}, {s[:1], spanEmphasis}} {
+		d := marker.delimiter
+		if !strings.HasPrefix(s, d) || len(s) <= len(d) || s[len(d)] == ' ' || s[len(d)] == '\n' {
+			continue
+		}
+		for from := len(d); from < len(s); {
+			end := strings.Index(s[from:], d)
+			if end < 0 {
+				break
+			}
+			end += from
+			// the closing marker must follow text and, for _, end a word
+			closes := s[end-1] != ' ' && s[end-1] != '\n' && end > len(d)
+			if closes && d[0] == '_' && end+len(d) < len(s) && isWordByte(s[end+len(d)]) {
+				closes = false
+			}
+			// a single marker directly followed by another one belongs to a strong span
+			if closes && len(d) == 1 && end+1 < len(s) && s[end+1] == d[0] {
+				closes = false
+				from = end + 2
+				continue
+			}
+			if closes {
+				inner := s[len(d):end]
+				return inline{kind: marker.kind, children: parseInline(inner)}, end + len(d)
+			}
+			from = end + len(d)
+		}
+	}
+	return inline{}, 0
+}
+
+// rawHTMLLength returns the length of the HTML tag or comment at the start
+// of s, a <code> or <pre> tag spans up to its closing tag.
+func rawHTMLLength(s string) int {
+	m := rawHTML.FindStringSubmatch(s)
+	if m == nil {
+		return 0
+	}
+	n := len(m[0])
+	if closing, ok := closingCode[strings.ToLower(m[1])]; ok && !strings.HasPrefix(m[0], "</") {
+		if loc := closing.FindStringIndex(s[n:]); loc != nil {
+			n += loc[1]
+		}
+	}
+	return n
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
+
+// safeURL returns the URL if it may be linked, empty otherwise.
+func safeURL(raw string) string {
+	for _, placeholder := range MarkdownPlaceholders {
+		if raw == placeholder {
+			return raw
+		}
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return ""
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https":
+		if u.Host == "" {
+			return ""
+		}
+		return u.String()
+	case "mailto":
+		return u.String()
+	}
+	return ""
+}
+
+func inlineHTML(s string) string {
+	var b strings.Builder
+	writeInlineHTML(&b, parseInline(s))
+	return b.String()
+}
+
+func writeInlineHTML(b *strings.Builder, spans []inline) {
+	for _, span := range spans {
+		switch span.kind {
+		case spanText:
+			b.WriteString(html.EscapeString(span.text))
+		case spanStrong:
+			b.WriteString("<strong>")
+			writeInlineHTML(b, span.children)
+			b.WriteString("</strong>")
+		case spanEmphasis:
+			b.WriteString("<em>")
+			writeInlineHTML(b, span.children)
+			b.WriteString("</em>")
+		case spanCode:
+			b.WriteString("<code>" + html.EscapeString(span.text) + "</code>")
+		case spanBreak:
+			b.WriteString("<br>\n")
+		case spanLink:
+			href := safeURL(span.url)
+			if href == "" {
+				writeInlineHTML(b, span.children)
+				continue
+			}
+			b.WriteString(`<a href="` + html.EscapeString(href) + `">`)
+			writeInlineHTML(b, span.children)
+			b.WriteString("</a>")
+		case spanImage:
+			src := safeURL(span.url)
+			if src == "" || strings.HasPrefix(src, "mailto:") || strings.HasPrefix(src, "{{") {
+				b.WriteString(html.EscapeString(span.text))
+				continue
+			}
+			b.WriteString(`<img src="` + html.EscapeString(src) + `" alt="` + html.EscapeString(span.text) + `">`)
+		}
+	}
+}
+
+func inlineText(s string) string {
+	var b strings.Builder
+	writeInlineText(&b, parseInline(s))
+	return b.String()
+}
+
+func writeInlineText(b *strings.Builder, spans []inline) {
+	for _, span := range spans {
+		switch span.kind {
+		case spanText, spanCode:
+			b.WriteString(span.text)
+		case spanStrong, spanEmphasis:
+			writeInlineText(b, span.children)
+		case spanBreak:
+			b.WriteString("\n")
+		case spanLink:
+			var label strings.Builder
+			writeInlineText(&label, span.children)
+			href := safeURL(span.url)
+			b.WriteString(label.String())
+			if href != "" && href != label.String() && strings.TrimPrefix(href, "mailto:") != label.String() {
+				b.WriteString(" (" + href + ")")
+			}
+		case spanImage:
+			b.WriteString(span.text)
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package content
+
+import "testing"
+
+func TestRenderMarkdown(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		html   string
+		text   string
+	}{
+		// emphasis
+		{
+			name:   "emphasis and strong",
+			source: "Hello *world* and **bold**, _em_ and __strong__",
+			html:   "<p>Hello <em>world</em> and <strong>bold</strong>, <em>em</em> and <strong>strong</strong></p>",
+			text:   "Hello world and bold, em and strong\n",
+		},
+		{
+			name:   "strong inside emphasis",
+			source: "***both***",
+			html:   "<p><em><strong>both</strong></em></p>",
+			text:   "both\n",
+		},
+		{
+			name:   "underscores inside words",
+			source: "snake_case_name",
+			html:   "<p>snake_case_name</p>",
+			text:   "snake_case_name\n",
+		},
+		{
+			name:   "unmatched markers",
+			source: "**open and *also",
+			html:   "<p>**open and *also</p>",
+			text:   "**open and *also\n",
+		},
+		{
+			name:   "hard line break",
+			source: "line one  \nline two",
+			html:   "<p>line one<br>\nline two</p>",
+			text:   "line one\nline two\n",
+		},
+
+		// lists
+		{
+			name:   "bullet list",
+			source: "- one\n* two\n+ three",
+			html:   "<ul>\n<li>one</li>\n<li>two</li>\n<li>three</li>\n</ul>",
+			text:   "- one\n- two\n- three\n",
+		},
+		{
+			name:   "ordered list with start",
+			source: "3. three\n4) four",
+			html:   "<ol start=\"3\">\n<li>three</li>\n<li>four</li>\n</ol>",
+			text:   "3. three\n4. four\n",
+		},
+		{
+			name:   "nested list",
+			source: "- a\n  - b\n  - c\n- d",
+			html:   "<ul>\n<li>a\n<ul>\n<li>b</li>\n<li>c</li>\n</ul></li>\n<li>d</li>\n</ul>",
+			text:   "- a\n  - b\n  - c\n- d\n",
+		},
+
+		// code
+		{
+			name:   "inline code",
+			source: "Run `a < b && *c*` now",
+			html:   "<p>Run <code>a &lt; b &amp;&amp; *c*</code> now</p>",
+			text:   "Run a < b && *c* now\n",
+		},
+		{
+			name:   "fenced code block",
+			source: "```go\nif a < b {\n\treturn \"**x**\"\n}\n```",
+			html:   "<pre><code>if a &lt; b {\n\treturn &#34;**x**&#34;\n}</code></pre>",
+			text:   "    if a < b {\n    \treturn \"**x**\"\n    }\n",
+		},
+		{
+			name:   "indented code block",
+			source: "    go run .\n\nDone",
+			html:   "<pre><code>go run .</code></pre>\n<p>Done</p>",
+			text:   "    go run .\n\nDone\n",
+		},
+
+		// links
+		{
+			name:   "link",
+			source: "[site](https://example.com/a?b=1&c=2)",
+			html:   "<p><a href=\"https://example.com/a?b=1&amp;c=2\">site</a></p>",
+			text:   "site (https://example.com/a?b=1&c=2)\n",
+		},
+		{
+			name:   "mailto link",
+			source: "[write us](mailto:help@example.com)",
+			html:   "<p><a href=\"mailto:help@example.com\">write us</a></p>",
+			text:   "write us (mailto:help@example.com)\n",
+		},
+		{
+			name:   "bare URL",
+			source: "https://example.com",
+			html:   "<p><a href=\"https://example.com\">https://example.com</a></p>",
+			text:   "https://example.com\n",
+		},
+		{
+			name:   "URLs in code are not linked",
+			source: "Run `curl https://example.com/a`\n\n```\nhttps://example.com/b\n```",
+			html:   "<p>Run <code>curl https://example.com/a</code></p>\n<pre><code>https://example.com/b</code></pre>",
+			text:   "Run curl https://example.com/a\n\n    https://example.com/b\n",
+		},
+		{
+			name:   "placeholder link",
+			source: "[Unsubscribe]({{unsubscribe_url}})",
+			html:   "<p><a href=\"{{unsubscribe_url}}\">Unsubscribe</a></p>",
+			text:   "Unsubscribe ({{unsubscribe_url}})\n",
+		},
+		{
+			name:   "quote in URL cannot break out of the attribute",
+			source: "[x](https://example.com/\"onclick=\"alert(1))",
+			html:   "<p><a href=\"https://example.com/%22onclick=%22alert%281%29\">x</a></p>",
+			text:   "x (https://example.com/%22onclick=%22alert%281%29)\n",
+		},
+		{
+			name:   "image",
+			source: "![Logo](https://example.com/logo.png)",
+			html:   "<p><img src=\"https://example.com/logo.png\" alt=\"Logo\"></p>",
+			text:   "Logo\n",
+		},
+		{
+			name:   "javascript link is dropped",
+			source: "[click](javascript:alert(1))",
+			html:   "<p>click</p>",
+			text:   "click\n",
+		},
+		{
+			name:   "javascript image is dropped",
+			source: "![x](javascript:alert(1))",
+			html:   "<p>x</p>",
+			text:   "x\n",
+		},
+
+		// escaping
+		{
+			name:   "raw HTML is escaped",
+			source: "<script>alert(1)</script>",
+			html:   "<p>&lt;script&gt;alert(1)&lt;/script&gt;</p>",
+			text:   "<script>alert(1)</script>\n",
+		},
+		{
+			name:   "URLs in raw HTML are not linked",
+			source: "<a href=\"https://example.com/a\">a</a> <code>https://example.com/b</code> <PRE>https://example.com/c</pre> <!-- https://example.com/d --> https://example.com/e",
+			html: "<p>&lt;a href=&#34;https://example.com/a&#34;&gt;a&lt;/a&gt; &lt;code&gt;https://example.com/b&lt;/code&gt; " +
+				"&lt;PRE&gt;https://example.com/c&lt;/pre&gt; &lt;!-- https://example.com/d --&gt; <a href=\"https://example.com/e\">https://example.com/e</a></p>",
+			text: "<a href=\"https://example.com/a\">a</a> <code>https://example.com/b</code> <PRE>https://example.com/c</pre> <!-- https://example.com/d --> https://example.com/e\n",
+		},
+		{
+			name:   "special characters",
+			source: "a & b < c > d \"q\" 'a'",
+			html:   "<p>a &amp; b &lt; c &gt; d &#34;q&#34; &#39;a&#39;</p>",
+			text:   "a & b < c > d \"q\" 'a'\n",
+		},
+		{
+			name:   "HTML in headings and link labels",
+			source: "# Hi <b>\n\n[<img src=x>](https://example.com)",
+			html:   "<h1>Hi &lt;b&gt;</h1>\n<p><a href=\"https://example.com\">&lt;img src=x&gt;</a></p>",
+			text:   "Hi <b>\n======\n\n<img src=x> (https://example.com)\n",
+		},
+
+		// blocks
+		{
+			name:   "quote and rule",
+			source: "> quoted *text*\n\n---",
+			html:   "<blockquote>\n<p>quoted <em>text</em></p>\n</blockquote>\n<hr>",
+			text:   "> quoted text\n\n----\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := RenderMarkdown(tt.source)
+			if got.HTML != tt.html {
+				t.Errorf("HTML = %q, want %q", got.HTML, tt.html)
+			}
+			if got.Text != tt.text {
+				t.Errorf("Text = %q, want %q", got.Text, tt.text)
+			}
+		})
+	}
+}
+
+func TestSafeURL(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want string
+	}{
+		{raw: "https://example.com/a", want: "https://example.com/a"},
+		{raw: "HTTP://example.com", want: "http://example.com"},
+		{raw: "mailto:a@example.com", want: "mailto:a@example.com"},
+		{raw: "{{preferences_url}}", want: "{{preferences_url}}"},
+		{raw: "javascript:alert(1)"},
+		{raw: "JavaScript:alert(1)"},
+		{raw: " javascript:alert(1)"},
+		{raw: "java\tscript:alert(1)"},
+		{raw: "vbscript:msgbox(1)"},
+		{raw: "data:text/html;base64,PHNjcmlwdD4="},
+		{raw: "//example.com/a"},
+		{raw: "/relative"},
+		{raw: "https:///no-host"},
+		{raw: "{{other}}"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			if got := safeURL(tt.raw); got != tt.want {
+				t.Fatalf("safeURL(%q) = %q, want %q", tt.raw, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,279 @@
+package content
+
+import (
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// cssSelector is the subset of CSS selectors that can be resolved statically:
+// type, universal, class, id and attribute selectors joined by descendant or
+// child combinators. Anything else (pseudo-classes, sibling combinators) is
+// left in the stylesheet.
+type cssSelector struct {
+	// compounds are stored right to left, combinators[i] joins compounds[i]
+	// with compounds[i+1]
+	compounds   []compoundSelector
+	combinators []byte
+	specificity [3]int
+}
+
+type compoundSelector struct {
+	tag     string
+	id      string
+	classes []string
+	attrs   []attrSelector
+}
+
+type attrSelector struct {
+	key   string
+	op    string
+	value string
+}
+
+func parseSelector(raw string) (*cssSelector, bool) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" || strings.ContainsAny(withoutAttrs(raw), ":+~") {
+		return nil, false
+	}
+
+	var compounds []compoundSelector
+	var combinators []byte
+	pending := byte(0)
+
+	for i := 0; i < len(raw); {
+		switch {
+		case isSpace(raw[i]):
+			if pending == 0 {
+				pending = ' '
+			}
+			i++
+			continue
+		case raw[i] == '>':
+			pending = '>'
+			i++
+			continue
+		}
+
+		compound, next, ok := parseCompound(raw, i)
+		if !ok {
+			return nil, false
+		}
+		if len(compounds) > 0 {
+			if pending == 0 {
+				return nil, false
+			}
+			combinators = append(combinators, pending)
+		} else if pending == '>' {
+			return nil, false
+		}
+		compounds = append(compounds, compound)
+		pending = 0
+		i = next
+	}
+	if len(compounds) == 0 || pending == '>' {
+		return nil, false
+	}
+
+	selector := &cssSelector{}
+	for i := len(compounds) - 1; i >= 0; i-- {
+		c := compounds[i]
+		selector.compounds = append(selector.compounds, c)
+		if c.id != "" {
+			selector.specificity[0]++
+		}
+		selector.specificity[1] += len(c.classes) + len(c.attrs)
+		if c.tag != "" {
+			selector.specificity[2]++
+		}
+	}
+	for i := len(combinators) - 1; i >= 0; i-- {
+		selector.combinators = append(selector.combinators, combinators[i])
+	}
+	return selector, true
+}
+
+func parseCompound(raw string, i int) (compoundSelector, int, bool) {
+	var c compoundSelector
+	start := i
+
+	if raw[i] == '*' {
+		i++
+	} else if isIdentChar(raw[i]) {
+		j := identEnd(raw, i)
+		c.tag = strings.ToLower(raw[i:j])
+		i = j
+	}
+
+	for i < len(raw) && !isSpace(raw[i]) && raw[i] != '>' {
+		switch raw[i] {
+		case '.', '#':
+			j := identEnd(raw, i+1)
+			if j == i+1 {
+				return c, i, false
+			}
+			if raw[i] == '.' {
+				c.classes = append(c.classes, raw[i+1:j])
+			} else {
+				if c.id != "" {
+					return c, i, false
+				}
+				c.id = raw[i+1 : j]
+			}
+			i = j
+		case '[':
+			end := strings.IndexByte(raw[i:], ']')
+			if end < 0 {
+				return c, i, false
+			}
+			a, ok := parseAttrSelector(raw[i+1 : i+end])
+			if !ok {
+				return c, i, false
+			}
+			c.attrs = append(c.attrs, a)
+			i += end + 1
+		default:
+			return c, i, false
+		}
+	}
+
+	return c, i, i > start
+}
+
+func parseAttrSelector(raw string) (attrSelector, bool) {
+	for _, op := range []string{"~=", "|=", "^=", "$=", "*=", "="} {
+		if idx := strings.Index(raw, op); idx >= 0 {
+			key := strings.ToLower(strings.TrimSpace(raw[:idx]))
+			value := strings.Trim(strings.TrimSpace(raw[idx+len(op):]), `"'`)
+			return attrSelector{key: key, op: op, value: value}, key != ""
+		}
+	}
+	key := strings.ToLower(strings.TrimSpace(raw))
+	return attrSelector{key: key}, key != ""
+}
+
+func (s *cssSelector) matches(n *html.Node) bool {
+	return s.matchFrom(n, 0)
+}
+
+func (s *cssSelector) matchFrom(n *html.Node, idx int) bool {
+	if !s.compounds[idx].matches(n) {
+		return false
+	}
+	if idx == len(s.compounds)-1 {
+		return true
+	}
+
+	switch s.combinators[idx] {
+	case '>':
+		parent := elementParent(n)
+		return parent != nil && s.matchFrom(parent, idx+1)
+	default:
+		for ancestor := elementParent(n); ancestor != nil; ancestor = elementParent(ancestor) {
+			if s.matchFrom(ancestor, idx+1) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func (c *compoundSelector) matches(n *html.Node) bool {
+	if c.tag != "" && c.tag != n.Data {
+		return false
+	}
+	if c.id != "" && attr(n, "id") != c.id {
+		return false
+	}
+	if len(c.classes) > 0 {
+		classes := strings.Fields(attr(n, "class"))
+		for _, want := range c.classes {
+			if !contains(classes, want) {
+				return false
+			}
+		}
+	}
+	for _, a := range c.attrs {
+		if !a.matches(n) {
+			return false
+		}
+	}
+	return true
+}
+
+func (a *attrSelector) matches(n *html.Node) bool {
+	var value string
+	found := false
+	for _, attr := range n.Attr {
+		if attr.Key == a.key {
+			value, found = attr.Val, true
+			break
+		}
+	}
+	if !found {
+		return false
+	}
+
+	switch a.op {
+	case "":
+		return true
+	case "=":
+		return value == a.value
+	case "~=":
+		return contains(strings.Fields(value), a.value)
+	case "|=":
+		return value == a.value || strings.HasPrefix(value, a.value+"-")
+	case "^=":
+		return a.value != "" && strings.HasPrefix(value, a.value)
+	case "$=":
+		return a.value != "" && strings.HasSuffix(value, a.value)
+	case "*=":
+		return a.value != "" && strings.Contains(value, a.value)
+	}
+	return false
+}
+
+// withoutAttrs drops the attribute selectors of raw, whose operators and
+// values may contain ~, + and : without being pseudo-classes or combinators.
+func withoutAttrs(raw string) string {
+	var b strings.Builder
+	depth := 0
+	for i := 0; i < len(raw); i++ {
+		switch {
+		case raw[i] == '[':
+			depth++
+		case raw[i] == ']' && depth > 0:
+			depth--
+		case depth == 0:
+			b.WriteByte(raw[i])
+		}
+	}
+	return b.String()
+}
+
+func elementParent(n *html.Node) *html.Node {
+	if n.Parent != nil && n.Parent.Type == html.ElementNode {
+		return n.Parent
+	}
+	return nil
+}
+
+func identEnd(s string, i int) int {
+	for i < len(s) && isIdentChar(s[i]) {
+		i++
+	}
+	return i
+}
+
+func isIdentChar(c byte) bool {
+	return c == '-' || c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,275 @@
+package content
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// HTMLToText renders an HTML body as readable plain text: links become
+// numbered footnotes, lists keep their markers, headings are underlined and
+// table cells are flattened into rows. Entities are decoded by the parser.
+func HTMLToText(body string) (string, error) {
+	doc, err := html.Parse(strings.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("failed to parse HTML: %w", err)
+	}
+
+	r := &textRenderer{}
+	r.render(doc)
+	return r.withFootnotes(), nil
+}
+
+type textRenderer struct {
+	out   strings.Builder
+	line  strings.Builder
+	links []string
+	lists []listState
+	pre   int
+	// pendingBreaks is the number of newlines to emit before the next text
+	pendingBreaks int
+}
+
+type listState struct {
+	ordered bool
+	index   int
+}
+
+func (r *textRenderer) render(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		r.text(n.Data)
+		return
+	case html.ElementNode:
+		r.element(n)
+		return
+	}
+	r.children(n)
+}
+
+func (r *textRenderer) children(n *html.Node) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		r.render(c)
+	}
+}
+
+func (r *textRenderer) element(n *html.Node) {
+	switch n.DataAtom {
+	case atom.Head, atom.Script, atom.Style, atom.Title, atom.Template:
+		return
+	case atom.Br:
+		r.flushLine()
+		r.out.WriteString("\n")
+	case atom.Hr:
+		r.block(2)
+		r.line.WriteString(strings.Repeat("-", 40))
+		r.block(2)
+	case atom.Img:
+		if alt := attr(n, "alt"); alt != "" {
+			r.text(alt)
+		}
+	case atom.A:
+		r.children(n)
+		r.link(attr(n, "href"))
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		r.heading(n)
+	case atom.Ul, atom.Ol:
+		r.block(1)
+		r.lists = append(r.lists, listState{ordered: n.DataAtom == atom.Ol})
+		r.children(n)
+		r.lists = r.lists[:len(r.lists)-1]
+		r.block(1)
+	case atom.Li:
+		r.listItem(n)
+	case atom.Tr:
+		r.block(1)
+		r.tableRow(n)
+		r.block(1)
+	case atom.Table:
+		r.block(2)
+		r.children(n)
+		r.block(2)
+	case atom.Pre:
+		r.block(2)
+		r.pre++
+		r.children(n)
+		r.pre--
+		r.block(2)
+	case atom.P, atom.Div, atom.Blockquote, atom.Section, atom.Article,
+		atom.Header, atom.Footer, atom.Center:
+		r.block(2)
+		r.children(n)
+		r.block(2)
+	default:
+		r.children(n)
+	}
+}
+
+func (r *textRenderer) heading(n *html.Node) {
+	r.block(2)
+	inner := &textRenderer{links: r.links}
+	inner.children(n)
+	title := strings.TrimSpace(inner.result())
+	r.links = inner.links
+	if title == "" {
+		return
+	}
+
+	underline := "-"
+	if n.DataAtom == atom.H1 || n.DataAtom == atom.H2 {
+		underline = "="
+	}
+	r.line.WriteString(title)
+	r.flushLine()
+	r.out.WriteString("\n" + strings.Repeat(underline, len([]rune(title))))
+	r.pendingBreaks = 0
+	r.block(2)
+}
+
+func (r *textRenderer) listItem(n *html.Node) {
+	r.block(1)
+	marker := "* "
+	depth := len(r.lists)
+	if depth > 0 {
+		state := &r.lists[depth-1]
+		state.index++
+		if state.ordered {
+			marker = strconv.Itoa(state.index) + ". "
+		}
+		marker = strings.Repeat("  ", depth-1) + marker
+	}
+	r.line.WriteString(marker)
+	r.children(n)
+	r.block(1)
+}
+
+func (r *textRenderer) tableRow(n *html.Node) {
+	var cells []string
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type != html.ElementNode || (c.DataAtom != atom.Td && c.DataAtom != atom.Th) {
+			continue
+		}
+		inner := &textRenderer{links: r.links}
+		inner.children(c)
+		r.links = inner.links
+		if cell := strings.Join(strings.Fields(inner.result()), " "); cell != "" {
+			cells = append(cells, cell)
+		}
+	}
+	r.text(strings.Join(cells, " | "))
+}
+
+func (r *textRenderer) link(href string) {
+	href = strings.TrimSpace(href)
+	if href == "" || strings.HasPrefix(href, "#") || strings.HasPrefix(strings.ToLower(href), "javascript:") {
+		return
+	}
+	for i, existing := range r.links {
+		if existing == href {
+			r.line.WriteString(fmt.Sprintf(" [%d]", i+1))
+			return
+		}
+	}
+	r.links = append(r.links, href)
+	r.line.WriteString(fmt.Sprintf(" [%d]", len(r.links)))
+}
+
+func (r *textRenderer) text(data string) {
+	if r.pre > 0 {
+		r.emitBreaks()
+		lines := strings.Split(data, "\n")
+		for i, l := range lines {
+			if i > 0 {
+				r.flushLine()
+				r.out.WriteString("\n")
+			}
+			r.line.WriteString(l)
+		}
+		return
+	}
+
+	words := strings.Fields(data)
+	if len(words) == 0 {
+		if data != "" && r.line.Len() > 0 && !strings.HasSuffix(r.line.String(), " ") {
+			r.line.WriteString(" ")
+		}
+		return
+	}
+	r.emitBreaks()
+	current := r.line.String()
+	if current != "" && !strings.HasSuffix(current, " ") && startsWithSpace(data) {
+		r.line.WriteString(" ")
+	}
+	r.line.WriteString(strings.Join(words, " "))
+	if endsWithSpace(data) {
+		r.line.WriteString(" ")
+	}
+}
+
+// block requests at least n line breaks before the next piece of text.
+func (r *textRenderer) block(n int) {
+	r.flushLine()
+	if n > r.pendingBreaks {
+		r.pendingBreaks = n
+	}
+}
+
+func (r *textRenderer) emitBreaks() {
+	if r.pendingBreaks == 0 {
+		return
+	}
+	if r.out.Len() > 0 {
+		r.out.WriteString(strings.Repeat("\n", r.pendingBreaks))
+	}
+	r.pendingBreaks = 0
+}
+
+func (r *textRenderer) flushLine() {
+	line := strings.TrimRight(r.line.String(), " ")
+	r.line.Reset()
+	if line == "" {
+		return
+	}
+	r.emitBreaks()
+	r.out.WriteString(line)
+}
+
+func (r *textRenderer) result() string {
+	r.flushLine()
+	return strings.TrimSpace(r.out.String())
+}
+
+func (r *textRenderer) withFootnotes() string {
+	text := r.result()
+	if len(r.links) == 0 {
+		return text
+	}
+
+	var b strings.Builder
+	b.WriteString(text)
+	b.WriteString("\n\n")
+	for i, href := range r.links {
+		fmt.Fprintf(&b, "[%d] %s\n", i+1, href)
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func startsWithSpace(s string) bool {
+	return s != "" && strings.ContainsRune(" \t\n\r\f", rune(s[0]))
+}
+
+func endsWithSpace(s string) bool {
+	return s != "" && strings.ContainsRune(" \t\n\r\f", rune(s[len(s)-1]))
+}
@@ -0,0 +1,94 @@
+package content
+
+import "testing"
+
+func TestHTMLToText(t *testing.T) {
+	tests := []struct {
+		name string
+		html string
+		text string
+	}{
+		{
+			name: "links become footnotes",
+			html: `<p>See <a href="https://example.com/a">the booking</a> and <a href="https://example.com/b">the invoice</a>.</p>`,
+			text: "See the booking [1] and the invoice [2].\n\n[1] https://example.com/a\n[2] https://example.com/b",
+		},
+		{
+			name: "repeated link reuses its footnote",
+			html: `<a href="https://example.com/a">One</a> <a href="https://example.com/a">again</a>`,
+			text: "One [1] again [1]\n\n[1] https://example.com/a",
+		},
+		{
+			name: "anchors and javascript links get no footnote",
+			html: `<a href="#top">Top</a> <a href="javascript:alert(1)">Click</a> <a>Plain</a>`,
+			text: "Top Click Plain",
+		},
+		{
+			name: "unordered list",
+			html: `<p>Items:</p><ul><li>One</li><li>Two</li></ul><p>Done</p>`,
+			text: "Items:\n\n* One\n* Two\n\nDone",
+		},
+		{
+			name: "ordered list with a nested list",
+			html: `<ol><li>First<ul><li>Detail</li></ul></li><li>Second</li></ol>`,
+			text: "1. First\n  * Detail\n2. Second",
+		},
+		{
+			name: "br and block elements",
+			html: `<div>Line one<br>Line two</div><div>Next block</div><blockquote>Quote</blockquote>`,
+			text: "Line one\nLine two\n\nNext block\n\nQuote",
+		},
+		{
+			name: "headings are underlined",
+			html: `<h1>Welcome</h1><p>Text</p><h3>Details</h3>`,
+			text: "Welcome\n=======\n\nText\n\nDetails\n-------",
+		},
+		{
+			name: "entities are decoded",
+			html: `<p>Tom &amp; Jerry &lt;3 &quot;cheese&quot; &mdash; 5&nbsp;&euro;</p>`,
+			text: "Tom & Jerry <3 \"cheese\" — 5 €",
+		},
+		{
+			name: "script, style, head and title are dropped",
+			html: `<html><head><title>Subject</title><style>p { color: red; }</style></head>` +
+				`<body><script>alert("hi")</script><p>Visible</p><style>.x{}</style></body></html>`,
+			text: "Visible",
+		},
+		{
+			name: "whitespace is collapsed outside pre",
+			html: "<p>  Hello\n\t   world  </p>",
+			text: "Hello world",
+		},
+		{
+			name: "pre keeps its lines",
+			html: "<pre>line one\n  indented</pre>",
+			text: "line one\n  indented",
+		},
+		{
+			name: "table rows are flattened",
+			html: `<table><tr><th>Item</th><th>Price</th></tr><tr><td>Cleaning</td><td>40 €</td></tr></table>`,
+			text: "Item | Price\nCleaning | 40 €",
+		},
+		{
+			name: "image alt text",
+			html: `<p><img src="logo.png" alt="HandyHub"> news</p>`,
+			text: "HandyHub news",
+		},
+		{
+			name: "empty body",
+			html: "",
+			text: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text, err := HTMLToText(tt.html)
+			if err != nil {
+				t.Fatalf("HTMLToText: %v", err)
+			}
+			if text != tt.text {
+				t.Errorf("HTMLToText =\n%q\nwant\n%q", text, tt.text)
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package delivery
+
+import (
+	"errors"
+	"fmt"
+	"handyhub-email-svc/internal/models"
+	"handyhub-email-svc/internal/storage"
+	"handyhub-email-svc/internal/suppression"
+
+	"github.com/sirupsen/logrus"
+)
+
+var log = logrus.StandardLogger()
+
+// Recorder applies delivery events from webhooks and bounce messages to the
+// matching email logs and suppresses bounced or complaining recipients.
+type Recorder struct {
+	emailStorage storage.EmailStorage
+	suppressions *suppression.Service
+}
+
+func NewRecorder(emailStorage storage.EmailStorage, suppressions *suppression.Service) *Recorder {
+	return &Recorder{emailStorage: emailStorage, suppressions: suppressions}
+}
+
+// Record applies every event to its email log and returns how many matched.
+// Events for unknown messages are skipped, a storage failure aborts so the
+// caller can retry.
+func (r *Recorder) Record(events []models.DeliveryEvent) (int, error) {
+	applied := 0
+	for _, event := range events {
+		r.suppress(event)
+
+		emailLog, err := r.findLog(event)
+		if errors.Is(err, storage.ErrNotFound) {
+			log.WithFields(logrus.Fields{
+				"provider":            event.Provider,
+				"type":                event.Type,
+				"provider_message_id": event.ProviderMessageID,
+				"message_id":          event.MessageID,
+			}).Warn("No email log for delivery event, skipping")
+			continue
+		}
+		if err != nil {
+			return applied, err
+		}
+
+		if err := r.emailStorage.AddEvent(emailLog.ID, event); err != nil {
+			return applied, fmt.Errorf("failed to add event to email log %s: %w", emailLog.ID.Hex(), err)
+		}
+		applied++
+	}
+	return applied, nil
+}
+
+// suppress never fails the event, a missed suppression is caught by the next
+// bounce of the same address.
+func (r *Recorder) suppress(event models.DeliveryEvent) {
+	if r.suppressions == nil {
+		return
+	}
+	if err := r.suppressions.Record(event); err != nil {
+		log.WithError(err).WithField("recipient", event.Recipient).Warn("Failed to suppress recipient")
+	}
+}
+
+func (r *Recorder) findLog(event models.DeliveryEvent) (*models.EmailLog, error) {
+	if event.ProviderMessageID != "" {
+		emailLog, err := r.emailStorage.FindByProviderMessageID(event.ProviderMessageID)
+		if !errors.Is(err, storage.ErrNotFound) {
+			return emailLog, err
+		}
+	}
+	if event.MessageID != "" {
+		return r.emailStorage.FindByMessageID(event.MessageID)
+	}
+	return nil, storage.ErrNotFound
+}
@@ -0,0 +1,17 @@
+package idempotency
+
+import (
+	"handyhub-email-svc/internal/config"
+	"handyhub-email-svc/internal/database"
+
+	"github.com/sirupsen/logrus"
+)
+
+func NewStore(cfg *config.Configuration, mongodb *database.MongoDB) (Store, error) {
+	if cfg.Storage.Type == "database" {
+		logrus.Info("Using Database Idempotency Store")
+		return NewMongoStore(mongodb, cfg.Idempotency.Collection)
+	}
+	logrus.Info("Using In-Memory Idempotency Store")
+	return NewMemoryStore(), nil
+}
@@ -0,0 +1,84 @@
+package idempotency
+
+import (
+	"handyhub-email-svc/internal/models"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps idempotency records in process memory, used with console
+// and file storage. It only guards against redeliveries while the process
+// lives, its content is lost on restart.
+type MemoryStore struct {
+	mu      sync.Mutex
+	records map[string]*models.IdempotencyRecord
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{records: make(map[string]*models.IdempotencyRecord)}
+}
+
+func (m *MemoryStore) Claim(key string, lockedUntil, expiresAt time.Time) (*models.IdempotencyRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	m.prune(now)
+	if record, ok := m.records[key]; ok {
+		found := *record
+		if record.State == models.IdempotencyCompleted {
+			return &found, ErrCompleted
+		}
+		if now.Before(record.LockedUntil) {
+			return &found, ErrInProgress
+		}
+	}
+
+	record := &models.IdempotencyRecord{
+		Key:         key,
+		State:       models.IdempotencyProcessing,
+		LockedUntil: lockedUntil,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+		ExpiresAt:   expiresAt,
+	}
+	m.records[key] = record
+	claimed := *record
+	return &claimed, nil
+}
+
+func (m *MemoryStore) Complete(key string, emailLog *models.EmailLog) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	record, ok := m.records[key]
+	if !ok {
+		return nil
+	}
+	record.State = models.IdempotencyCompleted
+	record.Log = nil
+	if emailLog != nil {
+		stored := *emailLog
+		record.Log = &stored
+	}
+	record.UpdatedAt = time.Now()
+	return nil
+}
+
+func (m *MemoryStore) Release(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if record, ok := m.records[key]; ok && record.State == models.IdempotencyProcessing {
+		delete(m.records, key)
+	}
+	return nil
+}
+
+func (m *MemoryStore) prune(now time.Time) {
+	for key, record := range m.records {
+		if !now.Before(record.ExpiresAt) {
+			delete(m.records, key)
+		}
+	}
+}
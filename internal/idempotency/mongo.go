@@ -0,0 +1,100 @@
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"handyhub-email-svc/internal/database"
+	"handyhub-email-svc/internal/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoStore keeps idempotency records in MongoDB, a TTL index removes
+// expired ones. Claims are atomic, so concurrent deliveries of a message on
+// several instances send it once.
+type MongoStore struct {
+	collection *mongo.Collection
+}
+
+func NewMongoStore(mongodb *database.MongoDB, collectionName string) (*MongoStore, error) {
+	collection := mongodb.Database.Collection(collectionName)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &MongoStore{collection: collection}, nil
+}
+
+// Claim upserts a record that is missing or whose lease ran out. When the
+// key is held or completed the upsert collides with the existing record,
+// which is then read to report why.
+func (m *MongoStore) Claim(key string, lockedUntil, expiresAt time.Time) (*models.IdempotencyRecord, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	var record models.IdempotencyRecord
+	err := m.collection.FindOneAndUpdate(ctx,
+		bson.M{"_id": key, "state": models.IdempotencyProcessing, "locked_until": bson.M{"$lte": now}},
+		bson.M{
+			"$set": bson.M{
+				"locked_until": lockedUntil,
+				"updated_at":   now,
+				"expires_at":   expiresAt,
+			},
+			"$setOnInsert": bson.M{"created_at": now},
+		},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&record)
+	if err == nil {
+		return &record, nil
+	}
+	if !mongo.IsDuplicateKeyError(err) {
+		return nil, err
+	}
+
+	err = m.collection.FindOne(ctx, bson.M{"_id": key}).Decode(&record)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		// released in between, the redelivery will claim it
+		return nil, ErrInProgress
+	}
+	if err != nil {
+		return nil, err
+	}
+	if record.State == models.IdempotencyCompleted {
+		return &record, ErrCompleted
+	}
+	return &record, ErrInProgress
+}
+
+func (m *MongoStore) Complete(key string, emailLog *models.EmailLog) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	update := bson.M{"$set": bson.M{"state": models.IdempotencyCompleted, "updated_at": time.Now()}}
+	if emailLog != nil {
+		update["$set"].(bson.M)["log"] = emailLog
+	} else {
+		update["$unset"] = bson.M{"log": ""}
+	}
+	_, err := m.collection.UpdateOne(ctx, bson.M{"_id": key}, update)
+	return err
+}
+
+func (m *MongoStore) Release(key string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := m.collection.DeleteOne(ctx, bson.M{"_id": key, "state": models.IdempotencyProcessing})
+	return err
+}
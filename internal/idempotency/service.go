@@ -0,0 +1,76 @@
+package idempotency
+
+import (
+	"errors"
+	"fmt"
+	"handyhub-email-svc/internal/config"
+	"handyhub-email-svc/internal/models"
+	"time"
+)
+
+const (
+	defaultLease     = 5 * time.Minute
+	defaultRetention = 7 * 24 * time.Hour
+)
+
+// Service guards the sending of a message by its idempotency key: a delivery
+// claims the key before sending, records the sent email right after the send
+// and completes the key once the log is stored.
+type Service struct {
+	store     Store
+	lease     time.Duration
+	retention time.Duration
+}
+
+func NewService(cfg config.IdempotencyConfig, store Store) *Service {
+	lease := time.Duration(cfg.Lease) * time.Second
+	if lease <= 0 {
+		lease = defaultLease
+	}
+	retention := time.Duration(cfg.Retention) * time.Hour
+	if retention <= 0 {
+		retention = defaultRetention
+	}
+	return &Service{store: store, lease: lease, retention: retention}
+}
+
+// Claim returns ErrCompleted with the record of an already processed key and
+// ErrInProgress while another delivery holds it.
+func (s *Service) Claim(key string) (*models.IdempotencyRecord, error) {
+	now := time.Now()
+	record, err := s.store.Claim(key, now.Add(s.lease), now.Add(s.retention))
+	if err != nil && !errors.Is(err, ErrCompleted) && !errors.Is(err, ErrInProgress) {
+		return nil, fmt.Errorf("failed to claim idempotency key %s: %w", key, err)
+	}
+	return record, err
+}
+
+// Sent records a sent email before its log is stored.
+func (s *Service) Sent(key string, emailLog *models.EmailLog) error {
+	if err := s.store.Complete(key, emailLog); err != nil {
+		return fmt.Errorf("failed to record sent idempotency key %s: %w", key, err)
+	}
+	return nil
+}
+
+// Complete marks the key processed once its logs are stored.
+func (s *Service) Complete(key string) error {
+	if err := s.store.Complete(key, nil); err != nil {
+		return fmt.Errorf("failed to complete idempotency key %s: %w", key, err)
+	}
+	return nil
+}
+
+// Lease is how long a delivery holds its key.
+func (s *Service) Lease() time.Duration {
+	return s.lease
+}
+
+// Release lets a failed delivery be processed again. Keys of sent emails are
+// kept, so a retry after a failed store does not send twice.
+func (s *Service) Release(key string) error {
+	if err := s.store.Release(key); err != nil {
+		return fmt.Errorf("failed to release idempotency key %s: %w", key, err)
+	}
+	return nil
+}
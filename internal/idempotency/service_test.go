@@ -0,0 +1,141 @@
+package idempotency
+
+import (
+	"errors"
+	"handyhub-email-svc/internal/config"
+	"handyhub-email-svc/internal/models"
+	"sync"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestClaim(t *testing.T) {
+	service := NewService(config.IdempotencyConfig{}, NewMemoryStore())
+
+	record, err := service.Claim("key")
+	if err != nil {
+		t.Fatalf("first Claim: %v", err)
+	}
+	if record.State != models.IdempotencyProcessing || !record.LockedUntil.After(time.Now().Add(defaultLease-time.Minute)) {
+		t.Fatalf("claimed %+v, want processing with the default lease", record)
+	}
+	if _, err := service.Claim("key"); !errors.Is(err, ErrInProgress) {
+		t.Fatalf("second Claim = %v, want ErrInProgress", err)
+	}
+	if _, err := service.Claim("other"); err != nil {
+		t.Fatalf("Claim of another key: %v", err)
+	}
+}
+
+func TestClaimConcurrently(t *testing.T) {
+	service := NewService(config.IdempotencyConfig{}, NewMemoryStore())
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	won := 0
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := service.Claim("key")
+			if err == nil {
+				mu.Lock()
+				won++
+				mu.Unlock()
+			} else if !errors.Is(err, ErrInProgress) {
+				t.Errorf("Claim = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if won != 1 {
+		t.Fatalf("%d deliveries claimed the key, want 1", won)
+	}
+}
+
+func TestClaimAfterLeaseExpiry(t *testing.T) {
+	store := NewMemoryStore()
+	now := time.Now()
+	if _, err := store.Claim("key", now.Add(-time.Second), now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	// the delivery holding the key crashed, its lease ran out
+	service := NewService(config.IdempotencyConfig{Lease: 60}, store)
+	record, err := service.Claim("key")
+	if err != nil {
+		t.Fatalf("Claim after the lease expired: %v", err)
+	}
+	if !record.LockedUntil.After(time.Now().Add(59 * time.Second)) {
+		t.Fatalf("LockedUntil = %v, want a new 60s lease", record.LockedUntil)
+	}
+	if _, err := service.Claim("key"); !errors.Is(err, ErrInProgress) {
+		t.Fatalf("Claim during the new lease = %v, want ErrInProgress", err)
+	}
+}
+
+func TestCompletedKey(t *testing.T) {
+	service := NewService(config.IdempotencyConfig{}, NewMemoryStore())
+	if _, err := service.Claim("key"); err != nil {
+		t.Fatal(err)
+	}
+
+	emailLog := &models.EmailLog{ID: primitive.NewObjectID(), Status: models.StatusSuccess}
+	if err := service.Sent("key", emailLog); err != nil {
+		t.Fatal(err)
+	}
+	emailLog.Status = models.StatusFailed // the store keeps its own copy
+
+	record, err := service.Claim("key")
+	if !errors.Is(err, ErrCompleted) {
+		t.Fatalf("Claim after Sent = %v, want ErrCompleted", err)
+	}
+	if record.Log == nil || record.Log.ID != emailLog.ID || record.Log.Status != models.StatusSuccess {
+		t.Fatalf("record log = %+v, want the sent email", record.Log)
+	}
+
+	// a completed key survives a release and no longer carries the log
+	if err := service.Release("key"); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.Complete("key"); err != nil {
+		t.Fatal(err)
+	}
+	record, err = service.Claim("key")
+	if !errors.Is(err, ErrCompleted) {
+		t.Fatalf("Claim after Complete = %v, want ErrCompleted", err)
+	}
+	if record.Log != nil {
+		t.Fatalf("record log = %+v after Complete, want nil", record.Log)
+	}
+}
+
+func TestReleaseAllowsRetry(t *testing.T) {
+	service := NewService(config.IdempotencyConfig{}, NewMemoryStore())
+	if _, err := service.Claim("key"); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.Release("key"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.Claim("key"); err != nil {
+		t.Fatalf("Claim after Release: %v", err)
+	}
+}
+
+func TestExpiredKeyIsForgotten(t *testing.T) {
+	store := NewMemoryStore()
+	now := time.Now()
+	if _, err := store.Claim("key", now.Add(time.Hour), now.Add(-time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Complete("key", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.Claim("key", now.Add(time.Minute), now.Add(time.Hour)); err != nil {
+		t.Fatalf("Claim after retention ran out: %v", err)
+	}
+}
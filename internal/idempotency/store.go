@@ -0,0 +1,25 @@
+package idempotency
+
+import (
+	"errors"
+	"handyhub-email-svc/internal/models"
+	"time"
+)
+
+var (
+	ErrCompleted  = errors.New("message was already processed")
+	ErrInProgress = errors.New("message is being processed by another delivery")
+)
+
+// Store persists idempotency records keyed by idempotency key. Records are
+// forgotten once they expire.
+type Store interface {
+	// Claim marks the key processing until lockedUntil. An existing record is
+	// returned with ErrCompleted, or ErrInProgress while its lease lasts.
+	Claim(key string, lockedUntil, expiresAt time.Time) (*models.IdempotencyRecord, error)
+	// Complete marks the key completed, keeping emailLog until it is stored
+	Complete(key string, emailLog *models.EmailLog) error
+	// Release drops a processing key so the message can be processed again,
+	// completed keys are kept.
+	Release(key string) error
+}
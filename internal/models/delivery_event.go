@@ -0,0 +1,100 @@
+package models
+
+import (
+	"sort"
+	"time"
+)
+
+const (
+	EventDelivered = "delivered"
+	EventDeferred  = "deferred"
+	EventBounced   = "bounced"
+	EventDropped   = "dropped"
+	EventComplaint = "complained"
+	EventOpened    = "opened"
+	EventClicked   = "clicked"
+)
+
+// DeliveryEvent is a provider delivery notification normalized across
+// webhook formats.
+type DeliveryEvent struct {
+	Type              string    `json:"type" bson:"type"`
+	Provider          string    `json:"provider" bson:"provider"`
+	Recipient         string    `json:"recipient,omitempty" bson:"recipient,omitempty"`
+	ProviderMessageID string    `json:"provider_message_id,omitempty" bson:"provider_message_id,omitempty"`
+	MessageID         string    `json:"message_id,omitempty" bson:"message_id,omitempty"`
+	Reason            string    `json:"reason,omitempty" bson:"reason,omitempty"`
+	URL               string    `json:"url,omitempty" bson:"url,omitempty"`
+	Timestamp         time.Time `json:"timestamp" bson:"timestamp"`
+}
+
+// statusRank orders the statuses an event may move an email to, a lower
+// ranked event never overrides a higher one (a late "deferred" must not hide
+// a bounce).
+var statusRank = map[string]int{
+	StatusSuccess:    0,
+	StatusDeferred:   1,
+	StatusDelivered:  2,
+	StatusDropped:    3,
+	StatusBounced:    3,
+	StatusComplained: 4,
+}
+
+// ApplyEvent records the event on the log and advances its status. Only the
+// first open is kept as an event, later ones just count, every image load of
+// the pixel is an open.
+func (l *EmailLog) ApplyEvent(event DeliveryEvent) {
+	if event.Type == EventOpened {
+		l.Opens++
+		if l.opened() {
+			return
+		}
+	}
+	l.Events = append(l.Events, event)
+
+	status, ok := event.Status()
+	if !ok {
+		return
+	}
+	current, known := statusRank[l.Status]
+	if !known || statusRank[status] >= current {
+		l.Status = status
+	}
+}
+
+func (l *EmailLog) opened() bool {
+	for _, event := range l.Events {
+		if event.Type == EventOpened {
+			return true
+		}
+	}
+	return false
+}
+
+// Status returns the email status the event moves to, events such as opens
+// and clicks do not change it.
+func (e DeliveryEvent) Status() (string, bool) {
+	status, ok := eventStatus[e.Type]
+	return status, ok
+}
+
+// OutrankingStatuses returns the statuses an email must not move from to
+// status, a storage update filters them out to advance the status atomically.
+func OutrankingStatuses(status string) []string {
+	var statuses []string
+	for other, rank := range statusRank {
+		if rank > statusRank[status] {
+			statuses = append(statuses, other)
+		}
+	}
+	sort.Strings(statuses)
+	return statuses
+}
+
+var eventStatus = map[string]string{
+	EventDelivered: StatusDelivered,
+	EventDeferred:  StatusDeferred,
+	EventBounced:   StatusBounced,
+	EventDropped:   StatusDropped,
+	EventComplaint: StatusComplained,
+}
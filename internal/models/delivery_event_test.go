@@ -0,0 +1,49 @@
+package models
+
+import "testing"
+
+func TestApplyEvent(t *testing.T) {
+	tests := []struct {
+		name       string
+		events     []string
+		wantStatus string
+		wantEvents int
+		wantOpens  int
+	}{
+		{name: "delivered", events: []string{EventDelivered}, wantStatus: StatusDelivered, wantEvents: 1},
+		{name: "late deferral keeps bounce", events: []string{EventBounced, EventDeferred}, wantStatus: StatusBounced, wantEvents: 2},
+		{name: "complaint after delivery", events: []string{EventDelivered, EventComplaint}, wantStatus: StatusComplained, wantEvents: 2},
+		{name: "opens are counted once", events: []string{EventOpened, EventClicked, EventOpened, EventOpened}, wantStatus: StatusSuccess, wantEvents: 2, wantOpens: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			emailLog := &EmailLog{Status: StatusSuccess}
+			for _, eventType := range tt.events {
+				emailLog.ApplyEvent(DeliveryEvent{Type: eventType})
+			}
+			if emailLog.Status != tt.wantStatus || len(emailLog.Events) != tt.wantEvents || emailLog.Opens != tt.wantOpens {
+				t.Fatalf("status %q, %d events, %d opens, want %q, %d, %d",
+					emailLog.Status, len(emailLog.Events), emailLog.Opens, tt.wantStatus, tt.wantEvents, tt.wantOpens)
+			}
+		})
+	}
+}
+
+func TestOutrankingStatuses(t *testing.T) {
+	tests := map[string][]string{
+		StatusDeferred:   {StatusBounced, StatusComplained, StatusDelivered, StatusDropped},
+		StatusBounced:    {StatusComplained},
+		StatusComplained: nil,
+	}
+	for status, want := range tests {
+		got := OutrankingStatuses(status)
+		if len(got) != len(want) {
+			t.Fatalf("OutrankingStatuses(%q) = %v, want %v", status, got, want)
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Fatalf("OutrankingStatuses(%q) = %v, want %v", status, got, want)
+			}
+		}
+	}
+}
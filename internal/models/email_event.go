@@ -0,0 +1,62 @@
+package models
+
+import "time"
+
+// Types of the email status events published for other services.
+const (
+	EmailEventSent       = "email.sent"
+	EmailEventFailed     = "email.failed"
+	EmailEventSuppressed = "email.suppressed"
+)
+
+// emailEventTypes maps final log statuses to events, retries publish none.
+var emailEventTypes = map[string]string{
+	StatusSuccess:      EmailEventSent,
+	StatusFailed:       EmailEventFailed,
+	StatusInvalid:      EmailEventFailed,
+	StatusRenderFailed: EmailEventFailed,
+	StatusSuppressed:   EmailEventSuppressed,
+	StatusUnsubscribed: EmailEventSuppressed,
+}
+
+// EmailEvent reports the outcome of a queue message. Metadata is copied
+// from the message so the producer can correlate it.
+type EmailEvent struct {
+	Type       string            `json:"type"`
+	LogID      string            `json:"log_id"`
+	Status     string            `json:"status"`
+	To         []string          `json:"to"`
+	Subject    string            `json:"subject,omitempty"`
+	Provider   string            `json:"provider,omitempty"`
+	Attempts   int               `json:"attempts,omitempty"`
+	MessageID  string            `json:"message_id,omitempty"`
+	Category   string            `json:"category,omitempty"`
+	TemplateID string            `json:"template_id,omitempty"`
+	Error      string            `json:"error,omitempty"`
+	Metadata   map[string]string `json:"metadata,omitempty"`
+	Timestamp  time.Time         `json:"timestamp"`
+}
+
+// NewEmailEvent returns the event for a stored log, nil if its status is
+// not final.
+func NewEmailEvent(emailLog *EmailLog, metadata map[string]string) *EmailEvent {
+	eventType, ok := emailEventTypes[emailLog.Status]
+	if !ok {
+		return nil
+	}
+	return &EmailEvent{
+		Type:       eventType,
+		LogID:      emailLog.ID.Hex(),
+		Status:     emailLog.Status,
+		To:         emailLog.To,
+		Subject:    emailLog.Subject,
+		Provider:   emailLog.Provider,
+		Attempts:   emailLog.Attempts,
+		MessageID:  emailLog.MessageID,
+		Category:   emailLog.Category,
+		TemplateID: emailLog.TemplateID,
+		Error:      emailLog.ErrorMsg,
+		Metadata:   metadata,
+		Timestamp:  time.Now(),
+	}
+}
@@ -6,6 +6,30 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+const (
+	StatusSuccess    = "success"
+	StatusFailed     = "failed"
+	StatusRetrying   = "retrying"
+	StatusInvalid    = "invalid"
+	StatusDelivered  = "delivered"
+	StatusDeferred   = "deferred"
+	StatusBounced    = "bounced"
+	StatusDropped    = "dropped"
+	StatusComplained = "complained"
+	StatusSuppressed = "suppressed"
+	// StatusUnsubscribed marks recipients who opted out of the email category
+	StatusUnsubscribed = "unsubscribed"
+	// StatusRenderFailed marks emails whose template is missing or broken
+	StatusRenderFailed = "render_failed"
+)
+
+// sentStatuses are the statuses of emails accepted by the provider.
+var sentStatuses = []string{StatusSuccess, StatusDeferred, StatusDelivered}
+
+func SentStatuses() []string {
+	return append([]string(nil), sentStatuses...)
+}
+
 type EmailLog struct {
 	ID       primitive.ObjectID `json:"id" bson:"_id,omitempty"`
 	To       []string           `json:"to" bson:"to"`
@@ -15,14 +39,66 @@ type EmailLog struct {
 	Attempts int                `json:"attempts" bson:"attempts"`
 	SentAt   time.Time          `json:"sent_at" bson:"sent_at"`
 	ErrorMsg string             `json:"error_msg,omitempty" bson:"error_msg,omitempty"`
+	// TrackingID is the ID returned when the message was queued over HTTP
+	TrackingID string `json:"tracking_id,omitempty" bson:"tracking_id,omitempty"`
+	// MessageID is the RFC 5322 Message-ID header including angle brackets
+	MessageID string `json:"message_id,omitempty" bson:"message_id,omitempty"`
+	ThreadKey string `json:"thread_key,omitempty" bson:"thread_key,omitempty"`
+	Category  string `json:"category,omitempty" bson:"category,omitempty"`
+	// TemplateID is the server-side template the email was rendered from
+	TemplateID string `json:"template_id,omitempty" bson:"template_id,omitempty"`
+	// TemplateVersion is the published version rendered, 0 for directory templates
+	TemplateVersion int `json:"template_version,omitempty" bson:"template_version,omitempty"`
+	// Locale is the template variant used, empty for the base template
+	Locale string `json:"locale,omitempty" bson:"locale,omitempty"`
+	// ProviderMessageID is the ID the provider reports in delivery webhooks
+	ProviderMessageID string          `json:"provider_message_id,omitempty" bson:"provider_message_id,omitempty"`
+	Events            []DeliveryEvent `json:"events,omitempty" bson:"events,omitempty"`
+	// Opens counts every open, Events only holds the first one
+	Opens int `json:"opens,omitempty" bson:"opens,omitempty"`
+}
+
+func (l *EmailLog) WasSent() bool {
+	for _, status := range sentStatuses {
+		if l.Status == status {
+			return true
+		}
+	}
+	return false
 }
 
+// EmailMessage is the email to send. Addresses in To and From may carry a
+// display name, e.g. "Иван Петров <ivan@example.com>".
 type EmailMessage struct {
 	To       []string `json:"to"`
 	Subject  string   `json:"subject"`
 	BodyHTML string   `json:"body_html"`
 	BodyText string   `json:"body_text"`
-	From     string   `json:"from"`
+	// BodyMarkdown is converted to the HTML and text bodies, replacing them
+	BodyMarkdown string `json:"body_markdown,omitempty"`
+	From         string `json:"from"`
+	// Provider selects a named provider instance, empty means the default one
+	Provider string `json:"provider,omitempty"`
+	// InlineCSS overrides content.inline-css for this message
+	InlineCSS *bool `json:"inline_css,omitempty"`
+	// Headers are added to the message as is
+	Headers map[string]string `json:"headers,omitempty"`
+	// DisableTracking opts sensitive emails out of open and click tracking
+	DisableTracking bool `json:"disable_tracking,omitempty"`
+	// Sign and Encrypt request S/MIME, supported by SMTP based providers only
+	Sign    bool `json:"sign,omitempty"`
+	Encrypt bool `json:"encrypt,omitempty"`
+	// MessageID is generated by the service when empty
+	MessageID  string   `json:"message_id,omitempty"`
+	InReplyTo  string   `json:"in_reply_to,omitempty"`
+	References []string `json:"references,omitempty"`
+	// ThreadKey groups emails of one conversation, e.g. "booking:42". The
+	// service threads the email with earlier ones sent under the same key.
+	ThreadKey string `json:"thread_key,omitempty"`
+	// Category, e.g. "marketing", lets recipients unsubscribe from a kind of
+	// email. {{unsubscribe_url}} and {{preferences_url}} in the bodies are
+	// replaced with the recipient's links.
+	Category string `json:"category,omitempty"`
 }
 
 type QueueMessage struct {
@@ -30,4 +106,20 @@ type QueueMessage struct {
 	Priority  string            `json:"priority"`
 	Metadata  map[string]string `json:"metadata,omitempty"`
 	Timestamp time.Time         `json:"timestamp" bson:"timestamp"`
+	// TemplateID renders the email from a server-side template with
+	// TemplateData. The bodies of Email are replaced, a subject set in Email
+	// wins over the template one.
+	TemplateID   string         `json:"template_id,omitempty"`
+	TemplateData map[string]any `json:"template_data,omitempty"`
+	// Locale of the recipient, e.g. "ru-RU", selects the template variant
+	Locale string `json:"locale,omitempty"`
+	// TrackingID is copied to every log of the message, assigned by the send API
+	TrackingID string `json:"tracking_id,omitempty"`
+	// IdempotencyKey makes redeliveries of a sent message no-ops, the AMQP
+	// message ID is used when empty
+	IdempotencyKey string `json:"idempotency_key,omitempty"`
+	// Attempt is the delivery attempt, counted by the consumer
+	Attempt int `json:"-"`
+	// LogID is the log stored by earlier attempts, carried by the consumer
+	LogID string `json:"-"`
 }
@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+const (
+	IdempotencyProcessing = "processing"
+	IdempotencyCompleted  = "completed"
+)
+
+// IdempotencyRecord tracks a queue message by its idempotency key. A
+// processing record is held by one delivery until LockedUntil, a completed
+// one makes later deliveries of the message no-ops.
+type IdempotencyRecord struct {
+	Key         string    `json:"key" bson:"_id"`
+	State       string    `json:"state" bson:"state"`
+	LockedUntil time.Time `json:"locked_until" bson:"locked_until"`
+	// Log is the log of a sent email until it is stored, so a redelivery
+	// after a failed store can store it instead of sending again
+	Log       *EmailLog `json:"log,omitempty" bson:"log,omitempty"`
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" bson:"updated_at"`
+	ExpiresAt time.Time `json:"expires_at" bson:"expires_at"`
+}
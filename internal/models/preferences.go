@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// Preferences are the email categories a recipient unsubscribed from.
+type Preferences struct {
+	Address      string    `json:"address" bson:"_id"`
+	Unsubscribed []string  `json:"unsubscribed" bson:"unsubscribed"`
+	UpdatedAt    time.Time `json:"updated_at" bson:"updated_at"`
+}
+
+func (p *Preferences) IsUnsubscribed(category string) bool {
+	for _, unsubscribed := range p.Unsubscribed {
+		if unsubscribed == category {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,46 @@
+package models
+
+import "time"
+
+const (
+	SuppressionBounce      = "bounce"
+	SuppressionComplaint   = "complaint"
+	SuppressionUnsubscribe = "unsubscribe"
+	SuppressionManual      = "manual"
+)
+
+// Suppression blocks sending to an address until it expires. A nil
+// ExpiresAt never expires.
+type Suppression struct {
+	Address   string     `json:"address" bson:"_id"`
+	Reason    string     `json:"reason" bson:"reason"`
+	Note      string     `json:"note,omitempty" bson:"note,omitempty"`
+	CreatedAt time.Time  `json:"created_at" bson:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty" bson:"expires_at,omitempty"`
+}
+
+func (s *Suppression) Expired(now time.Time) bool {
+	return s.ExpiresAt != nil && !now.Before(*s.ExpiresAt)
+}
+
+// suppressionRank orders suppression reasons by strength, a bounce never
+// replaces a complaint or a suppression added by hand.
+var suppressionRank = map[string]int{
+	SuppressionBounce:      0,
+	SuppressionUnsubscribe: 1,
+	SuppressionComplaint:   2,
+	SuppressionManual:      2,
+}
+
+// SuppressionOutranks reports whether reason is stronger than other.
+func SuppressionOutranks(reason, other string) bool {
+	return suppressionRank[reason] > suppressionRank[other]
+}
+
+func IsSuppressionReason(reason string) bool {
+	switch reason {
+	case SuppressionBounce, SuppressionComplaint, SuppressionUnsubscribe, SuppressionManual:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,62 @@
+package models
+
+import "time"
+
+// EmailTemplate is a server-side template. Subject and Text use text/template,
+// HTML uses html/template, all rendered with the data of the queue message.
+type EmailTemplate struct {
+	ID string `json:"id" bson:"template_id"`
+	// Version is assigned by the template store, 0 for directory templates
+	Version int    `json:"version,omitempty" bson:"version"`
+	Subject string `json:"subject" bson:"subject"`
+	HTML    string `json:"html,omitempty" bson:"html,omitempty"`
+	Text    string `json:"text,omitempty" bson:"text,omitempty"`
+	// Locales holds translated variants keyed by locale tag, e.g. "ru" or
+	// "ru-RU". A variant replaces subject and bodies as a whole.
+	Locales map[string]LocalizedTemplate `json:"locales,omitempty" bson:"locales,omitempty"`
+	// Layout names the layout wrapping the HTML and text bodies, which fill
+	// its "content" block
+	Layout string `json:"layout,omitempty" bson:"layout,omitempty"`
+	// InlineCSS overrides content.inline-css for emails of this template
+	InlineCSS *bool     `json:"inline_css,omitempty" bson:"inline_css,omitempty"`
+	UpdatedAt time.Time `json:"updated_at" bson:"updated_at"`
+}
+
+// TemplatePartial is a layout or a named partial shared by templates. Its
+// Locales variants are picked with the locale of the including template.
+type TemplatePartial struct {
+	Name      string                       `json:"name" bson:"name"`
+	Kind      string                       `json:"kind" bson:"kind"`
+	HTML      string                       `json:"html,omitempty" bson:"html,omitempty"`
+	Text      string                       `json:"text,omitempty" bson:"text,omitempty"`
+	Locales   map[string]LocalizedTemplate `json:"locales,omitempty" bson:"locales,omitempty"`
+	UpdatedAt time.Time                    `json:"updated_at" bson:"updated_at"`
+}
+
+type LocalizedTemplate struct {
+	Subject string `json:"subject" bson:"subject"`
+	HTML    string `json:"html,omitempty" bson:"html,omitempty"`
+	Text    string `json:"text,omitempty" bson:"text,omitempty"`
+}
+
+// TemplateRecord is a managed template with all of its versions. Versions
+// are immutable drafts until one is published, PublishHistory lists the
+// published versions in order so a publish can be rolled back.
+type TemplateRecord struct {
+	ID               string          `json:"id" bson:"_id"`
+	LatestVersion    int             `json:"latest_version" bson:"latest_version"`
+	PublishedVersion int             `json:"published_version,omitempty" bson:"published_version"`
+	PublishHistory   []int           `json:"publish_history,omitempty" bson:"publish_history"`
+	Versions         []EmailTemplate `json:"versions,omitempty" bson:"versions"`
+	CreatedAt        time.Time       `json:"created_at" bson:"created_at"`
+	UpdatedAt        time.Time       `json:"updated_at" bson:"updated_at"`
+}
+
+func (r *TemplateRecord) Version(version int) *EmailTemplate {
+	for i := range r.Versions {
+		if r.Versions[i].Version == version {
+			return &r.Versions[i]
+		}
+	}
+	return nil
+}
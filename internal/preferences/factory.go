@@ -0,0 +1,17 @@
+package preferences
+
+import (
+	"handyhub-email-svc/internal/config"
+	"handyhub-email-svc/internal/database"
+
+	"github.com/sirupsen/logrus"
+)
+
+func NewStore(cfg *config.Configuration, mongodb *database.MongoDB) Store {
+	if cfg.Storage.Type == "database" {
+		logrus.Info("Using Database Preferences Store")
+		return NewMongoStore(mongodb, cfg.Preferences.Collection)
+	}
+	logrus.Info("Using In-Memory Preferences Store")
+	return NewMemoryStore()
+}
@@ -0,0 +1,40 @@
+package preferences
+
+import (
+	"handyhub-email-svc/internal/models"
+	"sync"
+)
+
+// MemoryStore keeps preferences in process memory, used with console and
+// file storage. Its content is lost on restart.
+type MemoryStore struct {
+	mu          sync.RWMutex
+	preferences map[string]*models.Preferences
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{preferences: make(map[string]*models.Preferences)}
+}
+
+func (m *MemoryStore) Get(address string) (*models.Preferences, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	preferences, ok := m.preferences[address]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	found := *preferences
+	found.Unsubscribed = append([]string(nil), preferences.Unsubscribed...)
+	return &found, nil
+}
+
+func (m *MemoryStore) Put(preferences *models.Preferences) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored := *preferences
+	stored.Unsubscribed = append([]string(nil), preferences.Unsubscribed...)
+	m.preferences[preferences.Address] = &stored
+	return nil
+}
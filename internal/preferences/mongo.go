@@ -0,0 +1,44 @@
+package preferences
+
+import (
+	"context"
+	"errors"
+	"handyhub-email-svc/internal/database"
+	"handyhub-email-svc/internal/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type MongoStore struct {
+	collection *mongo.Collection
+}
+
+func NewMongoStore(mongodb *database.MongoDB, collectionName string) *MongoStore {
+	return &MongoStore{collection: mongodb.Database.Collection(collectionName)}
+}
+
+func (m *MongoStore) Get(address string) (*models.Preferences, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var preferences models.Preferences
+	err := m.collection.FindOne(ctx, bson.M{"_id": address}).Decode(&preferences)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &preferences, nil
+}
+
+func (m *MongoStore) Put(preferences *models.Preferences) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := m.collection.ReplaceOne(ctx, bson.M{"_id": preferences.Address}, preferences, options.Replace().SetUpsert(true))
+	return err
+}
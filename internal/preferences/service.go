@@ -0,0 +1,253 @@
+package preferences
+
+import (
+	"errors"
+	"fmt"
+	"handyhub-email-svc/internal/config"
+	"handyhub-email-svc/internal/models"
+	"handyhub-email-svc/internal/signing"
+	"handyhub-email-svc/internal/smtp"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+var log = logrus.StandardLogger()
+
+var (
+	ErrInvalidToken    = signing.ErrInvalidToken
+	ErrUnknownCategory = errors.New("unknown category")
+	ErrRequired        = errors.New("category cannot be unsubscribed")
+)
+
+type claims struct {
+	Address  string `json:"a"`
+	Category string `json:"c,omitempty"`
+}
+
+// CategoryState is a category as shown to a recipient.
+type CategoryState struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Required    bool   `json:"required"`
+	Subscribed  bool   `json:"subscribed"`
+}
+
+// Service manages the categories recipients opted out of and issues the
+// signed links of the hosted unsubscribe and preference pages.
+type Service struct {
+	store      Store
+	signer     *signing.Signer
+	baseURL    string
+	categories []config.CategoryConfig
+}
+
+func NewService(cfg config.PreferencesConfig, store Store) (*Service, error) {
+	signer, err := signing.NewSigner(cfg.Secret)
+	if err != nil {
+		return nil, fmt.Errorf("preferences: %w", err)
+	}
+	base, err := url.Parse(cfg.BaseURL)
+	if err != nil || (base.Scheme != "http" && base.Scheme != "https") || base.Host == "" {
+		return nil, fmt.Errorf("preferences: invalid base-url %q", cfg.BaseURL)
+	}
+
+	seen := make(map[string]bool, len(cfg.Categories))
+	for _, category := range cfg.Categories {
+		if category.Name == "" || seen[category.Name] {
+			return nil, fmt.Errorf("preferences: empty or duplicate category %q", category.Name)
+		}
+		seen[category.Name] = true
+	}
+
+	return &Service{
+		store:      store,
+		signer:     signer,
+		baseURL:    strings.TrimRight(cfg.BaseURL, "/"),
+		categories: cfg.Categories,
+	}, nil
+}
+
+// UnsubscribeURL returns the one-click unsubscribe link of a recipient for a
+// category.
+func (s *Service) UnsubscribeURL(address, category string) (string, error) {
+	return s.url("unsubscribe", address, category)
+}
+
+// PreferencesURL returns the preference center link of a recipient.
+func (s *Service) PreferencesURL(address string) (string, error) {
+	return s.url("preferences", address, "")
+}
+
+func (s *Service) url(page, address, category string) (string, error) {
+	normalized, err := normalize(address)
+	if err != nil {
+		return "", err
+	}
+	token, err := s.signer.Sign(claims{Address: normalized, Category: category})
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s/%s/%s", s.baseURL, page, token), nil
+}
+
+// Resolve returns the address and the category, if any, a token was issued for.
+func (s *Service) Resolve(token string) (string, string, error) {
+	var c claims
+	if err := s.signer.Verify(token, &c); err != nil {
+		return "", "", err
+	}
+	if c.Address == "" {
+		return "", "", ErrInvalidToken
+	}
+	return c.Address, c.Category, nil
+}
+
+// Category returns the configured category with the given name.
+func (s *Service) Category(name string) (config.CategoryConfig, bool) {
+	for _, category := range s.categories {
+		if category.Name == name {
+			return category, true
+		}
+	}
+	return config.CategoryConfig{}, false
+}
+
+// States returns every configured category with the subscription state of
+// the recipient.
+func (s *Service) States(address string) ([]CategoryState, error) {
+	preferences, err := s.get(address)
+	if err != nil {
+		return nil, err
+	}
+
+	states := make([]CategoryState, 0, len(s.categories))
+	for _, category := range s.categories {
+		states = append(states, CategoryState{
+			Name:        category.Name,
+			Description: category.Description,
+			Required:    category.Required,
+			Subscribed:  category.Required || !preferences.IsUnsubscribed(category.Name),
+		})
+	}
+	return states, nil
+}
+
+// Unsubscribe opts the recipient out of a single category. Categories missing
+// from the config are accepted, producers may send them before they are listed.
+func (s *Service) Unsubscribe(address, category string) error {
+	if configured, ok := s.Category(category); ok && configured.Required {
+		return fmt.Errorf("%w: %s", ErrRequired, category)
+	}
+	return s.apply(address, map[string]bool{category: false})
+}
+
+// Update applies subscription changes keyed by category name. Required
+// categories can only be subscribed.
+func (s *Service) Update(address string, subscribed map[string]bool) error {
+	for name, subscribe := range subscribed {
+		category, ok := s.Category(name)
+		if !ok {
+			return fmt.Errorf("%w: %s", ErrUnknownCategory, name)
+		}
+		if category.Required && !subscribe {
+			return fmt.Errorf("%w: %s", ErrRequired, name)
+		}
+	}
+	return s.apply(address, subscribed)
+}
+
+func (s *Service) apply(address string, subscribed map[string]bool) error {
+	preferences, err := s.get(address)
+	if err != nil {
+		return err
+	}
+
+	unsubscribed := make(map[string]bool, len(preferences.Unsubscribed)+len(subscribed))
+	for _, name := range preferences.Unsubscribed {
+		unsubscribed[name] = true
+	}
+	for name, subscribe := range subscribed {
+		unsubscribed[name] = !subscribe
+	}
+
+	preferences.Unsubscribed = preferences.Unsubscribed[:0]
+	for name, off := range unsubscribed {
+		if off {
+			preferences.Unsubscribed = append(preferences.Unsubscribed, name)
+		}
+	}
+	sort.Strings(preferences.Unsubscribed)
+	preferences.UpdatedAt = time.Now()
+
+	if err := s.store.Put(preferences); err != nil {
+		return fmt.Errorf("failed to store preferences of %s: %w", preferences.Address, err)
+	}
+
+	log.WithFields(logrus.Fields{
+		"address":      preferences.Address,
+		"unsubscribed": preferences.Unsubscribed,
+	}).Info("Email preferences updated")
+	return nil
+}
+
+// Filter splits recipients into those subscribed to the category and those
+// who opted out. Messages without a category and required categories are
+// always delivered.
+func (s *Service) Filter(recipients []string, category string) ([]string, []string, error) {
+	if category == "" {
+		return recipients, nil, nil
+	}
+	if configured, ok := s.Category(category); ok && configured.Required {
+		return recipients, nil, nil
+	}
+
+	allowed := make([]string, 0, len(recipients))
+	var optedOut []string
+	for _, recipient := range recipients {
+		address, err := normalize(recipient)
+		if err != nil {
+			allowed = append(allowed, recipient)
+			continue
+		}
+
+		preferences, err := s.store.Get(address)
+		if errors.Is(err, ErrNotFound) {
+			allowed = append(allowed, recipient)
+			continue
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to load preferences of %s: %w", address, err)
+		}
+		if preferences.IsUnsubscribed(category) {
+			optedOut = append(optedOut, address)
+			continue
+		}
+		allowed = append(allowed, recipient)
+	}
+	return allowed, optedOut, nil
+}
+
+// get returns the stored preferences or empty ones for a new recipient.
+func (s *Service) get(address string) (*models.Preferences, error) {
+	normalized, err := normalize(address)
+	if err != nil {
+		return nil, err
+	}
+	preferences, err := s.store.Get(normalized)
+	if errors.Is(err, ErrNotFound) {
+		return &models.Preferences{Address: normalized}, nil
+	}
+	return preferences, err
+}
+
+func normalize(address string) (string, error) {
+	parsed, err := smtp.ParseAddress(address)
+	if err != nil {
+		return "", err
+	}
+	return strings.ToLower(parsed.Address), nil
+}
@@ -0,0 +1,14 @@
+package preferences
+
+import (
+	"errors"
+	"handyhub-email-svc/internal/models"
+)
+
+var ErrNotFound = errors.New("preferences not found")
+
+// Store persists recipient preferences keyed by normalized address.
+type Store interface {
+	Get(address string) (*models.Preferences, error)
+	Put(preferences *models.Preferences) error
+}
@@ -0,0 +1,276 @@
+package queue
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"handyhub-email-svc/internal/models"
+	"time"
+
+	"github.com/streadway/amqp"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Headers added to dead letters.
+const (
+	FailureStageHeader  = "x-failure-stage"
+	FailureReasonHeader = "x-failure-reason"
+	FailedAtHeader      = "x-failed-at"
+)
+
+// Stages a message can fail in.
+const (
+	StageParse   = "parse"
+	StageProcess = "process"
+)
+
+var ErrDeadLetterNotFound = errors.New("dead letter not found")
+
+// DeadLetter is a message parked in the dead-letter queue.
+type DeadLetter struct {
+	ID       string     `json:"id"`
+	Stage    string     `json:"stage,omitempty"`
+	Reason   string     `json:"reason,omitempty"`
+	Attempts int        `json:"attempts"`
+	FailedAt *time.Time `json:"failed_at,omitempty"`
+	Headers  amqp.Table `json:"headers,omitempty"`
+	// Message is the parsed body, Body the raw one when it is not valid
+	Message *models.QueueMessage `json:"message,omitempty"`
+	Body    string               `json:"body,omitempty"`
+}
+
+// queueArgs enables priorities on the email queue. Dead-lettering is not a
+// queue argument, DeadLetter publishes the copies itself and a broker policy
+// can add a dead-letter exchange without redeclaring the queue.
+func (r *RabbitMQ) queueArgs() amqp.Table {
+	args := amqp.Table{}
+	if r.cfg.MaxPriority > 0 {
+		args["x-max-priority"] = int32(r.cfg.MaxPriority)
+	}
+	return args
+}
+
+func (r *RabbitMQ) setupDeadLetterQueue(channel *amqp.Channel) error {
+	if !r.cfg.DeadLetter.Enabled {
+		return nil
+	}
+	dl := r.cfg.DeadLetter
+	if err := channel.ExchangeDeclare(dl.Exchange, amqp.ExchangeDirect, r.cfg.Durable, false, false, r.cfg.NoWait, nil); err != nil {
+		return fmt.Errorf("failed to declare dead-letter exchange: %w", err)
+	}
+	if _, err := channel.QueueDeclare(dl.Queue, r.cfg.Durable, false, false, r.cfg.NoWait, nil); err != nil {
+		return fmt.Errorf("failed to declare dead-letter queue: %w", err)
+	}
+	if err := channel.QueueBind(dl.Queue, dl.Queue, dl.Exchange, r.cfg.NoWait, nil); err != nil {
+		return fmt.Errorf("failed to bind dead-letter queue: %w", err)
+	}
+	return nil
+}
+
+// DeadLetterEnabled reports whether failed messages are kept.
+func (r *RabbitMQ) DeadLetterEnabled() bool {
+	return r.cfg.DeadLetter.Enabled
+}
+
+// DeadLetter publishes a copy of a failed message to the dead-letter queue,
+// annotated with where and why it failed. The caller acknowledges the
+// original delivery once the broker confirmed the copy.
+func (r *RabbitMQ) DeadLetter(delivery amqp.Delivery, stage string, reason error) error {
+	headers := amqp.Table{}
+	for key, value := range delivery.Headers {
+		headers[key] = value
+	}
+	headers[FailureStageHeader] = stage
+	headers[FailureReasonHeader] = reason.Error()
+	headers[FailedAtHeader] = time.Now().UTC().Format(time.RFC3339)
+
+	messageID := delivery.MessageId
+	if messageID == "" {
+		messageID = primitive.NewObjectID().Hex()
+	}
+	err := r.Publish(r.cfg.DeadLetter.Exchange, r.cfg.DeadLetter.Queue, amqp.Publishing{
+		Headers:      headers,
+		ContentType:  delivery.ContentType,
+		DeliveryMode: amqp.Persistent,
+		Priority:     delivery.Priority,
+		MessageId:    messageID,
+		Timestamp:    delivery.Timestamp,
+		Body:         delivery.Body,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to publish dead letter: %w", err)
+	}
+	log.WithField("id", messageID).WithField("stage", stage).Warn("Message moved to dead-letter queue")
+	return nil
+}
+
+// ListDeadLetters returns up to limit dead letters, oldest first. Messages
+// are fetched without acknowledgement and return to the queue when the
+// browsing channel closes.
+func (r *RabbitMQ) ListDeadLetters(limit int) ([]*DeadLetter, error) {
+	letters := []*DeadLetter{}
+	err := r.browseDeadLetters(func(_ *amqp.Channel, delivery amqp.Delivery) (bool, error) {
+		letters = append(letters, newDeadLetter(delivery))
+		return len(letters) >= limit, nil
+	})
+	return letters, err
+}
+
+func (r *RabbitMQ) GetDeadLetter(id string) (*DeadLetter, error) {
+	var letter *DeadLetter
+	err := r.browseDeadLetters(func(_ *amqp.Channel, delivery amqp.Delivery) (bool, error) {
+		if deadLetterID(delivery) != id {
+			return false, nil
+		}
+		letter = newDeadLetter(delivery)
+		return true, nil
+	})
+	if err == nil && letter == nil {
+		err = ErrDeadLetterNotFound
+	}
+	return letter, err
+}
+
+// ReplayDeadLetter publishes a dead letter back to the email queue, with
+// body replacing the original one when set, and removes it from the
+// dead-letter queue. The attempt count starts over with a new log.
+func (r *RabbitMQ) ReplayDeadLetter(id string, body []byte) error {
+	found := false
+	err := r.browseDeadLetters(func(channel *amqp.Channel, delivery amqp.Delivery) (bool, error) {
+		if deadLetterID(delivery) != id {
+			return false, nil
+		}
+		found = true
+
+		headers := amqp.Table{}
+		for key, value := range delivery.Headers {
+			switch key {
+			case AttemptHeader, LogIDHeader, FailureStageHeader, FailureReasonHeader, FailedAtHeader, "x-death",
+				"x-first-death-exchange", "x-first-death-queue", "x-first-death-reason":
+				continue
+			}
+			headers[key] = value
+		}
+		// an edited body brings its own priority
+		priority := r.republishPriority(amqp.Delivery{}, body)
+		if body == nil {
+			body = delivery.Body
+			priority = r.republishPriority(delivery, body)
+		}
+		// the dead letter is only removed once the broker confirmed the copy
+		err := r.Publish(r.cfg.Exchange, r.cfg.RoutingKey, amqp.Publishing{
+			Headers:      headers,
+			ContentType:  delivery.ContentType,
+			DeliveryMode: amqp.Persistent,
+			Priority:     priority,
+			MessageId:    delivery.MessageId,
+			Timestamp:    time.Now(),
+			Body:         body,
+		})
+		if err != nil {
+			return true, fmt.Errorf("failed to replay dead letter: %w", err)
+		}
+		return true, delivery.Ack(false)
+	})
+	if err == nil && !found {
+		err = ErrDeadLetterNotFound
+	}
+	return err
+}
+
+// PurgeDeadLetters drops all dead letters and returns how many there were.
+func (r *RabbitMQ) PurgeDeadLetters() (int, error) {
+	r.deadLetters.Lock()
+	defer r.deadLetters.Unlock()
+
+	channel, err := r.currentChannel()
+	if err != nil {
+		return 0, err
+	}
+	count, err := channel.QueuePurge(r.cfg.DeadLetter.Queue, false)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge dead letters: %w", err)
+	}
+	return count, nil
+}
+
+// browseDeadLetters passes dead letters to visit until it returns true or
+// the queue is exhausted. A dedicated channel is used so closing it returns
+// every unacknowledged message to the queue in its original order.
+func (r *RabbitMQ) browseDeadLetters(visit func(*amqp.Channel, amqp.Delivery) (bool, error)) error {
+	r.deadLetters.Lock()
+	defer r.deadLetters.Unlock()
+
+	conn, err := r.currentConnection()
+	if err != nil {
+		return err
+	}
+	channel, err := conn.Channel()
+	if err != nil {
+		return fmt.Errorf("failed to open a channel: %w", err)
+	}
+	defer channel.Close()
+
+	for {
+		delivery, ok, err := channel.Get(r.cfg.DeadLetter.Queue, false)
+		if err != nil {
+			return fmt.Errorf("failed to read dead letters: %w", err)
+		}
+		if !ok {
+			return nil
+		}
+		if done, err := visit(channel, delivery); done || err != nil {
+			return err
+		}
+	}
+}
+
+// deadLetterID identifies a dead letter by its message ID, or by a hash of
+// the body for messages dead-lettered by the broker without one.
+func deadLetterID(delivery amqp.Delivery) string {
+	if delivery.MessageId != "" {
+		return delivery.MessageId
+	}
+	sum := sha256.Sum256(delivery.Body)
+	return hex.EncodeToString(sum[:12])
+}
+
+func newDeadLetter(delivery amqp.Delivery) *DeadLetter {
+	letter := &DeadLetter{
+		ID:       deadLetterID(delivery),
+		Attempts: Attempt(delivery),
+		Headers:  delivery.Headers,
+	}
+	letter.Stage, _ = delivery.Headers[FailureStageHeader].(string)
+	letter.Reason, _ = delivery.Headers[FailureReasonHeader].(string)
+	if letter.Reason == "" {
+		letter.Reason = brokerDeathReason(delivery.Headers)
+	}
+	if failedAt, ok := delivery.Headers[FailedAtHeader].(string); ok {
+		if t, err := time.Parse(time.RFC3339, failedAt); err == nil {
+			letter.FailedAt = &t
+		}
+	}
+
+	var message models.QueueMessage
+	if err := json.Unmarshal(delivery.Body, &message); err == nil {
+		letter.Message = &message
+	} else {
+		letter.Body = string(delivery.Body)
+	}
+	return letter
+}
+
+// brokerDeathReason reads the reason of messages dead-lettered by the
+// broker, e.g. "rejected".
+func brokerDeathReason(headers amqp.Table) string {
+	deaths, _ := headers["x-death"].([]interface{})
+	if len(deaths) == 0 {
+		return ""
+	}
+	death, _ := deaths[0].(amqp.Table)
+	reason, _ := death["reason"].(string)
+	return reason
+}
@@ -0,0 +1,71 @@
+package queue
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"handyhub-email-svc/internal/models"
+	"handyhub-email-svc/internal/smtp"
+	"time"
+
+	"github.com/streadway/amqp"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ValidateMessage checks a queue message before it is published, so a
+// producer learns about a broken payload instead of it ending up as a
+// failed log or a dead letter.
+func ValidateMessage(message *models.QueueMessage) error {
+	if len(message.Email.To) == 0 {
+		return errors.New("email.to is required")
+	}
+	for _, to := range message.Email.To {
+		if _, err := smtp.ParseAddress(to); err != nil {
+			return fmt.Errorf("email.to: %w", err)
+		}
+	}
+	if message.TemplateID == "" {
+		if message.Email.Subject == "" {
+			return errors.New("email.subject or template_id is required")
+		}
+		if message.Email.BodyHTML == "" && message.Email.BodyText == "" && message.Email.BodyMarkdown == "" {
+			return errors.New("an email body or template_id is required")
+		}
+	}
+	if message.Email.From != "" {
+		if _, err := smtp.ParseAddress(message.Email.From); err != nil {
+			return fmt.Errorf("email.from: %w", err)
+		}
+	}
+	if message.Priority != "" && !IsPriority(message.Priority) {
+		return fmt.Errorf("unknown priority %q", message.Priority)
+	}
+	return nil
+}
+
+// Enqueue publishes a message to the email exchange and returns its tracking
+// ID, which ends up on every log of the message. The message is only
+// accepted once RabbitMQ confirms it.
+func (r *RabbitMQ) Enqueue(message *models.QueueMessage) (string, error) {
+	message.TrackingID = primitive.NewObjectID().Hex()
+	if message.Timestamp.IsZero() {
+		message.Timestamp = time.Now()
+	}
+
+	body, err := json.Marshal(message)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal message: %w", err)
+	}
+	err = r.Publish(r.cfg.Exchange, r.cfg.RoutingKey, amqp.Publishing{
+		ContentType:  "application/json",
+		DeliveryMode: amqp.Persistent,
+		Priority:     r.Priority(message.Priority),
+		MessageId:    message.TrackingID,
+		Timestamp:    message.Timestamp,
+		Body:         body,
+	})
+	if err != nil {
+		return "", err
+	}
+	return message.TrackingID, nil
+}
@@ -0,0 +1,64 @@
+package queue
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/streadway/amqp"
+)
+
+// Priorities of QueueMessage.Priority, lowest first. Empty and unknown
+// values count as normal.
+const (
+	PriorityLow      = "low"
+	PriorityNormal   = "normal"
+	PriorityHigh     = "high"
+	PriorityCritical = "critical"
+)
+
+var priorityRanks = map[string]int{
+	PriorityLow:      0,
+	PriorityNormal:   1,
+	PriorityHigh:     2,
+	PriorityCritical: 3,
+}
+
+func IsPriority(priority string) bool {
+	_, ok := priorityRanks[strings.ToLower(priority)]
+	return ok
+}
+
+// amqpPriority spreads the priorities evenly over 0..maxPriority, so with
+// max-priority 10 they map to 0, 3, 7 and 10.
+func amqpPriority(priority string, maxPriority int) uint8 {
+	if maxPriority <= 0 {
+		return 0
+	}
+	rank, ok := priorityRanks[strings.ToLower(priority)]
+	if !ok {
+		rank = priorityRanks[PriorityNormal]
+	}
+	maxRank := priorityRanks[PriorityCritical]
+	return uint8((rank*maxPriority*2 + maxRank) / (maxRank * 2))
+}
+
+// Priority returns the AMQP priority to publish a queue message with.
+func (r *RabbitMQ) Priority(priority string) uint8 {
+	return amqpPriority(priority, r.cfg.MaxPriority)
+}
+
+// republishPriority keeps the priority a message was published with, or
+// derives it from the priority field of the body for producers that did
+// not set one.
+func (r *RabbitMQ) republishPriority(delivery amqp.Delivery, body []byte) uint8 {
+	if delivery.Priority > 0 {
+		return delivery.Priority
+	}
+	var message struct {
+		Priority string `json:"priority"`
+	}
+	if err := json.Unmarshal(body, &message); err != nil {
+		return r.Priority(PriorityNormal)
+	}
+	return r.Priority(message.Priority)
+}
@@ -1,60 +1,613 @@
 package queue
 
 import (
+	"errors"
+	"fmt"
+	"handyhub-email-svc/internal/config"
+	"handyhub-email-svc/internal/content"
+	"handyhub-email-svc/internal/idempotency"
 	"handyhub-email-svc/internal/models"
+	"handyhub-email-svc/internal/preferences"
 	"handyhub-email-svc/internal/smtp"
 	"handyhub-email-svc/internal/storage"
+	"handyhub-email-svc/internal/suppression"
+	"handyhub-email-svc/internal/templates"
+	"handyhub-email-svc/internal/tracking"
+	"handyhub-email-svc/internal/validation"
+	"html"
+	"strings"
 	"time"
 
 	"github.com/sirupsen/logrus"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// maxThreadReferences caps the References header of threaded emails.
+const maxThreadReferences = 20
+
+// storeAttempts bounds the tries to store the log of a sent email, the
+// message itself is not retried.
+const storeAttempts = 3
+
+var storeRetryDelay = time.Second
+
+// errLogNotStored reports an email sent or failed for good whose log could
+// not be stored. The message is acknowledged, a redelivery would send again.
+var errLogNotStored = errors.New("email log not stored")
+
+const (
+	unsubscribePlaceholder = "{{unsubscribe_url}}"
+	preferencesPlaceholder = "{{preferences_url}}"
+)
+
 type EmailProcessor struct {
-	emailStorage storage.EmailStorage
-	smtpProvider smtp.SMTPProvider
+	cfg             *config.Configuration
+	emailStorage    storage.EmailStorage
+	providers       *smtp.ProviderRegistry
+	validator       *validation.Validator
+	suppressions    *suppression.Service
+	tracker         *tracking.Service
+	preferences     *preferences.Service
+	templates       *templates.Renderer
+	events          EventPublisher
+	idempotency     *idempotency.Service
+	messageIDDomain string
 }
 
-func NewProcessor(emailStorage storage.EmailStorage, smtpProvider smtp.SMTPProvider) *EmailProcessor {
+func NewProcessor(cfg *config.Configuration, emailStorage storage.EmailStorage, providers *smtp.ProviderRegistry, validator *validation.Validator, suppressions *suppression.Service, tracker *tracking.Service, preferences *preferences.Service, renderer *templates.Renderer, events EventPublisher, idempotency *idempotency.Service) *EmailProcessor {
 	return &EmailProcessor{
-		emailStorage: emailStorage,
-		smtpProvider: smtpProvider,
+		cfg:             cfg,
+		emailStorage:    emailStorage,
+		providers:       providers,
+		validator:       validator,
+		suppressions:    suppressions,
+		tracker:         tracker,
+		preferences:     preferences,
+		templates:       renderer,
+		events:          events,
+		idempotency:     idempotency,
+		messageIDDomain: messageIDDomain(cfg.SMTP),
 	}
 }
 
+// ProcessMessage sends a queue message. Messages with an idempotency key are
+// sent once: a redelivery of a processed message only stores the log of the
+// sent email if that failed before.
 func (p *EmailProcessor) ProcessMessage(message *models.QueueMessage) error {
+	key := message.IdempotencyKey
+	if p.idempotency == nil || key == "" {
+		if err := p.process(message); !errors.Is(err, errLogNotStored) {
+			return err
+		}
+		return nil
+	}
+
+	entry := log.WithField("idempotency_key", key)
+	record, err := p.idempotency.Claim(key)
+	if errors.Is(err, idempotency.ErrCompleted) {
+		entry.Info("Message was already processed, skipping send")
+		if record.Log != nil {
+			if err := p.restoreLog(message, record.Log); err != nil {
+				return err
+			}
+		}
+		return p.completeMessage(key)
+	}
+	if errors.Is(err, idempotency.ErrInProgress) {
+		entry.Warn("Message is being processed by another delivery, deferring")
+		return &DeferError{Err: err, Delay: p.idempotency.Lease()}
+	}
+	if err != nil {
+		return err
+	}
+
+	err = p.process(message)
+	if errors.Is(err, errLogNotStored) {
+		// the key keeps the log for a redelivery to store
+		return nil
+	}
+	if err != nil {
+		// process fails only before the send, so the retry may send
+		if releaseErr := p.idempotency.Release(key); releaseErr != nil {
+			entry.WithError(releaseErr).Error("Failed to release idempotency key")
+		}
+		return err
+	}
+	return p.completeMessage(key)
+}
+
+// completeMessage only logs failures, the key stays processing until its
+// lease runs out and the log is already stored.
+func (p *EmailProcessor) completeMessage(key string) error {
+	if err := p.idempotency.Complete(key); err != nil {
+		log.WithError(err).WithField("idempotency_key", key).Error("Failed to complete idempotency key")
+	}
+	return nil
+}
+
+// restoreLog stores the log of an email sent by an earlier delivery, unless
+// that delivery stored it and only failed to complete the key.
+func (p *EmailProcessor) restoreLog(message *models.QueueMessage, emailLog *models.EmailLog) error {
+	_, err := p.emailStorage.FindByID(emailLog.ID)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, storage.ErrNotFound) {
+		return err
+	}
+	log.WithField("log_id", emailLog.ID.Hex()).Info("Storing log of an email sent by an earlier delivery")
+	return p.store(message, emailLog)
+}
+
+func (p *EmailProcessor) process(message *models.QueueMessage) error {
+	rendered := &templates.Rendered{}
+	if message.TemplateID != "" {
+		if p.templates == nil {
+			return p.storeRenderFailure(message, fmt.Errorf("templates are disabled"))
+		}
+		var err error
+		rendered, err = p.renderTemplate(message)
+		var renderErr *templates.RenderError
+		if errors.Is(err, templates.ErrNotFound) || errors.Is(err, templates.ErrVersionNotFound) || errors.As(err, &renderErr) {
+			return p.storeRenderFailure(message, err)
+		}
+		if err != nil {
+			log.WithError(err).WithField("template_id", message.TemplateID).Error("Failed to load template")
+			return err
+		}
+	}
+
+	if message.TemplateID == "" && message.Email.BodyMarkdown != "" {
+		p.renderMarkdown(message)
+	}
+
+	providerName, provider, err := p.providers.Resolve(message.Email.Provider)
+	if err != nil {
+		log.WithError(err).Error("Failed to resolve SMTP provider")
+		return p.store(message, &models.EmailLog{
+			ID:       primitive.NewObjectID(),
+			To:       message.Email.To,
+			Subject:  message.Email.Subject,
+			Status:   models.StatusFailed,
+			Provider: message.Email.Provider,
+			SentAt:   time.Now(),
+			ErrorMsg: err.Error(),
+		})
+	}
+
 	log.WithFields(logrus.Fields{
 		"to":       message.Email.To,
 		"subject":  message.Email.Subject,
-		"provider": p.smtpProvider.GetProviderName(),
+		"provider": providerName,
+		"priority": message.Priority,
 	}).Info("Processing email message")
 
+	if p.validator != nil {
+		valid, invalid := p.validator.Validate(message.Email.To)
+		if len(invalid) > 0 {
+			if err := p.storeInvalidRecipients(message, providerName, invalid); err != nil {
+				return err
+			}
+		}
+		if len(valid) == 0 {
+			log.Warn("No valid recipients left, skipping send")
+			return nil
+		}
+		message.Email.To = valid
+	}
+
+	if p.suppressions != nil {
+		allowed, suppressed, err := p.suppressions.Filter(message.Email.To)
+		if err != nil {
+			log.WithError(err).Error("Failed to check suppression list")
+			return err
+		}
+		if len(suppressed) > 0 {
+			if err := p.storeSuppressedRecipients(message, providerName, suppressed); err != nil {
+				return err
+			}
+		}
+		if len(allowed) == 0 {
+			log.Warn("All recipients are suppressed, skipping send")
+			return nil
+		}
+		message.Email.To = allowed
+	}
+
+	if p.preferences != nil && message.Email.Category != "" {
+		allowed, optedOut, err := p.preferences.Filter(message.Email.To, message.Email.Category)
+		if err != nil {
+			log.WithError(err).Error("Failed to check recipient preferences")
+			return err
+		}
+		if len(optedOut) > 0 {
+			if err := p.storeUnsubscribedRecipients(message, providerName, optedOut); err != nil {
+				return err
+			}
+		}
+		if len(allowed) == 0 {
+			log.WithField("category", message.Email.Category).Warn("All recipients unsubscribed from category, skipping send")
+			return nil
+		}
+		message.Email.To = allowed
+	}
+
+	p.addUnsubscribeLinks(&message.Email)
+	p.inlineCSS(&message.Email)
+	p.ensureTextBody(&message.Email)
+	p.resolveThread(&message.Email)
+
+	logID := messageLogID(message)
+	p.track(&message.Email, logID)
+
 	var emailLog *models.EmailLog
 	emailLog = &models.EmailLog{
-		ID:       primitive.NewObjectID(),
-		To:       message.Email.To,
-		Subject:  message.Email.Subject,
-		Provider: p.smtpProvider.GetProviderName(),
-		Attempts: 1,
-		SentAt:   time.Now(),
+		ID:              logID,
+		To:              message.Email.To,
+		Subject:         message.Email.Subject,
+		Provider:        providerName,
+		Attempts:        max(message.Attempt, 1),
+		SentAt:          time.Now(),
+		MessageID:       message.Email.MessageID,
+		ThreadKey:       message.Email.ThreadKey,
+		Category:        message.Email.Category,
+		TemplateID:      message.TemplateID,
+		Locale:          rendered.Locale,
+		TemplateVersion: rendered.Version,
 	}
 
-	err := p.smtpProvider.SendEmail(&message.Email)
+	providerMessageID, err := provider.SendEmail(&message.Email)
+	if err != nil && smtp.IsTransient(err) && canRetry(p.cfg.Queue.RabbitMQ.Retry, emailLog.Attempts) {
+		log.WithError(err).WithField("attempt", emailLog.Attempts).Warn("Failed to send email, will retry")
+		emailLog.Status = models.StatusRetrying
+		emailLog.ErrorMsg = err.Error()
+		// a failed store is only logged, the next attempt stores the same log
+		_ = p.store(message, emailLog)
+		return &RetryError{Err: err, LogID: logID.Hex()}
+	}
 	if err != nil {
 		log.WithError(err).Error("Failed to send email")
-		emailLog.Status = "failed"
+		emailLog.Status = models.StatusFailed
 		emailLog.ErrorMsg = err.Error()
-
 	} else {
 		log.Info("Email sent successfully")
-		emailLog.Status = "success"
+		emailLog.Status = models.StatusSuccess
+		emailLog.ProviderMessageID = providerMessageID
+	}
+	p.recordSent(message, emailLog)
+
+	if err := p.storeOutcome(message, emailLog); err != nil {
+		log.WithError(err).WithField("log_id", logID.Hex()).Error("Failed to store email log, acknowledging the message anyway")
+		return errLogNotStored
 	}
 
+	log.Info("Email processed and logged successfully")
+	return nil
+}
+
+// messageLogID returns the log stored by earlier attempts of a message, every
+// attempt updates the same log.
+func messageLogID(message *models.QueueMessage) primitive.ObjectID {
+	if logID, err := primitive.ObjectIDFromHex(message.LogID); err == nil {
+		return logID
+	}
+	return primitive.NewObjectID()
+}
+
+// storeOutcome stores the log of a sent or permanently failed email. Only
+// the store is retried, a redelivery of the message would send it again.
+func (p *EmailProcessor) storeOutcome(message *models.QueueMessage, emailLog *models.EmailLog) error {
+	var err error
+	for attempt := 1; attempt <= storeAttempts; attempt++ {
+		if attempt > 1 {
+			time.Sleep(storeRetryDelay)
+		}
+		if err = p.store(message, emailLog); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+func (p *EmailProcessor) store(message *models.QueueMessage, emailLog *models.EmailLog) error {
+	emailLog.TrackingID = message.TrackingID
 	if err := p.emailStorage.Store(emailLog); err != nil {
 		log.WithError(err).Error("Failed to store email log")
 		return err
 	}
-
-	log.Info("Email processed and logged successfully")
+	p.publishEvent(message, emailLog)
 	return nil
 }
+
+// recordSent marks the idempotency key of a message sent or failed for good
+// before its log is stored, so a redelivery after a failed store does not
+// send it again.
+func (p *EmailProcessor) recordSent(message *models.QueueMessage, emailLog *models.EmailLog) {
+	if p.idempotency == nil || message.IdempotencyKey == "" {
+		return
+	}
+	if err := p.idempotency.Sent(message.IdempotencyKey, emailLog); err != nil {
+		log.WithError(err).WithField("idempotency_key", message.IdempotencyKey).Error("Failed to record sent email")
+	}
+}
+
+// publishEvent reports a final outcome to other services. A failed publish
+// is only logged, retrying the message would send the email again.
+func (p *EmailProcessor) publishEvent(message *models.QueueMessage, emailLog *models.EmailLog) {
+	if p.events == nil {
+		return
+	}
+	event := models.NewEmailEvent(emailLog, message.Metadata)
+	if event == nil {
+		return
+	}
+	if err := p.events.PublishEvent(event); err != nil {
+		log.WithError(err).WithField("type", event.Type).WithField("log_id", event.LogID).Error("Failed to publish email event")
+	}
+}
+
+// addUnsubscribeLinks fills the {{unsubscribe_url}} and {{preferences_url}}
+// placeholders and adds the List-Unsubscribe headers for one-click
+// unsubscribe. Links are per recipient, so emails with several recipients get
+// the placeholders removed instead.
+func (p *EmailProcessor) addUnsubscribeLinks(email *models.EmailMessage) {
+	unsubscribeURL, preferencesURL := p.unsubscribeLinks(email)
+
+	email.BodyHTML = strings.NewReplacer(
+		unsubscribePlaceholder, html.EscapeString(unsubscribeURL),
+		preferencesPlaceholder, html.EscapeString(preferencesURL),
+	).Replace(email.BodyHTML)
+	email.BodyText = strings.NewReplacer(
+		unsubscribePlaceholder, unsubscribeURL,
+		preferencesPlaceholder, preferencesURL,
+	).Replace(email.BodyText)
+
+	if unsubscribeURL == "" {
+		return
+	}
+	if email.Headers == nil {
+		email.Headers = make(map[string]string)
+	}
+	email.Headers["List-Unsubscribe"] = "<" + unsubscribeURL + ">"
+	email.Headers["List-Unsubscribe-Post"] = "List-Unsubscribe=One-Click"
+}
+
+func (p *EmailProcessor) unsubscribeLinks(email *models.EmailMessage) (string, string) {
+	if p.preferences == nil || email.Category == "" || len(email.To) != 1 {
+		return "", ""
+	}
+	unsubscribeURL, err := p.preferences.UnsubscribeURL(email.To[0], email.Category)
+	if err != nil {
+		log.WithError(err).Warn("Failed to create unsubscribe link")
+	}
+	preferencesURL, err := p.preferences.PreferencesURL(email.To[0])
+	if err != nil {
+		log.WithError(err).Warn("Failed to create preferences link")
+	}
+	return unsubscribeURL, preferencesURL
+}
+
+// renderTemplate fills the email from its server-side template.
+func (p *EmailProcessor) renderTemplate(message *models.QueueMessage) (*templates.Rendered, error) {
+	unsubscribeURL, preferencesURL := p.unsubscribeLinks(&message.Email)
+	rendered, err := p.templates.Render(message.TemplateID, message.Locale, message.TemplateData, templates.Links{
+		Unsubscribe: unsubscribeURL,
+		Preferences: preferencesURL,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if message.Email.Subject == "" {
+		message.Email.Subject = rendered.Subject
+	}
+	message.Email.BodyHTML = rendered.HTML
+	message.Email.BodyText = rendered.Text
+	if message.Email.InlineCSS == nil {
+		message.Email.InlineCSS = rendered.InlineCSS
+	}
+	return rendered, nil
+}
+
+// renderMarkdown converts the Markdown body to sanitized HTML wrapped in the
+// configured layout and a text alternative. Without the layout the converted
+// bodies are sent as is.
+func (p *EmailProcessor) renderMarkdown(message *models.QueueMessage) {
+	email := &message.Email
+	markdown := content.RenderMarkdown(email.BodyMarkdown)
+	email.BodyHTML, email.BodyText = markdown.HTML, markdown.Text
+
+	layout := p.cfg.Content.MarkdownLayout
+	if p.templates == nil || layout == "" {
+		return
+	}
+	unsubscribeURL, preferencesURL := p.unsubscribeLinks(email)
+	rendered, err := p.templates.RenderLayout(layout, message.Locale, markdown.HTML, markdown.Text, templates.Links{
+		Unsubscribe: unsubscribeURL,
+		Preferences: preferencesURL,
+	})
+	if err != nil {
+		log.WithError(err).WithField("layout", layout).Warn("Failed to apply layout to Markdown body, sending it unwrapped")
+		return
+	}
+	email.BodyHTML, email.BodyText = rendered.HTML, rendered.Text
+}
+
+// inlineCSS moves <style> rules into style attributes when enabled in config
+// or requested by the message.
+func (p *EmailProcessor) inlineCSS(email *models.EmailMessage) {
+	enabled := p.cfg.Content.InlineCSS
+	if email.InlineCSS != nil {
+		enabled = *email.InlineCSS
+	}
+	if !enabled || email.BodyHTML == "" {
+		return
+	}
+
+	inlined, err := content.InlineCSS(email.BodyHTML)
+	if err != nil {
+		log.WithError(err).Warn("Failed to inline CSS, sending HTML as is")
+		return
+	}
+	email.BodyHTML = inlined
+}
+
+// ensureTextBody derives a text/plain alternative for HTML-only emails, a
+// missing text part hurts spam scores.
+func (p *EmailProcessor) ensureTextBody(email *models.EmailMessage) {
+	if email.BodyText != "" || email.BodyHTML == "" {
+		return
+	}
+
+	text, err := content.HTMLToText(email.BodyHTML)
+	if err != nil {
+		log.WithError(err).Warn("Failed to generate text body from HTML, sending HTML only")
+		return
+	}
+	email.BodyText = text
+}
+
+// track adds the open pixel and click redirects for the email log logID.
+// The text part is left alone so it stays readable.
+func (p *EmailProcessor) track(email *models.EmailMessage, logID primitive.ObjectID) {
+	if p.tracker == nil || email.DisableTracking || email.BodyHTML == "" {
+		return
+	}
+
+	tracked, err := p.tracker.Instrument(logID, email.BodyHTML)
+	if err != nil {
+		log.WithError(err).Warn("Failed to add tracking, sending HTML as is")
+		return
+	}
+	email.BodyHTML = tracked
+}
+
+// resolveThread assigns the Message-ID and, for emails with a thread key,
+// references the earlier emails of the same thread so replies are grouped.
+func (p *EmailProcessor) resolveThread(email *models.EmailMessage) {
+	if email.MessageID == "" {
+		email.MessageID = fmt.Sprintf("<%s@%s>", primitive.NewObjectID().Hex(), p.messageIDDomain)
+	}
+	email.MessageID = smtp.FormatMessageID(email.MessageID)
+	if email.ThreadKey == "" {
+		return
+	}
+
+	previous, err := p.emailStorage.FindByThreadKey(email.ThreadKey, maxThreadReferences)
+	if err != nil {
+		log.WithError(err).WithField("thread_key", email.ThreadKey).Warn("Failed to resolve thread, sending without references")
+		return
+	}
+
+	for _, emailLog := range previous {
+		if emailLog.MessageID == email.MessageID || containsString(email.References, emailLog.MessageID) {
+			continue
+		}
+		email.References = append(email.References, emailLog.MessageID)
+	}
+	if len(email.References) > maxThreadReferences {
+		email.References = email.References[len(email.References)-maxThreadReferences:]
+	}
+	if email.InReplyTo == "" && len(email.References) > 0 {
+		email.InReplyTo = email.References[len(email.References)-1]
+	}
+}
+
+// storeInvalidRecipients records recipients rejected by validation, they are
+// never handed to the provider.
+func (p *EmailProcessor) storeInvalidRecipients(message *models.QueueMessage, providerName string, invalid []validation.InvalidRecipient) error {
+	to := make([]string, 0, len(invalid))
+	reasons := make([]string, 0, len(invalid))
+	for _, recipient := range invalid {
+		to = append(to, recipient.Address)
+		reasons = append(reasons, fmt.Sprintf("%s: %s", recipient.Address, recipient.Reason))
+	}
+
+	emailLog := &models.EmailLog{
+		ID:       primitive.NewObjectID(),
+		To:       to,
+		Subject:  message.Email.Subject,
+		Status:   models.StatusInvalid,
+		Provider: providerName,
+		SentAt:   time.Now(),
+		ErrorMsg: strings.Join(reasons, "; "),
+	}
+
+	return p.store(message, emailLog)
+}
+
+// storeSuppressedRecipients records recipients skipped because of the
+// suppression list.
+func (p *EmailProcessor) storeSuppressedRecipients(message *models.QueueMessage, providerName string, suppressed []*models.Suppression) error {
+	to := make([]string, 0, len(suppressed))
+	reasons := make([]string, 0, len(suppressed))
+	for _, entry := range suppressed {
+		to = append(to, entry.Address)
+		reasons = append(reasons, fmt.Sprintf("%s: %s", entry.Address, entry.Reason))
+	}
+
+	emailLog := &models.EmailLog{
+		ID:       primitive.NewObjectID(),
+		To:       to,
+		Subject:  message.Email.Subject,
+		Status:   models.StatusSuppressed,
+		Provider: providerName,
+		SentAt:   time.Now(),
+		ErrorMsg: strings.Join(reasons, "; "),
+	}
+
+	return p.store(message, emailLog)
+}
+
+// storeRenderFailure records an email that cannot be rendered, it is dropped
+// rather than retried.
+func (p *EmailProcessor) storeRenderFailure(message *models.QueueMessage, err error) error {
+	log.WithError(err).WithField("template_id", message.TemplateID).Error("Failed to render template")
+	return p.store(message, &models.EmailLog{
+		ID:         primitive.NewObjectID(),
+		To:         message.Email.To,
+		Subject:    message.Email.Subject,
+		Status:     models.StatusRenderFailed,
+		Provider:   message.Email.Provider,
+		SentAt:     time.Now(),
+		ErrorMsg:   err.Error(),
+		Category:   message.Email.Category,
+		TemplateID: message.TemplateID,
+	})
+}
+
+// storeUnsubscribedRecipients records recipients skipped because they opted
+// out of the email category.
+func (p *EmailProcessor) storeUnsubscribedRecipients(message *models.QueueMessage, providerName string, optedOut []string) error {
+	emailLog := &models.EmailLog{
+		ID:       primitive.NewObjectID(),
+		To:       optedOut,
+		Subject:  message.Email.Subject,
+		Status:   models.StatusUnsubscribed,
+		Provider: providerName,
+		SentAt:   time.Now(),
+		Category: message.Email.Category,
+		ErrorMsg: fmt.Sprintf("unsubscribed from category %s", message.Email.Category),
+	}
+
+	return p.store(message, emailLog)
+}
+
+func messageIDDomain(cfg config.SMTPConfig) string {
+	if cfg.MessageIDDomain != "" {
+		return cfg.MessageIDDomain
+	}
+	if from, err := smtp.ParseAddress(cfg.DefaultFrom); err == nil {
+		return from.Address[strings.LastIndex(from.Address, "@")+1:]
+	}
+	return "localhost"
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
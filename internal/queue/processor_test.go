@@ -0,0 +1,207 @@
+package queue
+
+import (
+	"errors"
+	"handyhub-email-svc/internal/config"
+	"handyhub-email-svc/internal/idempotency"
+	"handyhub-email-svc/internal/models"
+	"handyhub-email-svc/internal/smtp"
+	"handyhub-email-svc/internal/storage"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func newIdempotentProcessor(t *testing.T) (*EmailProcessor, *idempotency.Service, *storage.FileStorage) {
+	t.Helper()
+	emailStorage, err := storage.NewFileStorage(config.FileStorageConfig{Path: filepath.Join(t.TempDir(), "emails.jsonl")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { emailStorage.Close() })
+	service := idempotency.NewService(config.IdempotencyConfig{}, idempotency.NewMemoryStore())
+	return &EmailProcessor{cfg: &config.Configuration{}, emailStorage: emailStorage, idempotency: service}, service, emailStorage
+}
+
+func TestProcessMessageKeyInProgress(t *testing.T) {
+	processor, service, _ := newIdempotentProcessor(t)
+	if _, err := service.Claim("key"); err != nil {
+		t.Fatal(err)
+	}
+
+	err := processor.ProcessMessage(&models.QueueMessage{IdempotencyKey: "key"})
+	var deferErr *DeferError
+	if !errors.As(err, &deferErr) || !errors.Is(err, idempotency.ErrInProgress) {
+		t.Fatalf("ProcessMessage = %v, want a DeferError for ErrInProgress", err)
+	}
+	if deferErr.Delay != service.Lease() {
+		t.Errorf("deferred for %s, want the lease %s", deferErr.Delay, service.Lease())
+	}
+}
+
+func TestProcessMessageKeyCompleted(t *testing.T) {
+	processor, service, emailStorage := newIdempotentProcessor(t)
+	if _, err := service.Claim("key"); err != nil {
+		t.Fatal(err)
+	}
+	// the earlier delivery sent the email and crashed before storing its log
+	sent := &models.EmailLog{ID: primitive.NewObjectID(), To: []string{"ann@example.com"}, Status: models.StatusSuccess}
+	if err := service.Sent("key", sent); err != nil {
+		t.Fatal(err)
+	}
+
+	// the processor has no providers, it cannot have sent again
+	message := &models.QueueMessage{IdempotencyKey: "key", TrackingID: "tracking"}
+	for range 2 {
+		if err := processor.ProcessMessage(message); err != nil {
+			t.Fatalf("ProcessMessage = %v, want the redelivery acknowledged", err)
+		}
+	}
+
+	logs, err := emailStorage.FindByTrackingID("tracking")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(logs) != 1 || logs[0].ID != sent.ID {
+		t.Fatalf("stored logs %+v, want the sent email's log once", logs)
+	}
+	record, err := service.Claim("key")
+	if !errors.Is(err, idempotency.ErrCompleted) || record.Log != nil {
+		t.Fatalf("Claim = %+v, %v, want the key completed without its log", record, err)
+	}
+}
+
+type stubProvider struct {
+	errs  []error
+	sends int
+}
+
+func (p *stubProvider) SendEmail(email *models.EmailMessage) (string, error) {
+	p.sends++
+	if len(p.errs) > 0 {
+		err := p.errs[0]
+		p.errs = p.errs[1:]
+		return "", err
+	}
+	return "provider-id", nil
+}
+
+func (p *stubProvider) GetProviderName() string {
+	return "stub"
+}
+
+// failingStorage refuses to store logs.
+type failingStorage struct {
+	*storage.FileStorage
+	stores int
+}
+
+func (s *failingStorage) Store(emailLog *models.EmailLog) error {
+	s.stores++
+	return errors.New("storage unavailable")
+}
+
+func withProvider(t *testing.T, processor *EmailProcessor, provider smtp.SMTPProvider) {
+	t.Helper()
+	providers, err := smtp.NewProviderRegistry(map[string]smtp.SMTPProvider{"stub": provider}, "stub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	processor.providers = providers
+	processor.cfg.Queue.RabbitMQ.Retry = config.RetryConfig{Enabled: true, MaxAttempts: 3}
+}
+
+func TestProcessMessageRetriesUpdateOneLog(t *testing.T) {
+	processor, _, emailStorage := newIdempotentProcessor(t)
+	provider := &stubProvider{errs: []error{&smtp.TransientError{Err: errors.New("throttled")}}}
+	withProvider(t, processor, provider)
+
+	newMessage := func(attempt int, logID string) *models.QueueMessage {
+		return &models.QueueMessage{
+			Email:      models.EmailMessage{To: []string{"ann@example.com"}, Subject: "Hi", BodyText: "Hello"},
+			TrackingID: "tracking",
+			Attempt:    attempt,
+			LogID:      logID,
+		}
+	}
+
+	err := processor.ProcessMessage(newMessage(1, ""))
+	var retryErr *RetryError
+	if !errors.As(err, &retryErr) || retryErr.LogID == "" {
+		t.Fatalf("ProcessMessage = %v, want a RetryError with the log ID", err)
+	}
+	if err := processor.ProcessMessage(newMessage(2, retryErr.LogID)); err != nil {
+		t.Fatalf("ProcessMessage = %v, want the retry sent", err)
+	}
+
+	logs, err := emailStorage.FindByTrackingID("tracking")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(logs) != 1 {
+		t.Fatalf("stored %d logs, want one log updated by both attempts", len(logs))
+	}
+	if logs[0].ID.Hex() != retryErr.LogID || logs[0].Status != models.StatusSuccess || logs[0].Attempts != 2 {
+		t.Errorf("log = %s %s after %d attempts, want %s sent after 2", logs[0].ID.Hex(), logs[0].Status, logs[0].Attempts, retryErr.LogID)
+	}
+}
+
+func TestProcessMessageStoreFailureAfterSend(t *testing.T) {
+	storeRetryDelay = 0
+	t.Cleanup(func() { storeRetryDelay = time.Second })
+
+	tests := []struct {
+		name    string
+		sendErr error
+	}{
+		{"sent", nil},
+		{"failed permanently", errors.New("mailbox unavailable")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			processor, service, fileStorage := newIdempotentProcessor(t)
+			provider := &stubProvider{}
+			if tt.sendErr != nil {
+				provider.errs = []error{tt.sendErr}
+			}
+			withProvider(t, processor, provider)
+			failing := &failingStorage{FileStorage: fileStorage}
+			processor.emailStorage = failing
+
+			newMessage := func() *models.QueueMessage {
+				return &models.QueueMessage{
+					Email:          models.EmailMessage{To: []string{"ann@example.com"}, Subject: "Hi", BodyText: "Hello"},
+					TrackingID:     "tracking",
+					IdempotencyKey: "key",
+				}
+			}
+			if err := processor.ProcessMessage(newMessage()); err != nil {
+				t.Fatalf("ProcessMessage = %v, want the message acknowledged", err)
+			}
+			if provider.sends != 1 || failing.stores != storeAttempts {
+				t.Errorf("sent %d times and stored %d times, want 1 send and %d stores", provider.sends, failing.stores, storeAttempts)
+			}
+
+			// the key is kept with the log, a duplicate stores it without sending
+			processor.emailStorage = fileStorage
+			if err := processor.ProcessMessage(newMessage()); err != nil {
+				t.Fatalf("ProcessMessage = %v, want the duplicate acknowledged", err)
+			}
+			if provider.sends != 1 {
+				t.Errorf("sent %d times, want the duplicate skipped", provider.sends)
+			}
+			logs, err := fileStorage.FindByTrackingID("tracking")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(logs) != 1 {
+				t.Errorf("stored %d logs, want the log of the first delivery", len(logs))
+			}
+			if _, err := service.Claim("key"); !errors.Is(err, idempotency.ErrCompleted) {
+				t.Errorf("Claim = %v, want the key completed", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package queue
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"handyhub-email-svc/internal/models"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+var ErrNotConfirmed = errors.New("message was not confirmed by RabbitMQ")
+
+// EventPublisher publishes email status events.
+type EventPublisher interface {
+	PublishEvent(event *models.EmailEvent) error
+}
+
+// publisher is a confirm mode channel of the current connection, reopened
+// after a reconnect.
+type publisher struct {
+	conn     *amqp.Connection
+	channel  *amqp.Channel
+	confirms chan amqp.Confirmation
+}
+
+// Publish sends a message and waits until the broker confirms it. Publishes
+// are serialized so each confirmation matches its message.
+func (r *RabbitMQ) Publish(exchange, routingKey string, msg amqp.Publishing) error {
+	r.publishMu.Lock()
+	defer r.publishMu.Unlock()
+
+	p, err := r.confirmChannel()
+	if err != nil {
+		return err
+	}
+	if err := p.channel.Publish(exchange, routingKey, false, false, msg); err != nil {
+		r.publisher = nil
+		return fmt.Errorf("failed to publish: %w", err)
+	}
+
+	timeout := time.Duration(max(r.cfg.Timeout, 1)) * time.Second
+	select {
+	case confirm, ok := <-p.confirms:
+		if !ok {
+			r.publisher = nil
+			return fmt.Errorf("%w: channel closed", ErrNotConfirmed)
+		}
+		if !confirm.Ack {
+			return ErrNotConfirmed
+		}
+		return nil
+	case <-time.After(timeout):
+		// a late confirmation would be matched with the next message
+		p.channel.Close()
+		r.publisher = nil
+		return fmt.Errorf("%w: timed out after %s", ErrNotConfirmed, timeout)
+	}
+}
+
+func (r *RabbitMQ) confirmChannel() (*publisher, error) {
+	conn, err := r.currentConnection()
+	if err != nil {
+		return nil, err
+	}
+	if r.publisher != nil && r.publisher.conn == conn {
+		return r.publisher, nil
+	}
+
+	channel, err := conn.Channel()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open a channel: %w", err)
+	}
+	if err := channel.Confirm(false); err != nil {
+		channel.Close()
+		return nil, fmt.Errorf("failed to enable publisher confirms: %w", err)
+	}
+	r.publisher = &publisher{
+		conn:     conn,
+		channel:  channel,
+		confirms: channel.NotifyPublish(make(chan amqp.Confirmation, 1)),
+	}
+	return r.publisher, nil
+}
+
+// PublishEvent publishes an email status event with its type as routing key.
+func (r *RabbitMQ) PublishEvent(event *models.EmailEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+	exchange := r.cfg.Events.Exchange
+	if exchange == "" {
+		exchange = r.cfg.Exchange
+	}
+	return r.Publish(exchange, event.Type, amqp.Publishing{
+		ContentType:   "application/json",
+		DeliveryMode:  amqp.Persistent,
+		MessageId:     event.LogID,
+		CorrelationId: event.Metadata["correlation_id"],
+		Timestamp:     event.Timestamp,
+		Type:          event.Type,
+		Body:          body,
+	})
+}
@@ -2,9 +2,14 @@ package queue
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"handyhub-email-svc/internal/config"
 	"handyhub-email-svc/internal/models"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	"github.com/streadway/amqp"
@@ -12,61 +17,250 @@ import (
 
 var log = logrus.StandardLogger()
 
+// RabbitMQ keeps a connection to the broker and restores it, together with
+// the topology and the consumer, when the broker goes away.
 type RabbitMQ struct {
-	conn    *amqp.Connection
-	channel *amqp.Channel
-	cfg     *config.RabbitMQConfig
+	cfg *config.RabbitMQConfig
+	// consumerTag identifies the consumer to cancel it on shutdown
+	consumerTag string
+
+	// deadLetters serializes browsing the dead-letter queue
+	deadLetters sync.Mutex
+	publishMu   sync.Mutex
+	publisher   *publisher
+
+	mu        sync.RWMutex
+	conn      *amqp.Connection
+	channel   *amqp.Channel
+	connected bool
+	closed    bool
+	stopped   bool
+	// done is closed when consuming stops, aborting reconnects
+	done     chan struct{}
+	stopOnce sync.Once
+	// consume opens the delivery channel, ConsumeMessages outside of tests
+	consume func() (<-chan amqp.Delivery, error)
 }
 
+var ErrDisconnected = errors.New("not connected to RabbitMQ")
+
 func NewRabbitMQ(cfg *config.RabbitMQConfig) (*RabbitMQ, error) {
 	log.Info("Connecting to RabbitMQ...")
-	conn, err := amqp.Dial(cfg.Url)
-	if err != nil {
+	r := &RabbitMQ{cfg: cfg, consumerTag: cfg.Consumer, done: make(chan struct{})}
+	r.consume = r.ConsumeMessages
+	if r.consumerTag == "" {
+		r.consumerTag = fmt.Sprintf("email-consumer-%d", time.Now().UnixNano())
+	}
+	if err := r.connect(); err != nil {
 		log.WithError(err).Errorf("Failed to connect to RabbitMQ: %v", err)
 		return nil, err
 	}
 
+	log.Infof("Connected to RabbitMQ at %s", cfg.Url)
+	return r, nil
+}
+
+func (r *RabbitMQ) connect() error {
+	conn, err := amqp.Dial(r.cfg.Url)
+	if err != nil {
+		return err
+	}
 	channel, err := conn.Channel()
 	if err != nil {
-		log.WithError(err).Errorf("Failed to open a channel: %v", err)
-		return nil, err
+		conn.Close()
+		return fmt.Errorf("failed to open a channel: %w", err)
 	}
+	// registered before anything can close them, a late listener would only
+	// see a closed notification channel
+	connClosed := conn.NotifyClose(make(chan *amqp.Error, 1))
+	channelClosed := channel.NotifyClose(make(chan *amqp.Error, 1))
 
-	log.Infof("Connected to RabbitMQ at %s", cfg.Url)
+	r.mu.Lock()
+	previous := r.conn
+	r.conn, r.channel, r.connected = conn, channel, true
+	r.mu.Unlock()
+	if previous != nil {
+		previous.Close()
+	}
+
+	go r.watch(conn, connClosed, channelClosed)
+	return nil
+}
+
+// watch marks the connection as lost when it or its channel closes. A closed
+// channel takes the connection down too so both are restored together.
+func (r *RabbitMQ) watch(conn *amqp.Connection, connClosed, channelClosed chan *amqp.Error) {
+	var reason *amqp.Error
+	select {
+	case reason = <-connClosed:
+	case reason = <-channelClosed:
+	}
+
+	r.mu.Lock()
+	if r.conn == conn {
+		r.connected = false
+	}
+	closed := r.closed
+	r.mu.Unlock()
+
+	if reason != nil && !closed {
+		log.WithField("reason", reason.Reason).WithField("code", reason.Code).Warn("RabbitMQ connection lost")
+	}
+	conn.Close()
+}
+
+// Check reports whether the service is connected to the broker.
+func (r *RabbitMQ) Check() error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if !r.connected {
+		return ErrDisconnected
+	}
+	return nil
+}
+
+func (r *RabbitMQ) currentConnection() (*amqp.Connection, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if !r.connected {
+		return nil, ErrDisconnected
+	}
+	return r.conn, nil
+}
+
+func (r *RabbitMQ) currentChannel() (*amqp.Channel, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if !r.connected {
+		return nil, ErrDisconnected
+	}
+	return r.channel, nil
+}
+
+func (r *RabbitMQ) isStopped() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.closed || r.stopped
+}
+
+// StopConsuming cancels the consumer so no new deliveries arrive. Deliveries
+// already received are still passed to the handler before Consume returns.
+func (r *RabbitMQ) StopConsuming() {
+	r.mu.Lock()
+	r.stopped = true
+	channel, connected := r.channel, r.connected
+	r.mu.Unlock()
+	r.stopOnce.Do(func() { close(r.done) })
+
+	if !connected {
+		return
+	}
+	if err := channel.Cancel(r.consumerTag, false); err != nil {
+		log.WithError(err).Warn("Failed to cancel RabbitMQ consumer")
+		return
+	}
+	log.Info("RabbitMQ consumer cancelled")
+}
+
+// Consume passes deliveries to handle until Close is called. When the
+// connection drops it reconnects with exponential backoff starting at
+// reconnect-delay, redeclares the topology and resumes consuming.
+func (r *RabbitMQ) Consume(handle func(amqp.Delivery)) {
+	for {
+		deliveries, err := r.consume()
+		if err != nil {
+			log.WithError(err).Error("Failed to start consuming messages")
+		} else {
+			for delivery := range deliveries {
+				handle(delivery)
+			}
+		}
+
+		if r.isStopped() {
+			return
+		}
+		log.Warn("Message consumer interrupted, reconnecting to RabbitMQ")
+		if !r.reconnect() {
+			return
+		}
+	}
+}
+
+func (r *RabbitMQ) reconnect() bool {
+	r.mu.Lock()
+	r.connected = false
+	r.mu.Unlock()
 
-	return &RabbitMQ{
-		conn:    conn,
-		channel: channel,
-		cfg:     cfg,
-	}, nil
+	delay := time.Duration(r.cfg.ReconnectDelay) * time.Second
+	if delay <= 0 {
+		delay = time.Second
+	}
+	maxDelay := time.Duration(r.cfg.MaxReconnectDelay) * time.Second
+	if maxDelay < delay {
+		maxDelay = delay
+	}
+
+	for attempt := 1; ; attempt++ {
+		select {
+		case <-r.done:
+			return false
+		case <-time.After(delay):
+		}
+
+		err := r.connect()
+		if err == nil {
+			if err = r.SetupQueue(); err != nil {
+				r.mu.Lock()
+				r.connected = false
+				r.mu.Unlock()
+			}
+		}
+		if err == nil {
+			log.WithField("attempt", attempt).Info("Reconnected to RabbitMQ")
+			return true
+		}
+
+		delay = min(delay*2, maxDelay)
+		log.WithError(err).WithField("attempt", attempt).Warnf("Failed to reconnect to RabbitMQ, retrying in %s", delay)
+	}
 }
 
 func (r *RabbitMQ) Close() error {
-	if r.channel != nil {
-		if err := r.channel.Close(); err != nil {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return nil
+	}
+	r.closed, r.connected = true, false
+	r.stopOnce.Do(func() { close(r.done) })
+	conn, channel := r.conn, r.channel
+	r.mu.Unlock()
+
+	if channel != nil {
+		if err := channel.Close(); err != nil && !errors.Is(err, amqp.ErrClosed) {
 			log.WithError(err).Error("Failed to close RabbitMQ channel")
-			return err
 		} else {
 			log.Info("RabbitMQ channel closed")
-			return nil
 		}
 	}
 
-	if r.conn != nil {
-		if err := r.conn.Close(); err != nil {
+	if conn != nil {
+		if err := conn.Close(); err != nil && !errors.Is(err, amqp.ErrClosed) {
 			log.WithError(err).Error("Failed to close RabbitMQ connection")
 			return err
-		} else {
-			log.Info("RabbitMQ connection closed")
-			return nil
 		}
+		log.Info("RabbitMQ connection closed")
 	}
 
 	return nil
 }
 
 func (r *RabbitMQ) SetupQueue() error {
-	err := r.channel.ExchangeDeclare(
+	channel, err := r.currentChannel()
+	if err != nil {
+		return err
+	}
+	err = channel.ExchangeDeclare(
 		r.cfg.Exchange,
 		r.cfg.ExchangeType,
 		r.cfg.Durable,
@@ -79,20 +273,23 @@ func (r *RabbitMQ) SetupQueue() error {
 	if err != nil {
 		return fmt.Errorf("failed to declare exchange: %v", err)
 	}
+	if err := r.setupDeadLetterQueue(channel); err != nil {
+		return err
+	}
 
-	_, err = r.channel.QueueDeclare(
+	_, err = channel.QueueDeclare(
 		r.cfg.EmailQueue,
 		r.cfg.Durable,
 		r.cfg.AutoDelete,
 		r.cfg.Exclusive,
 		r.cfg.NoWait,
-		nil,
+		r.queueArgs(),
 	)
 
 	if err != nil {
-		return fmt.Errorf("failed to declare queue: %v", err)
+		return declareQueueError(r.cfg.EmailQueue, r.queueArgs(), err)
 	}
-	err = r.channel.QueueBind(
+	err = channel.QueueBind(
 		r.cfg.EmailQueue,
 		r.cfg.RoutingKey,
 		r.cfg.Exchange,
@@ -103,13 +300,43 @@ func (r *RabbitMQ) SetupQueue() error {
 	if err != nil {
 		return fmt.Errorf("failed to bind queue: %v", err)
 	}
+	if err := r.setupRetryQueues(channel); err != nil {
+		return err
+	}
+	if err := r.setupDeferQueue(channel); err != nil {
+		return err
+	}
 
 	log.Infof("Queue %s declared and bound to exchange %s with routing key %s", r.cfg.EmailQueue, r.cfg.Exchange, r.cfg.RoutingKey)
 	return nil
 }
 
+// declareQueueError names the arguments of a queue the broker refused to
+// redeclare, an existing queue cannot change its arguments.
+func declareQueueError(queue string, args amqp.Table, err error) error {
+	var amqpErr *amqp.Error
+	if !errors.As(err, &amqpErr) || amqpErr.Code != amqp.PreconditionFailed {
+		return fmt.Errorf("failed to declare queue: %v", err)
+	}
+	names := make([]string, 0, len(args))
+	for name, value := range args {
+		names = append(names, fmt.Sprintf("%s=%v", name, value))
+	}
+	sort.Strings(names)
+	declared := "no arguments"
+	if len(names) > 0 {
+		declared = strings.Join(names, ", ")
+	}
+	return fmt.Errorf("queue %s already exists with other arguments than %s, drain and delete it or change max-priority to match (see README): %s",
+		queue, declared, amqpErr.Reason)
+}
+
 func (r *RabbitMQ) ConsumeMessages() (<-chan amqp.Delivery, error) {
-	err := r.channel.Qos(
+	channel, err := r.currentChannel()
+	if err != nil {
+		return nil, err
+	}
+	err = channel.Qos(
 		r.cfg.PrefetchCount,
 		r.cfg.PrefetchSize,
 		r.cfg.Global,
@@ -119,9 +346,9 @@ func (r *RabbitMQ) ConsumeMessages() (<-chan amqp.Delivery, error) {
 		return nil, fmt.Errorf("failed to set QoS: %v", err)
 	}
 
-	msg, err := r.channel.Consume(
+	msg, err := channel.Consume(
 		r.cfg.EmailQueue,
-		r.cfg.Consumer,
+		r.consumerTag,
 		r.cfg.AutoAck,
 		r.cfg.Exclusive,
 		r.cfg.NoLocal,
@@ -0,0 +1,32 @@
+package queue
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/streadway/amqp"
+)
+
+func TestDeclareQueueError(t *testing.T) {
+	mismatch := &amqp.Error{
+		Code:   amqp.PreconditionFailed,
+		Reason: "PRECONDITION_FAILED - inequivalent arg 'x-max-priority' for queue 'email_queue' in vhost '/': received the value '10' of type 'signedint' but current is none",
+	}
+	err := declareQueueError("email_queue", amqp.Table{"x-max-priority": int32(10)}, mismatch)
+	for _, want := range []string{"email_queue already exists", "x-max-priority=10", "inequivalent arg 'x-max-priority'"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not contain %q", err, want)
+		}
+	}
+
+	err = declareQueueError("email_queue", amqp.Table{}, mismatch)
+	if !strings.Contains(err.Error(), "other arguments than no arguments") {
+		t.Errorf("error %q does not say nothing was declared", err)
+	}
+
+	err = declareQueueError("email_queue", nil, errors.New("channel closed"))
+	if err.Error() != "failed to declare queue: channel closed" {
+		t.Errorf("unrelated failure = %q", err)
+	}
+}
@@ -0,0 +1,195 @@
+package queue
+
+import (
+	"fmt"
+	"handyhub-email-svc/internal/config"
+	"strconv"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+// AttemptHeader carries the delivery attempt of a message, absent on the
+// first one.
+const AttemptHeader = "x-attempt"
+
+// LogIDHeader carries the email log every attempt of a message updates,
+// absent until an attempt stored one.
+const LogIDHeader = "x-log-id"
+
+// RetryError asks the consumer to retry the message after a delay instead of
+// requeueing it right away.
+type RetryError struct {
+	Err error
+	// LogID is the log of the failed attempt, the retry updates it
+	LogID string
+}
+
+func (e *RetryError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *RetryError) Unwrap() error {
+	return e.Err
+}
+
+// DeferError asks the consumer to redeliver the message after Delay without
+// counting an attempt, e.g. while another delivery holds its idempotency key.
+type DeferError struct {
+	Err   error
+	Delay time.Duration
+}
+
+func (e *DeferError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *DeferError) Unwrap() error {
+	return e.Err
+}
+
+func canRetry(cfg config.RetryConfig, attempt int) bool {
+	return cfg.Enabled && attempt < cfg.MaxAttempts
+}
+
+// retryDelay is the wait before the attempt following attempt.
+func retryDelay(cfg config.RetryConfig, attempt int) time.Duration {
+	delay := time.Duration(max(cfg.InitialDelay, 1)) * time.Second
+	maxDelay := max(time.Duration(cfg.MaxDelay)*time.Second, delay)
+	for i := 1; i < attempt && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxDelay)
+}
+
+// retryQueue names the TTL queue holding messages for delay. Expired
+// messages are dead-lettered back to the email queue.
+func retryQueue(cfg *config.RabbitMQConfig, delay time.Duration) string {
+	return fmt.Sprintf("%s.retry.%ds", cfg.EmailQueue, int(delay.Seconds()))
+}
+
+// Attempt returns the delivery attempt of a message, starting at 1.
+func Attempt(delivery amqp.Delivery) int {
+	switch v := delivery.Headers[AttemptHeader].(type) {
+	case int32:
+		return max(int(v), 1)
+	case int64:
+		return max(int(v), 1)
+	case int:
+		return max(v, 1)
+	}
+	return 1
+}
+
+// LogID returns the email log of earlier attempts of a message.
+func LogID(delivery amqp.Delivery) string {
+	logID, _ := delivery.Headers[LogIDHeader].(string)
+	return logID
+}
+
+// RequeueDelay is the pause before a failed message goes back to the queue
+// without a retry queue, initial-delay paces requeues even with retry disabled.
+func (r *RabbitMQ) RequeueDelay() time.Duration {
+	return retryDelay(r.cfg.Retry, 1)
+}
+
+// CanRetry reports whether a message that failed on attempt may be retried.
+func (r *RabbitMQ) CanRetry(attempt int) bool {
+	return canRetry(r.cfg.Retry, attempt)
+}
+
+// deferQueue names the queue holding deferred messages, each one expires
+// after its own delay and is dead-lettered back to the email queue.
+func deferQueue(cfg *config.RabbitMQConfig) string {
+	return cfg.EmailQueue + ".deferred"
+}
+
+// setupDeferQueue declares the queue of deferred messages. They all wait for
+// the same delay, so per-message expiration cannot block the queue head.
+func (r *RabbitMQ) setupDeferQueue(channel *amqp.Channel) error {
+	_, err := channel.QueueDeclare(deferQueue(r.cfg), r.cfg.Durable, false, false, r.cfg.NoWait, amqp.Table{
+		"x-dead-letter-exchange":    r.cfg.Exchange,
+		"x-dead-letter-routing-key": r.cfg.RoutingKey,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to declare defer queue %s: %w", deferQueue(r.cfg), err)
+	}
+	return nil
+}
+
+// setupRetryQueues declares one TTL queue per backoff delay.
+func (r *RabbitMQ) setupRetryQueues(channel *amqp.Channel) error {
+	if !r.cfg.Retry.Enabled {
+		return nil
+	}
+	declared := make(map[string]bool)
+	for attempt := 1; attempt < r.cfg.Retry.MaxAttempts; attempt++ {
+		delay := retryDelay(r.cfg.Retry, attempt)
+		name := retryQueue(r.cfg, delay)
+		if declared[name] {
+			continue
+		}
+		declared[name] = true
+
+		_, err := channel.QueueDeclare(name, r.cfg.Durable, false, false, r.cfg.NoWait, amqp.Table{
+			"x-message-ttl":             delay.Milliseconds(),
+			"x-dead-letter-exchange":    r.cfg.Exchange,
+			"x-dead-letter-routing-key": r.cfg.RoutingKey,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to declare retry queue %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// Retry republishes a message that failed on attempt to the retry queue of
+// its backoff delay, with logID for the next attempt to update. The caller
+// acknowledges the original delivery once the broker confirmed the copy.
+func (r *RabbitMQ) Retry(delivery amqp.Delivery, attempt int, logID string) error {
+	headers := amqp.Table{}
+	for key, value := range delivery.Headers {
+		headers[key] = value
+	}
+	headers[AttemptHeader] = int32(attempt + 1)
+	if logID != "" {
+		headers[LogIDHeader] = logID
+	}
+
+	delay := retryDelay(r.cfg.Retry, attempt)
+	err := r.Publish("", retryQueue(r.cfg, delay), amqp.Publishing{
+		Headers:      headers,
+		ContentType:  delivery.ContentType,
+		DeliveryMode: amqp.Persistent,
+		Priority:     r.republishPriority(delivery, delivery.Body),
+		MessageId:    delivery.MessageId,
+		Timestamp:    delivery.Timestamp,
+		Body:         delivery.Body,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to publish retry: %w", err)
+	}
+	log.WithField("attempt", attempt+1).Infof("Message scheduled for retry in %s", delay)
+	return nil
+}
+
+// Defer republishes a message to come back after delay with its headers
+// unchanged, so the attempt is not counted. The caller acknowledges the
+// original delivery once the broker confirmed the copy.
+func (r *RabbitMQ) Defer(delivery amqp.Delivery, delay time.Duration) error {
+	err := r.Publish("", deferQueue(r.cfg), amqp.Publishing{
+		Headers:      delivery.Headers,
+		ContentType:  delivery.ContentType,
+		DeliveryMode: amqp.Persistent,
+		Priority:     r.republishPriority(delivery, delivery.Body),
+		MessageId:    delivery.MessageId,
+		Timestamp:    delivery.Timestamp,
+		Expiration:   strconv.FormatInt(max(delay.Milliseconds(), 1), 10),
+		Body:         delivery.Body,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to publish deferred message: %w", err)
+	}
+	log.Infof("Message deferred for %s", delay)
+	return nil
+}
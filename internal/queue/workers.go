@@ -0,0 +1,137 @@
+package queue
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+// WorkerStats are the counters of one worker.
+type WorkerStats struct {
+	ID        int   `json:"id"`
+	Busy      bool  `json:"busy"`
+	Processed int64 `json:"processed"`
+	Failed    int64 `json:"failed"`
+	// durations in milliseconds
+	LastDuration    int64 `json:"last_duration_ms"`
+	AverageDuration int64 `json:"average_duration_ms"`
+}
+
+type worker struct {
+	id        int
+	busy      atomic.Bool
+	processed atomic.Int64
+	failed    atomic.Int64
+	last      atomic.Int64
+	total     atomic.Int64
+}
+
+// WorkerPool handles deliveries concurrently. Each delivery is acknowledged
+// by the handler of the worker that received it, the error it returns only
+// counts as a failure in the stats.
+type WorkerPool struct {
+	handle     func(amqp.Delivery) error
+	deliveries chan amqp.Delivery
+	// stop is closed by Drain, deliveries is never closed as the consumer may
+	// still be submitting when the drain times out
+	stop     chan struct{}
+	workers  []*worker
+	wg       sync.WaitGroup
+	stopOnce sync.Once
+}
+
+func NewWorkerPool(size int, handle func(amqp.Delivery) error) *WorkerPool {
+	size = max(size, 1)
+	p := &WorkerPool{
+		handle:     handle,
+		deliveries: make(chan amqp.Delivery),
+		stop:       make(chan struct{}),
+		workers:    make([]*worker, size),
+	}
+	for i := range p.workers {
+		p.workers[i] = &worker{id: i + 1}
+		p.wg.Add(1)
+		go p.run(p.workers[i])
+	}
+	log.Infof("Started %d message workers", size)
+	return p
+}
+
+func (p *WorkerPool) run(w *worker) {
+	defer p.wg.Done()
+	for {
+		var delivery amqp.Delivery
+		select {
+		case delivery = <-p.deliveries:
+		case <-p.stop:
+			return
+		}
+
+		w.busy.Store(true)
+		started := time.Now()
+		err := p.handle(delivery)
+		elapsed := time.Since(started).Milliseconds()
+
+		w.processed.Add(1)
+		if err != nil {
+			w.failed.Add(1)
+		}
+		w.last.Store(elapsed)
+		w.total.Add(elapsed)
+		w.busy.Store(false)
+	}
+}
+
+// Submit hands a delivery to the next free worker, blocking while all of
+// them are busy. The broker bounds the deliveries in flight by prefetch.
+// Once the pool drains the delivery is requeued instead.
+func (p *WorkerPool) Submit(delivery amqp.Delivery) {
+	select {
+	case p.deliveries <- delivery:
+	case <-p.stop:
+		if err := delivery.Nack(false, true); err != nil {
+			log.WithError(err).Warn("Failed to requeue delivery on shutdown")
+		}
+	}
+}
+
+// Drain stops accepting deliveries and waits for the workers to finish the
+// ones they hold, or for ctx to expire. Call it once consumption stopped,
+// deliveries submitted later, e.g. after a timeout, are requeued.
+func (p *WorkerPool) Drain(ctx context.Context) error {
+	p.stopOnce.Do(func() { close(p.stop) })
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		log.Info("Message workers drained")
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (p *WorkerPool) Stats() []WorkerStats {
+	stats := make([]WorkerStats, len(p.workers))
+	for i, w := range p.workers {
+		processed := w.processed.Load()
+		stats[i] = WorkerStats{
+			ID:           w.id,
+			Busy:         w.busy.Load(),
+			Processed:    processed,
+			Failed:       w.failed.Load(),
+			LastDuration: w.last.Load(),
+		}
+		if processed > 0 {
+			stats[i].AverageDuration = w.total.Load() / processed
+		}
+	}
+	return stats
+}
@@ -0,0 +1,206 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+// acknowledger records how each delivery tag was settled.
+type acknowledger struct {
+	mu      sync.Mutex
+	settled map[uint64][]string
+}
+
+func newAcknowledger() *acknowledger {
+	return &acknowledger{settled: make(map[uint64][]string)}
+}
+
+func (a *acknowledger) record(tag uint64, outcome string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.settled[tag] = append(a.settled[tag], outcome)
+	return nil
+}
+
+func (a *acknowledger) Ack(tag uint64, multiple bool) error {
+	return a.record(tag, "ack")
+}
+
+func (a *acknowledger) Nack(tag uint64, multiple, requeue bool) error {
+	return a.record(tag, "nack")
+}
+
+func (a *acknowledger) Reject(tag uint64, requeue bool) error {
+	return a.record(tag, "reject")
+}
+
+func (a *acknowledger) outcomes() map[uint64][]string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	outcomes := make(map[uint64][]string, len(a.settled))
+	for tag, settled := range a.settled {
+		outcomes[tag] = append([]string(nil), settled...)
+	}
+	return outcomes
+}
+
+func waitFor(t *testing.T, what string, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func busyWorkers(pool *WorkerPool) int {
+	busy := 0
+	for _, stats := range pool.Stats() {
+		if stats.Busy {
+			busy++
+		}
+	}
+	return busy
+}
+
+func TestStopConsumingSettlesInFlightDeliveries(t *testing.T) {
+	const inFlight = 5
+	ack := newAcknowledger()
+
+	// the broker pushed prefetch-count deliveries before the consumer is
+	// cancelled, cancelling closes the channel behind them
+	source := make(chan amqp.Delivery, inFlight)
+	for tag := uint64(1); tag <= inFlight; tag++ {
+		source <- amqp.Delivery{Acknowledger: ack, DeliveryTag: tag}
+	}
+	r := &RabbitMQ{done: make(chan struct{})}
+	r.consume = func() (<-chan amqp.Delivery, error) {
+		go func() {
+			<-r.done
+			close(source)
+		}()
+		return source, nil
+	}
+
+	release := make(chan struct{})
+	pool := NewWorkerPool(2, func(delivery amqp.Delivery) error {
+		<-release
+		if delivery.DeliveryTag%2 == 0 {
+			delivery.Nack(false, true)
+			return errors.New("failed")
+		}
+		delivery.Ack(false)
+		return nil
+	})
+
+	consumerDone := make(chan struct{})
+	go func() {
+		defer close(consumerDone)
+		r.Consume(pool.Submit)
+	}()
+	waitFor(t, "both workers to hold a delivery", func() bool { return busyWorkers(pool) == 2 })
+
+	r.StopConsuming()
+	select {
+	case <-consumerDone:
+		t.Fatal("Consume returned while deliveries were still waiting for a worker")
+	case <-time.After(20 * time.Millisecond):
+	}
+	if settled := ack.outcomes(); len(settled) != 0 {
+		t.Fatalf("deliveries settled before the workers finished: %v", settled)
+	}
+
+	close(release)
+	select {
+	case <-consumerDone:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Consume did not return after StopConsuming")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := pool.Drain(ctx); err != nil {
+		t.Fatalf("Drain: %v", err)
+	}
+
+	settled := ack.outcomes()
+	for tag := uint64(1); tag <= inFlight; tag++ {
+		want := "ack"
+		if tag%2 == 0 {
+			want = "nack"
+		}
+		if got := settled[tag]; len(got) != 1 || got[0] != want {
+			t.Errorf("delivery %d settled %v, want [%s]", tag, got, want)
+		}
+	}
+
+	var processed, failed int64
+	for _, stats := range pool.Stats() {
+		processed += stats.Processed
+		failed += stats.Failed
+	}
+	if processed != inFlight || failed != inFlight/2 {
+		t.Errorf("stats processed %d failed %d, want %d and %d", processed, failed, inFlight, inFlight/2)
+	}
+}
+
+func TestDrainTimesOut(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	pool := NewWorkerPool(1, func(amqp.Delivery) error {
+		<-release
+		return nil
+	})
+	pool.Submit(amqp.Delivery{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := pool.Drain(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Drain = %v, want DeadlineExceeded while a worker is busy", err)
+	}
+}
+
+func TestDrainTimeoutRequeuesBlockedSubmit(t *testing.T) {
+	ack := newAcknowledger()
+	release := make(chan struct{})
+	pool := NewWorkerPool(1, func(delivery amqp.Delivery) error {
+		<-release
+		return delivery.Ack(false)
+	})
+	pool.Submit(amqp.Delivery{Acknowledger: ack, DeliveryTag: 1})
+
+	// the consumer is stuck handing over the next delivery
+	submitted := make(chan struct{})
+	go func() {
+		defer close(submitted)
+		pool.Submit(amqp.Delivery{Acknowledger: ack, DeliveryTag: 2})
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := pool.Drain(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Drain = %v, want DeadlineExceeded", err)
+	}
+	select {
+	case <-submitted:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Submit still blocked after the drain")
+	}
+	if got := ack.outcomes()[2]; len(got) != 1 || got[0] != "nack" {
+		t.Fatalf("blocked delivery settled %v, want [nack]", got)
+	}
+
+	close(release)
+	waitFor(t, "the held delivery to be acked", func() bool { return len(ack.outcomes()[1]) == 1 })
+	// submitting after the drain must not panic either
+	pool.Submit(amqp.Delivery{Acknowledger: ack, DeliveryTag: 3})
+	if got := ack.outcomes()[3]; len(got) != 1 || got[0] != "nack" {
+		t.Fatalf("late delivery settled %v, want [nack]", got)
+	}
+}
@@ -0,0 +1,29 @@
+package server
+
+import (
+	"handyhub-email-svc/internal/queue"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+func SetupConsumerRoutes(router *gin.Engine, workers *queue.WorkerPool) {
+	router.GET("/api/v1/consumer/workers", func(c *gin.Context) {
+		stats := workers.Stats()
+		var busy int
+		var processed, failed int64
+		for _, worker := range stats {
+			if worker.Busy {
+				busy++
+			}
+			processed += worker.Processed
+			failed += worker.Failed
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"workers":   stats,
+			"busy":      busy,
+			"processed": processed,
+			"failed":    failed,
+		})
+	})
+}
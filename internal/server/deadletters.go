@@ -0,0 +1,91 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"handyhub-email-svc/internal/models"
+	"handyhub-email-svc/internal/queue"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultDeadLetterPageSize = 50
+	maxDeadLetterPageSize     = 500
+)
+
+func SetupDeadLetterRoutes(router *gin.Engine, rabbitMQ *queue.RabbitMQ) {
+	group := router.Group("/api/v1/dead-letters")
+
+	group.GET("", func(c *gin.Context) {
+		limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultDeadLetterPageSize)))
+		if err != nil || limit <= 0 || limit > maxDeadLetterPageSize {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit"})
+			return
+		}
+
+		letters, err := rabbitMQ.ListDeadLetters(limit)
+		if err != nil {
+			respondDeadLetterError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"dead_letters": letters, "limit": limit})
+	})
+
+	group.GET("/:id", func(c *gin.Context) {
+		letter, err := rabbitMQ.GetDeadLetter(c.Param("id"))
+		if err != nil {
+			respondDeadLetterError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, letter)
+	})
+
+	// the optional body is an edited queue message replacing the original
+	group.POST("/:id/replay", func(c *gin.Context) {
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "failed to read body"})
+			return
+		}
+		if len(body) == 0 {
+			body = nil
+		} else if err := json.Unmarshal(body, &models.QueueMessage{}); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid queue message: " + err.Error()})
+			return
+		}
+
+		id := c.Param("id")
+		if err := rabbitMQ.ReplayDeadLetter(id, body); err != nil {
+			respondDeadLetterError(c, err)
+			return
+		}
+		logger.WithField("id", id).WithField("edited", body != nil).Info("Dead letter replayed")
+		c.JSON(http.StatusOK, gin.H{"id": id, "replayed": true})
+	})
+
+	group.DELETE("", func(c *gin.Context) {
+		count, err := rabbitMQ.PurgeDeadLetters()
+		if err != nil {
+			respondDeadLetterError(c, err)
+			return
+		}
+		logger.WithField("count", count).Warn("Dead letters purged")
+		c.JSON(http.StatusOK, gin.H{"purged": count})
+	})
+}
+
+func respondDeadLetterError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, queue.ErrDeadLetterNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, queue.ErrDisconnected):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+	default:
+		logger.WithError(err).Error("Dead letter request failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "dead letter request failed"})
+	}
+}
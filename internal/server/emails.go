@@ -0,0 +1,117 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"handyhub-email-svc/internal/models"
+	"handyhub-email-svc/internal/queue"
+	"handyhub-email-svc/internal/storage"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+const maxBatchSize = 100
+
+type batchRequest struct {
+	Messages []*models.QueueMessage `json:"messages" binding:"required"`
+}
+
+type batchResult struct {
+	Index      int    `json:"index"`
+	TrackingID string `json:"tracking_id,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// SetupEmailRoutes serves /api/v1/emails, the HTTP alternative to publishing
+// queue messages directly. Accepted messages are processed by the consumer
+// like any other, their logs are found by the returned tracking ID.
+func SetupEmailRoutes(router *gin.Engine, rabbitMQ *queue.RabbitMQ, emailStorage storage.EmailStorage) {
+	group := router.Group("/api/v1/emails")
+
+	group.POST("", func(c *gin.Context) {
+		var message models.QueueMessage
+		if err := c.ShouldBindJSON(&message); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := queue.ValidateMessage(&message); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		trackingID, err := rabbitMQ.Enqueue(&message)
+		if err != nil {
+			logger.WithError(err).Error("Failed to enqueue email")
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "failed to enqueue email"})
+			return
+		}
+		logger.WithField("tracking_id", trackingID).Info("Email enqueued")
+		c.JSON(http.StatusAccepted, gin.H{"tracking_id": trackingID})
+	})
+
+	// the whole batch is validated before anything is published, a publish
+	// failure midway is reported per message
+	group.POST("/batch", func(c *gin.Context) {
+		var request batchRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if len(request.Messages) == 0 || len(request.Messages) > maxBatchSize {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("a batch holds 1 to %d messages", maxBatchSize)})
+			return
+		}
+
+		var invalid []batchResult
+		for i, message := range request.Messages {
+			if message == nil {
+				invalid = append(invalid, batchResult{Index: i, Error: "message is null"})
+				continue
+			}
+			if err := queue.ValidateMessage(message); err != nil {
+				invalid = append(invalid, batchResult{Index: i, Error: err.Error()})
+			}
+		}
+		if len(invalid) > 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid messages", "results": invalid})
+			return
+		}
+
+		results := make([]batchResult, len(request.Messages))
+		accepted := 0
+		for i, message := range request.Messages {
+			results[i].Index = i
+			trackingID, err := rabbitMQ.Enqueue(message)
+			if err != nil {
+				logger.WithError(err).WithField("index", i).Error("Failed to enqueue email")
+				results[i].Error = "failed to enqueue email"
+				continue
+			}
+			results[i].TrackingID = trackingID
+			accepted++
+		}
+		logger.WithField("accepted", accepted).WithField("total", len(results)).Info("Email batch enqueued")
+
+		status := http.StatusAccepted
+		if accepted == 0 {
+			status = http.StatusServiceUnavailable
+		}
+		c.JSON(status, gin.H{"accepted": accepted, "results": results})
+	})
+
+	group.GET("/:tracking_id", func(c *gin.Context) {
+		trackingID := c.Param("tracking_id")
+		logs, err := emailStorage.FindByTrackingID(trackingID)
+		if err != nil && !errors.Is(err, storage.ErrNotFound) {
+			logger.WithError(err).WithField("tracking_id", trackingID).Error("Failed to find email logs")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to find email logs"})
+			return
+		}
+		if len(logs) == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "no email logs for tracking ID, the message may still be queued"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"tracking_id": trackingID, "logs": logs})
+	})
+}
@@ -0,0 +1,225 @@
+package server
+
+import (
+	"errors"
+	"handyhub-email-svc/internal/preferences"
+	"html/template"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+const pageLayout = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>Email preferences</title>
+<style>
+body{font-family:Arial,Helvetica,sans-serif;background:#f4f4f5;color:#18181b;margin:0;padding:40px 16px}
+main{max-width:480px;margin:0 auto;background:#fff;border-radius:8px;padding:32px}
+h1{font-size:22px;margin:0 0 16px}
+label{display:block;margin:12px 0}
+small{display:block;color:#71717a;margin-left:24px}
+button{background:#18181b;color:#fff;border:0;border-radius:6px;padding:10px 18px;font-size:15px;cursor:pointer}
+.notice{background:#ecfdf5;color:#065f46;padding:10px 12px;border-radius:6px}
+</style>
+</head>
+<body><main>{{template "content" .}}</main></body>
+</html>`
+
+var unsubscribePage = template.Must(template.Must(template.New("unsubscribe").Parse(pageLayout)).Parse(`{{define "content"}}
+{{if .Done}}
+<h1>You are unsubscribed</h1>
+<p>{{.Address}} will no longer receive {{.Category}} emails.</p>
+{{else}}
+<h1>Unsubscribe</h1>
+<p>Stop sending {{.Category}} emails to {{.Address}}?</p>
+<form method="post"><button type="submit">Unsubscribe</button></form>
+{{end}}
+<p><a href="/preferences/{{.Token}}">Manage all email preferences</a></p>
+{{end}}`))
+
+var preferencesPage = template.Must(template.Must(template.New("preferences").Parse(pageLayout)).Parse(`{{define "content"}}
+<h1>Email preferences</h1>
+<p>Choose which emails {{.Address}} receives.</p>
+{{if .Saved}}<p class="notice">Your preferences have been saved.</p>{{end}}
+<form method="post">
+{{range .Categories}}
+<label><input type="checkbox" name="category" value="{{.Name}}"{{if .Subscribed}} checked{{end}}{{if .Required}} disabled{{end}}> {{.Name}}
+<small>{{.Description}}{{if .Required}} (always sent){{end}}</small></label>
+{{end}}
+<button type="submit">Save preferences</button>
+</form>
+{{end}}`))
+
+type preferencesRequest struct {
+	Categories map[string]bool `json:"categories" binding:"required"`
+}
+
+func SetupPreferenceRoutes(router *gin.Engine, service *preferences.Service) {
+	router.GET("/unsubscribe/:token", func(c *gin.Context) {
+		renderUnsubscribe(c, service, false)
+	})
+
+	// also the RFC 8058 one-click target of the List-Unsubscribe header
+	router.POST("/unsubscribe/:token", func(c *gin.Context) {
+		address, category, err := service.Resolve(c.Param("token"))
+		if err != nil || category == "" {
+			renderPreferenceError(c, err)
+			return
+		}
+		if err := service.Unsubscribe(address, category); err != nil {
+			renderPreferenceError(c, err)
+			return
+		}
+		if c.PostForm("List-Unsubscribe") == "One-Click" {
+			c.String(http.StatusOK, "Unsubscribed")
+			return
+		}
+		renderUnsubscribe(c, service, true)
+	})
+
+	router.GET("/preferences/:token", func(c *gin.Context) {
+		renderPreferences(c, service, false)
+	})
+
+	router.POST("/preferences/:token", func(c *gin.Context) {
+		address, _, err := service.Resolve(c.Param("token"))
+		if err != nil {
+			renderPreferenceError(c, err)
+			return
+		}
+		states, err := service.States(address)
+		if err != nil {
+			renderPreferenceError(c, err)
+			return
+		}
+
+		checked := make(map[string]bool)
+		for _, name := range c.PostFormArray("category") {
+			checked[name] = true
+		}
+		subscribed := make(map[string]bool, len(states))
+		for _, state := range states {
+			if !state.Required {
+				subscribed[state.Name] = checked[state.Name]
+			}
+		}
+		if err := service.Update(address, subscribed); err != nil {
+			renderPreferenceError(c, err)
+			return
+		}
+		renderPreferences(c, service, true)
+	})
+
+	api := router.Group("/api/v1/preferences")
+
+	api.GET("/:token", func(c *gin.Context) {
+		address, _, err := service.Resolve(c.Param("token"))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		respondPreferences(c, service, address)
+	})
+
+	api.PUT("/:token", func(c *gin.Context) {
+		address, _, err := service.Resolve(c.Param("token"))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+
+		var request preferencesRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		err = service.Update(address, request.Categories)
+		if errors.Is(err, preferences.ErrUnknownCategory) || errors.Is(err, preferences.ErrRequired) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			logger.WithError(err).Error("Failed to update email preferences")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update preferences"})
+			return
+		}
+		respondPreferences(c, service, address)
+	})
+}
+
+func respondPreferences(c *gin.Context, service *preferences.Service, address string) {
+	states, err := service.States(address)
+	if err != nil {
+		logger.WithError(err).Error("Failed to load email preferences")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load preferences"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"address": address, "categories": states})
+}
+
+func renderUnsubscribe(c *gin.Context, service *preferences.Service, done bool) {
+	token := c.Param("token")
+	address, category, err := service.Resolve(token)
+	if err != nil {
+		renderPreferenceError(c, err)
+		return
+	}
+	if category == "" {
+		c.Redirect(http.StatusSeeOther, "/preferences/"+token)
+		return
+	}
+
+	description := category
+	if configured, ok := service.Category(category); ok && configured.Description != "" {
+		description = configured.Description
+	}
+	renderPage(c, http.StatusOK, unsubscribePage, gin.H{
+		"Address":  address,
+		"Category": description,
+		"Token":    token,
+		"Done":     done,
+	})
+}
+
+func renderPreferences(c *gin.Context, service *preferences.Service, saved bool) {
+	address, _, err := service.Resolve(c.Param("token"))
+	if err != nil {
+		renderPreferenceError(c, err)
+		return
+	}
+	states, err := service.States(address)
+	if err != nil {
+		renderPreferenceError(c, err)
+		return
+	}
+	renderPage(c, http.StatusOK, preferencesPage, gin.H{
+		"Address":    address,
+		"Categories": states,
+		"Saved":      saved,
+	})
+}
+
+func renderPreferenceError(c *gin.Context, err error) {
+	switch {
+	case err == nil, errors.Is(err, preferences.ErrInvalidToken):
+		c.String(http.StatusNotFound, "This link is invalid.")
+	case errors.Is(err, preferences.ErrUnknownCategory), errors.Is(err, preferences.ErrRequired):
+		c.String(http.StatusBadRequest, "These emails cannot be unsubscribed.")
+	default:
+		logger.WithError(err).Error("Failed to handle email preferences")
+		c.String(http.StatusInternalServerError, "Something went wrong, please try again later.")
+	}
+}
+
+func renderPage(c *gin.Context, status int, page *template.Template, data gin.H) {
+	c.Header("Cache-Control", "no-store")
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	c.Status(status)
+	if err := page.Execute(c.Writer, data); err != nil {
+		logger.WithError(err).Error("Failed to render page")
+	}
+}
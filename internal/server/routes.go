@@ -13,14 +13,28 @@ import (
 
 var logger = logrus.StandardLogger()
 
-func SetupRoutes(router *gin.Engine, cfg *config.Configuration, emailStorage storage.EmailStorage) {
+// HealthCheck reports why a dependency is unavailable, nil when it is up.
+type HealthCheck func() error
+
+func SetupRoutes(router *gin.Engine, cfg *config.Configuration, emailStorage storage.EmailStorage, checks map[string]HealthCheck) {
 
 	// Health endpoint
 	router.GET("/health", func(c *gin.Context) {
 		logrus.Info("Health check requested")
-		c.JSON(200, gin.H{
-			"status":  "ok",
+		status, code := "ok", 200
+		results := gin.H{}
+		for name, check := range checks {
+			if err := check(); err != nil {
+				status, code = "unavailable", 503
+				results[name] = err.Error()
+				continue
+			}
+			results[name] = "ok"
+		}
+		c.JSON(code, gin.H{
+			"status":  status,
 			"service": "email-service",
+			"checks":  results,
 		})
 	})
 
@@ -3,11 +3,20 @@ package server
 import (
 	"context"
 	"errors"
+	"handyhub-email-svc/internal/bounce"
 	"handyhub-email-svc/internal/config"
 	"handyhub-email-svc/internal/database"
+	"handyhub-email-svc/internal/delivery"
+	"handyhub-email-svc/internal/idempotency"
+	"handyhub-email-svc/internal/preferences"
 	"handyhub-email-svc/internal/queue"
 	"handyhub-email-svc/internal/smtp"
 	"handyhub-email-svc/internal/storage"
+	"handyhub-email-svc/internal/suppression"
+	"handyhub-email-svc/internal/templates"
+	"handyhub-email-svc/internal/tracking"
+	"handyhub-email-svc/internal/validation"
+	"handyhub-email-svc/internal/webhook"
 	"net/http"
 	"os"
 	"os/signal"
@@ -16,18 +25,32 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
+	"github.com/streadway/amqp"
 )
 
 var log = logrus.StandardLogger()
 
 type Server struct {
-	httpServer     *http.Server
-	config         *config.Configuration
-	mongodb        *database.MongoDB
-	emailStorage   storage.EmailStorage
-	rabbitMQ       *queue.RabbitMQ
-	emailProcessor *queue.EmailProcessor
-	smtpProvider   smtp.SMTPProvider
+	httpServer   *http.Server
+	config       *config.Configuration
+	mongodb      *database.MongoDB
+	emailStorage storage.EmailStorage
+	rabbitMQ     *queue.RabbitMQ
+	workers      *queue.WorkerPool
+	consumerDone chan struct{}
+	// stopping is closed on shutdown, cutting requeue pauses short
+	stopping         chan struct{}
+	emailProcessor   *queue.EmailProcessor
+	smtpProviders    *smtp.ProviderRegistry
+	webhookService   *webhook.Service
+	deliveryRecorder *delivery.Recorder
+	bounceProcessor  *bounce.Processor
+	suppressions     *suppression.Service
+	idempotency      *idempotency.Service
+	tracker          *tracking.Service
+	preferences      *preferences.Service
+	templates        *templates.Renderer
+	templateStore    templates.Store
 }
 
 func New(cfg *config.Configuration) *Server {
@@ -43,14 +66,34 @@ func (s *Server) Start() error {
 	if err := s.initEmailStorage(); err != nil {
 		return err
 	}
-	if err := s.initSMTPProvider(); err != nil {
+	if err := s.initSuppressions(); err != nil {
+		return err
+	}
+	if err := s.initTracking(); err != nil {
+		return err
+	}
+	if err := s.initPreferences(); err != nil {
+		return err
+	}
+	if err := s.initTemplates(); err != nil {
+		return err
+	}
+	if err := s.initIdempotency(); err != nil {
+		return err
+	}
+	if err := s.initSMTPProviders(); err != nil {
 		return err
 	}
 	if err := s.initRabbitMQ(); err != nil {
 		return err
 	}
-	s.emailProcessor = queue.NewProcessor(s.emailStorage, s.smtpProvider)
-	go s.startMessageConsumer()
+	s.deliveryRecorder = delivery.NewRecorder(s.emailStorage, s.suppressions)
+	if err := s.initWebhooks(); err != nil {
+		return err
+	}
+	s.startBounceProcessor()
+	s.emailProcessor = queue.NewProcessor(s.config, s.emailStorage, s.smtpProviders, s.newValidator(), s.suppressions, s.tracker, s.preferences, s.templates, s.eventPublisher(), s.idempotency)
+	s.startMessageConsumer()
 
 	if err := s.setupHTTPServer(); err != nil {
 		return err
@@ -68,7 +111,7 @@ func (s *Server) Start() error {
 }
 
 func (s *Server) initMongoDB() error {
-	if s.config.Storage.Type == "database" {
+	if s.config.Storage.Type == "database" || (s.config.Templates.Enabled && s.config.Templates.Source == "database") {
 		mongodb, err := database.NewMongoDB(*s.config)
 		if err != nil {
 			log.WithError(err).Fatal("Failed to initialize MongoDB")
@@ -91,17 +134,96 @@ func (s *Server) initEmailStorage() error {
 	return nil
 }
 
-func (s *Server) initSMTPProvider() error {
-	log.WithField("provider", s.config.SMTP.Provider).Info("Initializing SMTP Provider...")
-	smtpProvider, err := smtp.NewSMTPProvider(s.config.SMTP)
+func (s *Server) initSuppressions() error {
+	if !s.config.Suppression.Enabled {
+		log.Info("Suppression list disabled")
+		return nil
+	}
+	store, err := suppression.NewStore(s.config, s.mongodb)
+	if err != nil {
+		log.WithError(err).Fatal("Failed to initialize Suppression Store")
+		return err
+	}
+	s.suppressions = suppression.NewService(s.config.Suppression, store)
+	return nil
+}
+
+func (s *Server) initIdempotency() error {
+	if !s.config.Idempotency.Enabled {
+		log.Info("Idempotency keys disabled")
+		return nil
+	}
+	store, err := idempotency.NewStore(s.config, s.mongodb)
+	if err != nil {
+		log.WithError(err).Fatal("Failed to initialize Idempotency Store")
+		return err
+	}
+	s.idempotency = idempotency.NewService(s.config.Idempotency, store)
+	return nil
+}
+
+func (s *Server) initTracking() error {
+	if !s.config.Tracking.Enabled {
+		log.Info("Open and click tracking disabled")
+		return nil
+	}
+	tracker, err := tracking.NewService(s.config.Tracking, s.emailStorage)
 	if err != nil {
-		log.WithError(err).Fatal("Failed to initialize SMTP Provider")
+		log.WithError(err).Fatal("Failed to initialize tracking")
 		return err
 	}
-	s.smtpProvider = smtpProvider
+	s.tracker = tracker
 	return nil
 }
 
+func (s *Server) initPreferences() error {
+	if !s.config.Preferences.Enabled {
+		log.Info("Email preferences disabled")
+		return nil
+	}
+	service, err := preferences.NewService(s.config.Preferences, preferences.NewStore(s.config, s.mongodb))
+	if err != nil {
+		log.WithError(err).Fatal("Failed to initialize email preferences")
+		return err
+	}
+	s.preferences = service
+	return nil
+}
+
+func (s *Server) initTemplates() error {
+	if !s.config.Templates.Enabled {
+		log.Info("Server-side templates disabled")
+		return nil
+	}
+	store, err := templates.NewStore(s.config.Templates, s.mongodb)
+	if err != nil {
+		log.WithError(err).Fatal("Failed to initialize Template Store")
+		return err
+	}
+	s.templateStore = store
+	s.templates = templates.NewRenderer(store, time.Duration(s.config.Templates.CacheTTL)*time.Second, s.config.Templates.DefaultLocale)
+	return nil
+}
+
+func (s *Server) initSMTPProviders() error {
+	log.WithField("default", s.config.SMTP.Provider).Info("Initializing SMTP Providers...")
+	smtpProviders, err := smtp.NewSMTPProviders(s.config.SMTP)
+	if err != nil {
+		log.WithError(err).Fatal("Failed to initialize SMTP Providers")
+		return err
+	}
+	s.smtpProviders = smtpProviders
+	return nil
+}
+
+func (s *Server) newValidator() *validation.Validator {
+	if !s.config.Validation.Enabled {
+		log.Info("Recipient validation disabled")
+		return nil
+	}
+	return validation.NewValidator(s.config.Validation, nil)
+}
+
 func (s *Server) initRabbitMQ() error {
 	rabbitmq, err := queue.NewRabbitMQ(&s.config.Queue.RabbitMQ)
 	if err != nil {
@@ -116,10 +238,59 @@ func (s *Server) initRabbitMQ() error {
 	return nil
 }
 
+func (s *Server) eventPublisher() queue.EventPublisher {
+	if !s.config.Queue.RabbitMQ.Events.Enabled {
+		log.Info("Email events disabled")
+		return nil
+	}
+	return s.rabbitMQ
+}
+
+func (s *Server) initWebhooks() error {
+	webhookService, err := webhook.NewService(s.config.Webhooks, s.deliveryRecorder)
+	if err != nil {
+		log.WithError(err).Fatal("Failed to initialize delivery webhooks")
+		return err
+	}
+	s.webhookService = webhookService
+	return nil
+}
+
+func (s *Server) startBounceProcessor() {
+	if !s.config.Bounces.Enabled {
+		log.Info("Bounce processing disabled")
+		return
+	}
+	s.bounceProcessor = bounce.NewProcessor(s.config.Bounces, s.deliveryRecorder)
+	s.bounceProcessor.Start()
+}
+
 func (s *Server) setupHTTPServer() error {
 	gin.SetMode(s.config.Server.Mode)
 	router := gin.Default()
-	SetupRoutes(router, s.config, s.emailStorage)
+	SetupRoutes(router, s.config, s.emailStorage, map[string]HealthCheck{
+		"rabbitmq": s.rabbitMQ.Check,
+	})
+	SetupWebhookRoutes(router, s.webhookService)
+	SetupEmailRoutes(router, s.rabbitMQ, s.emailStorage)
+	if s.suppressions != nil {
+		SetupSuppressionRoutes(router, s.suppressions)
+	}
+	if s.tracker != nil {
+		SetupTrackingRoutes(router, s.tracker)
+	}
+	if s.preferences != nil {
+		SetupPreferenceRoutes(router, s.preferences)
+	}
+	if s.rabbitMQ.DeadLetterEnabled() {
+		SetupDeadLetterRoutes(router, s.rabbitMQ)
+	}
+	SetupConsumerRoutes(router, s.workers)
+	// directory templates are managed as files, only stored ones have an API
+	if versionStore, ok := s.templateStore.(templates.VersionStore); ok {
+		SetupTemplateRoutes(router, versionStore, s.templates)
+		SetupPartialRoutes(router, versionStore, s.templates)
+	}
 	s.httpServer = &http.Server{
 		Addr:         s.config.Server.Port,
 		Handler:      router,
@@ -141,43 +312,151 @@ func (s *Server) waitForShutdown() {
 	s.Shutdown()
 }
 
+// startMessageConsumer feeds deliveries to a pool of workers. More workers
+// than prefetch-count would never get a message.
 func (s *Server) startMessageConsumer() {
-	log.Info("Starting message consumer...")
-	messages, err := s.rabbitMQ.ConsumeMessages()
+	rabbitCfg := s.config.Queue.RabbitMQ
+	workers := rabbitCfg.Workers
+	if rabbitCfg.PrefetchCount > 0 && workers > rabbitCfg.PrefetchCount {
+		log.Warnf("Limiting message workers to prefetch-count %d", rabbitCfg.PrefetchCount)
+		workers = rabbitCfg.PrefetchCount
+	}
+	s.workers = queue.NewWorkerPool(workers, s.handleDelivery)
+	s.consumerDone = make(chan struct{})
+	s.stopping = make(chan struct{})
 
+	go func() {
+		defer close(s.consumerDone)
+		log.Info("Starting message consumer...")
+		s.rabbitMQ.Consume(s.workers.Submit)
+		log.Info("Message consumer stopped")
+	}()
+}
+
+// handleDelivery processes and acknowledges one delivery, the returned error
+// only feeds the worker stats.
+func (s *Server) handleDelivery(msg amqp.Delivery) error {
+	log.Info("Received a new message")
+
+	queueMessage, err := s.rabbitMQ.ParseMessage(msg.Body)
 	if err != nil {
-		log.WithError(err).Fatal("Failed to start consuming messages")
+		log.WithError(err).Error("Failed to parse message, rejecting...")
+		s.rejectDelivery(msg, queue.StageParse, err)
+		return err
+	}
+
+	attempt := queue.Attempt(msg)
+	queueMessage.Attempt = attempt
+	queueMessage.LogID = queue.LogID(msg)
+	if queueMessage.IdempotencyKey == "" {
+		queueMessage.IdempotencyKey = msg.MessageId
+	}
+	if err := s.emailProcessor.ProcessMessage(queueMessage); err != nil {
+		s.retryDelivery(msg, attempt, err)
+		return err
+	}
+
+	msg.Ack(false)
+	log.Info("Message processed and acknowledged")
+	return nil
+}
+
+// drainConsumer stops consuming and waits for the workers to finish the
+// messages in flight, unfinished ones are redelivered by the broker.
+func (s *Server) drainConsumer() {
+	if s.workers == nil {
 		return
 	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(s.config.Queue.RabbitMQ.DrainTimeout)*time.Second)
+	defer cancel()
 
-	for msg := range messages {
-		log.Info("Received a new message")
+	close(s.stopping)
+	s.rabbitMQ.StopConsuming()
+	select {
+	case <-s.consumerDone:
+	case <-ctx.Done():
+	}
+	if err := s.workers.Drain(ctx); err != nil {
+		log.WithError(err).Warn("Message workers did not finish in time")
+	}
+}
 
-		queueMessage, err := s.rabbitMQ.ParseMessage(msg.Body)
-		if err != nil {
-			log.WithError(err).Error("Failed to parse message, rejecting...")
-			msg.Nack(false, false)
-			continue
+// retryDelivery schedules a failed message for a delayed retry, or rejects it
+// once its attempts are used up. Deferred messages keep their attempt.
+func (s *Server) retryDelivery(msg amqp.Delivery, attempt int, cause error) {
+	entry := log.WithError(cause).WithField("attempt", attempt)
+	var deferErr *queue.DeferError
+	if errors.As(cause, &deferErr) {
+		if err := s.rabbitMQ.Defer(msg, deferErr.Delay); err != nil {
+			entry.WithError(err).Error("Failed to defer message, requeueing...")
+			s.requeueDelivery(msg)
+			return
 		}
+		msg.Ack(false)
+		return
+	}
+	if !s.config.Queue.RabbitMQ.Retry.Enabled {
+		entry.Error("Failed to process message, requeueing...")
+		s.requeueDelivery(msg)
+		return
+	}
+	if !s.rabbitMQ.CanRetry(attempt) {
+		entry.Error("Failed to process message, no attempts left, rejecting...")
+		s.rejectDelivery(msg, queue.StageProcess, cause)
+		return
+	}
 
-		if err := s.emailProcessor.ProcessMessage(queueMessage); err != nil {
-			log.WithError(err).Error("Failed to process message, rejecting...")
-			msg.Nack(false, true)
-			continue
-		}
+	var logID string
+	var retryErr *queue.RetryError
+	if errors.As(cause, &retryErr) {
+		logID = retryErr.LogID
+	}
+	if err := s.rabbitMQ.Retry(msg, attempt, logID); err != nil {
+		entry.WithError(err).Error("Failed to schedule retry, requeueing...")
+		s.requeueDelivery(msg)
+		return
+	}
+	entry.Warn("Failed to process message, retry scheduled")
+	msg.Ack(false)
+}
 
-		msg.Ack(false)
-		log.Info("Message processed and acknowledged")
+// requeueDelivery returns a message to the queue after a pause. Requeueing
+// right away would redeliver it in a hot loop.
+func (s *Server) requeueDelivery(msg amqp.Delivery) {
+	select {
+	case <-time.After(s.rabbitMQ.RequeueDelay()):
+	case <-s.stopping:
 	}
+	msg.Nack(false, true)
+}
 
-	log.Info("Message consumer stopped")
+// rejectDelivery moves a message that cannot be processed to the dead-letter
+// queue. If that fails the message is requeued after a pause rather than
+// dropped. Without dead-lettering it is rejected, a broker dead-letter
+// policy on the email queue still catches it.
+func (s *Server) rejectDelivery(msg amqp.Delivery, stage string, cause error) {
+	if !s.rabbitMQ.DeadLetterEnabled() {
+		msg.Nack(false, false)
+		return
+	}
+	if err := s.rabbitMQ.DeadLetter(msg, stage, cause); err != nil {
+		log.WithError(err).Error("Failed to publish dead letter, requeueing...")
+		s.requeueDelivery(msg)
+		return
+	}
+	msg.Ack(false)
 }
 
 func (s *Server) Shutdown() {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
+	if s.bounceProcessor != nil {
+		s.bounceProcessor.Stop()
+	}
+
 	if s.rabbitMQ != nil {
+		s.drainConsumer()
 		if err := s.rabbitMQ.Close(); err != nil {
 			log.WithError(err).Error("Error closing RabbitMQ connection")
 		} else {
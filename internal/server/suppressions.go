@@ -0,0 +1,120 @@
+package server
+
+import (
+	"errors"
+	"handyhub-email-svc/internal/models"
+	"handyhub-email-svc/internal/suppression"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultSuppressionPageSize = 100
+	maxSuppressionPageSize     = 1000
+)
+
+type suppressionRequest struct {
+	Address   string     `json:"address" binding:"required"`
+	Reason    string     `json:"reason"`
+	Note      string     `json:"note"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+func SetupSuppressionRoutes(router *gin.Engine, suppressions *suppression.Service) {
+	group := router.Group("/api/v1/suppressions")
+
+	group.GET("", func(c *gin.Context) {
+		offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+		if err != nil || offset < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid offset"})
+			return
+		}
+		limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultSuppressionPageSize)))
+		if err != nil || limit <= 0 || limit > maxSuppressionPageSize {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit"})
+			return
+		}
+
+		list, err := suppressions.List(offset, limit)
+		if err != nil {
+			logger.WithError(err).Error("Failed to list suppressions")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list suppressions"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"suppressions": list, "offset": offset, "limit": limit})
+	})
+
+	group.GET("/:address", func(c *gin.Context) {
+		address, err := suppression.Normalize(c.Param("address"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		found, err := suppressions.Get(address)
+		if errors.Is(err, suppression.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			logger.WithError(err).WithField("address", address).Error("Failed to get suppression")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get suppression"})
+			return
+		}
+		c.JSON(http.StatusOK, found)
+	})
+
+	group.POST("", func(c *gin.Context) {
+		var request suppressionRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if request.Reason == "" {
+			request.Reason = models.SuppressionManual
+		}
+		if !models.IsSuppressionReason(request.Reason) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "unknown suppression reason"})
+			return
+		}
+		if _, err := suppression.Normalize(request.Address); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if request.ExpiresAt != nil && !request.ExpiresAt.After(time.Now()) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "expires_at must be in the future"})
+			return
+		}
+
+		added, err := suppressions.Suppress(request.Address, request.Reason, request.Note, request.ExpiresAt)
+		if err != nil {
+			logger.WithError(err).WithField("address", request.Address).Error("Failed to add suppression")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to add suppression"})
+			return
+		}
+		c.JSON(http.StatusCreated, added)
+	})
+
+	group.DELETE("/:address", func(c *gin.Context) {
+		address, err := suppression.Normalize(c.Param("address"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		err = suppressions.Remove(address)
+		if errors.Is(err, suppression.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			logger.WithError(err).WithField("address", address).Error("Failed to remove suppression")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to remove suppression"})
+			return
+		}
+		c.Status(http.StatusNoContent)
+	})
+}
@@ -0,0 +1,280 @@
+package server
+
+import (
+	"errors"
+	"handyhub-email-svc/internal/models"
+	"handyhub-email-svc/internal/templates"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type publishRequest struct {
+	// Version defaults to the latest one
+	Version int `json:"version"`
+}
+
+type previewRequest struct {
+	// Version defaults to the latest one
+	Version int            `json:"version"`
+	Locale  string         `json:"locale"`
+	Data    map[string]any `json:"data"`
+}
+
+func SetupTemplateRoutes(router *gin.Engine, store templates.VersionStore, renderer *templates.Renderer) {
+	group := router.Group("/api/v1/templates")
+
+	group.GET("", func(c *gin.Context) {
+		records, err := store.List()
+		if err != nil {
+			respondTemplateError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"templates": records})
+	})
+
+	group.POST("", func(c *gin.Context) {
+		var tmpl models.EmailTemplate
+		if !bindTemplate(c, renderer, &tmpl) {
+			return
+		}
+		if tmpl.ID == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "id is required"})
+			return
+		}
+
+		created, err := store.Create(&tmpl)
+		if err != nil {
+			respondTemplateError(c, err)
+			return
+		}
+		logger.WithField("template_id", created.ID).Info("Template created")
+		c.JSON(http.StatusCreated, created)
+	})
+
+	group.GET("/:id", func(c *gin.Context) {
+		record, err := store.Record(c.Param("id"))
+		if err != nil {
+			respondTemplateError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, record)
+	})
+
+	// every update is stored as a new draft version
+	group.PUT("/:id", func(c *gin.Context) {
+		var tmpl models.EmailTemplate
+		if !bindTemplate(c, renderer, &tmpl) {
+			return
+		}
+		tmpl.ID = c.Param("id")
+
+		version, err := store.AddVersion(&tmpl)
+		if err != nil {
+			respondTemplateError(c, err)
+			return
+		}
+		logger.WithField("template_id", version.ID).Infof("Template version %d saved", version.Version)
+		c.JSON(http.StatusCreated, version)
+	})
+
+	group.GET("/:id/versions/:version", func(c *gin.Context) {
+		version, err := strconv.Atoi(c.Param("version"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid version"})
+			return
+		}
+		tmpl, err := findVersion(store, c.Param("id"), version)
+		if err != nil {
+			respondTemplateError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, tmpl)
+	})
+
+	group.POST("/:id/publish", func(c *gin.Context) {
+		var request publishRequest
+		if c.Request.ContentLength != 0 {
+			if err := c.ShouldBindJSON(&request); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+		id := c.Param("id")
+		tmpl, err := findVersion(store, id, request.Version)
+		if err != nil {
+			respondTemplateError(c, err)
+			return
+		}
+
+		if err := store.Publish(id, tmpl.Version); err != nil {
+			respondTemplateError(c, err)
+			return
+		}
+		renderer.Invalidate(id)
+		logger.WithField("template_id", id).Infof("Template version %d published", tmpl.Version)
+		c.JSON(http.StatusOK, gin.H{"id": id, "published_version": tmpl.Version})
+	})
+
+	group.POST("/:id/rollback", func(c *gin.Context) {
+		id := c.Param("id")
+		version, err := store.Rollback(id)
+		if err != nil {
+			respondTemplateError(c, err)
+			return
+		}
+		renderer.Invalidate(id)
+		logger.WithField("template_id", id).Infof("Template rolled back to version %d", version)
+		c.JSON(http.StatusOK, gin.H{"id": id, "published_version": version})
+	})
+
+	group.POST("/:id/preview", func(c *gin.Context) {
+		var request previewRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		tmpl, err := findVersion(store, c.Param("id"), request.Version)
+		if err != nil {
+			respondTemplateError(c, err)
+			return
+		}
+
+		rendered, err := renderer.RenderTemplate(tmpl, request.Locale, request.Data, templates.Links{
+			Unsubscribe: "#unsubscribe",
+			Preferences: "#preferences",
+		})
+		if err != nil {
+			respondTemplateError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"id":      tmpl.ID,
+			"version": tmpl.Version,
+			"locale":  rendered.Locale,
+			"subject": rendered.Subject,
+			"html":    rendered.HTML,
+			"text":    rendered.Text,
+		})
+	})
+}
+
+// SetupPartialRoutes serves /api/v1/layouts and /api/v1/partials. They are
+// not versioned, a change applies to every template using them.
+func SetupPartialRoutes(router *gin.Engine, store templates.VersionStore, renderer *templates.Renderer) {
+	for kind, path := range map[string]string{
+		templates.KindLayout:  "/api/v1/layouts",
+		templates.KindPartial: "/api/v1/partials",
+	} {
+		group := router.Group(path)
+
+		group.GET("", func(c *gin.Context) {
+			partials, err := store.ListPartials(kind)
+			if err != nil {
+				respondTemplateError(c, err)
+				return
+			}
+			c.JSON(http.StatusOK, gin.H{kind + "s": partials})
+		})
+
+		group.GET("/:name", func(c *gin.Context) {
+			partial, err := findPartial(store, kind, c.Param("name"))
+			if err != nil {
+				respondTemplateError(c, err)
+				return
+			}
+			c.JSON(http.StatusOK, partial)
+		})
+
+		group.PUT("/:name", func(c *gin.Context) {
+			var partial models.TemplatePartial
+			if err := c.ShouldBindJSON(&partial); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			partial.Name, partial.Kind = c.Param("name"), kind
+			if err := templates.ValidatePartial(&partial); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+
+			if err := store.SavePartial(&partial); err != nil {
+				respondTemplateError(c, err)
+				return
+			}
+			renderer.Reset()
+			logger.WithField("name", partial.Name).Infof("Template %s saved", kind)
+			c.JSON(http.StatusOK, partial)
+		})
+
+		group.DELETE("/:name", func(c *gin.Context) {
+			name := c.Param("name")
+			if err := store.DeletePartial(kind, name); err != nil {
+				respondTemplateError(c, err)
+				return
+			}
+			renderer.Reset()
+			logger.WithField("name", name).Infof("Template %s deleted", kind)
+			c.Status(http.StatusNoContent)
+		})
+	}
+}
+
+func findPartial(store templates.Store, kind, name string) (*models.TemplatePartial, error) {
+	if kind == templates.KindLayout {
+		return store.Layout(name)
+	}
+	return store.Partial(name)
+}
+
+// bindTemplate decodes and parses a template so broken drafts are rejected
+// before they are stored.
+func bindTemplate(c *gin.Context, renderer *templates.Renderer, tmpl *models.EmailTemplate) bool {
+	if err := c.ShouldBindJSON(tmpl); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+	tmpl.Version = 0
+	if err := renderer.Validate(tmpl); err != nil {
+		var renderErr *templates.RenderError
+		if !errors.As(err, &renderErr) {
+			respondTemplateError(c, err)
+			return false
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+	return true
+}
+
+// findVersion returns a version of a template, 0 selects the latest one.
+func findVersion(store templates.VersionStore, id string, version int) (*models.EmailTemplate, error) {
+	record, err := store.Record(id)
+	if err != nil {
+		return nil, err
+	}
+	if version == 0 {
+		version = record.LatestVersion
+	}
+	tmpl := record.Version(version)
+	if tmpl == nil {
+		return nil, templates.ErrVersionNotFound
+	}
+	return tmpl, nil
+}
+
+func respondTemplateError(c *gin.Context, err error) {
+	var renderErr *templates.RenderError
+	switch {
+	case errors.Is(err, templates.ErrNotFound), errors.Is(err, templates.ErrVersionNotFound), errors.Is(err, templates.ErrPartialNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, templates.ErrExists), errors.Is(err, templates.ErrNoRollback), errors.Is(err, templates.ErrConflict):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.As(err, &renderErr):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+	default:
+		logger.WithError(err).Error("Template request failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "template request failed"})
+	}
+}
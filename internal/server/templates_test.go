@@ -0,0 +1,187 @@
+package server
+
+import (
+	"errors"
+	"handyhub-email-svc/internal/models"
+	"handyhub-email-svc/internal/templates"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// fakeVersionStore keeps templates in memory. err, when set, fails every
+// call, rollbackErr only fails Rollback.
+type fakeVersionStore struct {
+	records     map[string]*models.TemplateRecord
+	err         error
+	rollbackErr error
+}
+
+func (s *fakeVersionStore) Get(id string) (*models.EmailTemplate, error) {
+	record, err := s.Record(id)
+	if err != nil {
+		return nil, err
+	}
+	if record.PublishedVersion == 0 {
+		return nil, templates.ErrNotFound
+	}
+	return record.Version(record.PublishedVersion), nil
+}
+
+func (s *fakeVersionStore) Layout(name string) (*models.TemplatePartial, error) {
+	return nil, templates.ErrPartialNotFound
+}
+
+func (s *fakeVersionStore) Partial(name string) (*models.TemplatePartial, error) {
+	return nil, templates.ErrPartialNotFound
+}
+
+func (s *fakeVersionStore) List() ([]*models.TemplateRecord, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	var records []*models.TemplateRecord
+	for _, record := range s.records {
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+func (s *fakeVersionStore) Record(id string) (*models.TemplateRecord, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	record, ok := s.records[id]
+	if !ok {
+		return nil, templates.ErrNotFound
+	}
+	return record, nil
+}
+
+func (s *fakeVersionStore) Create(tmpl *models.EmailTemplate) (*models.EmailTemplate, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	if _, ok := s.records[tmpl.ID]; ok {
+		return nil, templates.ErrExists
+	}
+	version := *tmpl
+	version.Version = 1
+	s.records[tmpl.ID] = &models.TemplateRecord{ID: tmpl.ID, LatestVersion: 1, Versions: []models.EmailTemplate{version}}
+	return &version, nil
+}
+
+func (s *fakeVersionStore) AddVersion(tmpl *models.EmailTemplate) (*models.EmailTemplate, error) {
+	record, err := s.Record(tmpl.ID)
+	if err != nil {
+		return nil, err
+	}
+	record.LatestVersion++
+	version := *tmpl
+	version.Version = record.LatestVersion
+	record.Versions = append(record.Versions, version)
+	return &version, nil
+}
+
+func (s *fakeVersionStore) Publish(id string, version int) error {
+	record, err := s.Record(id)
+	if err != nil {
+		return err
+	}
+	if record.Version(version) == nil {
+		return templates.ErrVersionNotFound
+	}
+	record.PublishedVersion = version
+	record.PublishHistory = append(record.PublishHistory, version)
+	return nil
+}
+
+func (s *fakeVersionStore) Rollback(id string) (int, error) {
+	record, err := s.Record(id)
+	if err != nil {
+		return 0, err
+	}
+	if s.rollbackErr != nil {
+		return 0, s.rollbackErr
+	}
+	if len(record.PublishHistory) < 2 {
+		return 0, templates.ErrNoRollback
+	}
+	record.PublishHistory = record.PublishHistory[:len(record.PublishHistory)-1]
+	record.PublishedVersion = record.PublishHistory[len(record.PublishHistory)-1]
+	return record.PublishedVersion, nil
+}
+
+func (s *fakeVersionStore) ListPartials(kind string) ([]*models.TemplatePartial, error) {
+	return nil, nil
+}
+
+func (s *fakeVersionStore) SavePartial(partial *models.TemplatePartial) error {
+	return nil
+}
+
+func (s *fakeVersionStore) DeletePartial(kind, name string) error {
+	return templates.ErrPartialNotFound
+}
+
+func TestTemplateRoutesErrors(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name   string
+		store  func(*fakeVersionStore)
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		{name: "unknown template", method: "GET", path: "/api/v1/templates/missing", status: http.StatusNotFound},
+		{name: "unknown version", method: "GET", path: "/api/v1/templates/welcome/versions/9", status: http.StatusNotFound},
+		{name: "publish unknown version", method: "POST", path: "/api/v1/templates/welcome/publish", body: `{"version": 9}`, status: http.StatusNotFound},
+		{name: "publish unknown template", method: "POST", path: "/api/v1/templates/missing/publish", status: http.StatusNotFound},
+		{name: "publish specific version", method: "POST", path: "/api/v1/templates/welcome/publish", body: `{"version": 1}`, status: http.StatusOK},
+		{name: "create existing", method: "POST", path: "/api/v1/templates", body: `{"id": "welcome", "subject": "Hi", "text": "Hi"}`, status: http.StatusConflict},
+		{name: "rollback without earlier publish", method: "POST", path: "/api/v1/templates/welcome/rollback", status: http.StatusConflict},
+		{
+			name:   "rollback conflict",
+			store:  func(s *fakeVersionStore) { s.rollbackErr = templates.ErrConflict },
+			method: "POST", path: "/api/v1/templates/welcome/rollback",
+			status: http.StatusConflict,
+		},
+		{name: "broken template", method: "PUT", path: "/api/v1/templates/welcome", body: `{"subject": "Hi", "text": "{{if}}"}`, status: http.StatusBadRequest},
+		{
+			name:   "store outage",
+			store:  func(s *fakeVersionStore) { s.err = errors.New("server selection timeout") },
+			method: "GET", path: "/api/v1/templates",
+			status: http.StatusInternalServerError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &fakeVersionStore{records: map[string]*models.TemplateRecord{}}
+			if _, err := store.Create(&models.EmailTemplate{ID: "welcome", Subject: "Hi", Text: "Hi"}); err != nil {
+				t.Fatal(err)
+			}
+			if err := store.Publish("welcome", 1); err != nil {
+				t.Fatal(err)
+			}
+			if tt.store != nil {
+				tt.store(store)
+			}
+			router := gin.New()
+			SetupTemplateRoutes(router, store, templates.NewRenderer(store, time.Minute, "en"))
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", "application/json")
+			router.ServeHTTP(w, r)
+			if w.Code != tt.status {
+				t.Errorf("%s %s = %d %s, want %d", tt.method, tt.path, w.Code, w.Body, tt.status)
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package server
+
+import (
+	"errors"
+	"handyhub-email-svc/internal/tracking"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// pixel is a transparent 1x1 GIF.
+var pixel = []byte{
+	0x47, 0x49, 0x46, 0x38, 0x39, 0x61, 0x01, 0x00, 0x01, 0x00, 0x80, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0xff, 0xff, 0xff, 0x21, 0xf9, 0x04, 0x01, 0x00, 0x00, 0x00, 0x00, 0x2c, 0x00, 0x00, 0x00, 0x00,
+	0x01, 0x00, 0x01, 0x00, 0x00, 0x02, 0x02, 0x44, 0x01, 0x00, 0x3b,
+}
+
+func SetupTrackingRoutes(router *gin.Engine, tracker *tracking.Service) {
+	// the pixel is served whatever happens, a broken image only hurts the email
+	router.GET("/t/o/:token", func(c *gin.Context) {
+		if err := tracker.Open(c.Param("token")); err != nil {
+			logger.WithError(err).Warn("Failed to record open")
+		}
+		c.Header("Cache-Control", "no-store, no-cache, must-revalidate, private")
+		c.Header("Pragma", "no-cache")
+		c.Data(http.StatusOK, "image/gif", pixel)
+	})
+
+	router.GET("/t/c/:token", func(c *gin.Context) {
+		target, err := tracker.Click(c.Param("token"))
+		if errors.Is(err, tracking.ErrInvalidToken) {
+			c.String(http.StatusNotFound, "Link not found")
+			return
+		}
+		if err != nil {
+			logger.WithError(err).Error("Failed to resolve tracked link")
+			c.String(http.StatusInternalServerError, "Link unavailable")
+			return
+		}
+		c.Header("Cache-Control", "no-store")
+		c.Redirect(http.StatusFound, target)
+	})
+}
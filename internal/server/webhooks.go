@@ -0,0 +1,57 @@
+package server
+
+import (
+	"errors"
+	"handyhub-email-svc/internal/webhook"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxWebhookBody limits provider payloads, SendGrid batches stay well below it.
+const maxWebhookBody = 5 << 20
+
+func SetupWebhookRoutes(router *gin.Engine, webhookService *webhook.Service) {
+	router.POST("/webhooks/:provider", func(c *gin.Context) {
+		provider := c.Param("provider")
+		source, ok := webhookService.Source(provider)
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "unknown webhook provider"})
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxWebhookBody))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "failed to read body"})
+			return
+		}
+
+		if err := source.Verify(c.Request, body); err != nil {
+			logger.WithError(err).WithField("provider", provider).Warn("Rejected webhook")
+			status := http.StatusBadRequest
+			if errors.Is(err, webhook.ErrUnauthorized) {
+				status = http.StatusUnauthorized
+			}
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+
+		events, err := source.Parse(body)
+		if err != nil {
+			logger.WithError(err).WithField("provider", provider).Warn("Invalid webhook payload")
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		applied, err := webhookService.Apply(events)
+		if err != nil {
+			logger.WithError(err).WithField("provider", provider).Error("Failed to apply delivery events")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to apply events"})
+			return
+		}
+
+		logger.WithField("provider", provider).Infof("Applied %d of %d delivery events", applied, len(events))
+		c.JSON(http.StatusOK, gin.H{"received": len(events), "applied": applied})
+	})
+}
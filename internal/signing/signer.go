@@ -0,0 +1,61 @@
+package signing
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrInvalidToken = errors.New("invalid token")
+
+// Signer issues URL-safe tokens carrying a JSON payload authenticated with
+// HMAC-SHA256. Tokens are not encrypted, the payload is readable by anyone.
+type Signer struct {
+	key []byte
+}
+
+func NewSigner(secret string) (*Signer, error) {
+	if len(secret) < 16 {
+		return nil, fmt.Errorf("signing secret must be at least 16 characters")
+	}
+	return &Signer{key: []byte(secret)}, nil
+}
+
+func (s *Signer) Sign(payload any) (string, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode token payload: %w", err)
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(data)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(s.mac(encoded)), nil
+}
+
+// Verify checks the token signature and decodes its payload into v.
+func (s *Signer) Verify(token string, v any) error {
+	encoded, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return ErrInvalidToken
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(mac, s.mac(encoded)) {
+		return ErrInvalidToken
+	}
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return ErrInvalidToken
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return ErrInvalidToken
+	}
+	return nil
+}
+
+func (s *Signer) mac(encoded string) []byte {
+	h := hmac.New(sha256.New, s.key)
+	h.Write([]byte(encoded))
+	return h.Sum(nil)
+}
@@ -0,0 +1,61 @@
+package signing
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+type payload struct {
+	URL string `json:"u"`
+}
+
+func TestSignerVerify(t *testing.T) {
+	signer, err := NewSigner("0123456789abcdef")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := NewSigner("fedcba9876543210")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := signer.Sign(payload{URL: "https://example.com/a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded, signature, _ := strings.Cut(token, ".")
+	forged, err := other.Sign(payload{URL: "https://evil.example/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	forgedPayload, _, _ := strings.Cut(forged, ".")
+
+	var got payload
+	if err := signer.Verify(token, &got); err != nil || got.URL != "https://example.com/a" {
+		t.Fatalf("Verify = %+v, %v, want the signed payload", got, err)
+	}
+
+	tests := map[string]string{
+		"signed with other secret": forged,
+		"payload swapped":          forgedPayload + "." + signature,
+		"signature truncated":      encoded + "." + signature[:len(signature)-2],
+		"signature missing":        encoded,
+		"signature empty":          encoded + ".",
+		"signature not base64":     encoded + ".!!",
+		"empty":                    "",
+	}
+	for name, token := range tests {
+		t.Run(name, func(t *testing.T) {
+			if err := signer.Verify(token, &payload{}); !errors.Is(err, ErrInvalidToken) {
+				t.Errorf("Verify = %v, want ErrInvalidToken", err)
+			}
+		})
+	}
+}
+
+func TestNewSignerShortSecret(t *testing.T) {
+	if _, err := NewSigner("short"); err == nil {
+		t.Error("NewSigner accepted a short secret")
+	}
+}
@@ -0,0 +1,299 @@
+package smime
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"fmt"
+	"math/big"
+	"sort"
+	"time"
+)
+
+var (
+	oidData                   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidSignedData             = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidEnvelopedData          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 3}
+	oidAttributeContentType   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidAttributeMessageDigest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	oidAttributeSigningTime   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 5}
+	oidSHA256                 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidRSAEncryption          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidECDSAWithSHA256        = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+	oidAES256CBC              = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+)
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue
+}
+
+type algorithmIdentifier struct {
+	Algorithm  asn1.ObjectIdentifier
+	Parameters asn1.RawValue `asn1:"optional"`
+}
+
+type issuerAndSerial struct {
+	Issuer       asn1.RawValue
+	SerialNumber *big.Int
+}
+
+type encapsulatedContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+}
+
+type signedData struct {
+	Version          int
+	DigestAlgorithms asn1.RawValue
+	ContentInfo      encapsulatedContentInfo
+	Certificates     asn1.RawValue `asn1:"tag:0"`
+	SignerInfos      asn1.RawValue
+}
+
+type signerInfo struct {
+	Version            int
+	IssuerAndSerial    issuerAndSerial
+	DigestAlgorithm    algorithmIdentifier
+	SignedAttributes   asn1.RawValue `asn1:"tag:0"`
+	SignatureAlgorithm algorithmIdentifier
+	Signature          []byte
+}
+
+type attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values asn1.RawValue
+}
+
+type envelopedData struct {
+	Version              int
+	RecipientInfos       asn1.RawValue
+	EncryptedContentInfo encryptedContentInfo
+}
+
+type keyTransRecipientInfo struct {
+	Version                int
+	IssuerAndSerial        issuerAndSerial
+	KeyEncryptionAlgorithm algorithmIdentifier
+	EncryptedKey           []byte
+}
+
+type encryptedContentInfo struct {
+	ContentType                asn1.ObjectIdentifier
+	ContentEncryptionAlgorithm algorithmIdentifier
+	EncryptedContent           []byte `asn1:"tag:0"`
+}
+
+// signDetached builds a DER encoded CMS SignedData (RFC 5652) over content
+// without embedding the content itself.
+func signDetached(content []byte, cert *x509.Certificate, chain []*x509.Certificate, key crypto.Signer) ([]byte, error) {
+	digest := sha256.Sum256(content)
+
+	attrs, err := encodeAttributes(
+		attributeOf(oidAttributeContentType, oidData),
+		attributeOf(oidAttributeMessageDigest, digest[:]),
+		attributeOf(oidAttributeSigningTime, time.Now().UTC()),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// the signature covers the attributes encoded as a SET, not as [0]
+	attrsHash := sha256.Sum256(setOf(attrs...).FullBytes)
+	signatureAlgorithm, err := signatureAlgorithmFor(key)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := key.Sign(rand.Reader, attrsHash[:], crypto.SHA256)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign content: %w", err)
+	}
+
+	// SHA-2 parameters are absent rather than NULL (RFC 5754)
+	sha256Algorithm := algorithmIdentifier{Algorithm: oidSHA256}
+	info, err := asn1.Marshal(signerInfo{
+		Version:            1,
+		IssuerAndSerial:    issuerAndSerialOf(cert),
+		DigestAlgorithm:    sha256Algorithm,
+		SignedAttributes:   asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: concat(attrs)},
+		SignatureAlgorithm: signatureAlgorithm,
+		Signature:          signature,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	digestAlgorithm, err := asn1.Marshal(sha256Algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	certs := [][]byte{cert.Raw}
+	for _, c := range chain {
+		certs = append(certs, c.Raw)
+	}
+
+	data, err := asn1.Marshal(signedData{
+		Version:          1,
+		DigestAlgorithms: setOf(digestAlgorithm),
+		ContentInfo:      encapsulatedContentInfo{ContentType: oidData},
+		Certificates:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: concat(certs)},
+		SignerInfos:      setOf(info),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return asn1.Marshal(contentInfo{
+		ContentType: oidSignedData,
+		Content:     explicit(data),
+	})
+}
+
+// encrypt builds a DER encoded CMS EnvelopedData with an AES-256-CBC content
+// key transported to every recipient with RSA PKCS#1 v1.5.
+func encrypt(content []byte, recipients []*x509.Certificate) ([]byte, error) {
+	key := make([]byte, 32)
+	iv := make([]byte, aes.BlockSize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	if _, err := rand.Read(iv); err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	padded := pad(content, aes.BlockSize)
+	encrypted := make([]byte, len(padded))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(encrypted, padded)
+
+	infos := make([][]byte, 0, len(recipients))
+	for _, cert := range recipients {
+		pub, ok := cert.PublicKey.(*rsa.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("certificate %s: only RSA keys are supported for encryption", cert.Subject)
+		}
+		encryptedKey, err := rsa.EncryptPKCS1v15(rand.Reader, pub, key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encrypt content key: %w", err)
+		}
+		info, err := asn1.Marshal(keyTransRecipientInfo{
+			IssuerAndSerial:        issuerAndSerialOf(cert),
+			KeyEncryptionAlgorithm: algorithmIdentifier{Algorithm: oidRSAEncryption, Parameters: asn1.NullRawValue},
+			EncryptedKey:           encryptedKey,
+		})
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, info)
+	}
+
+	ivParam, err := asn1.Marshal(iv)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := asn1.Marshal(envelopedData{
+		RecipientInfos: setOf(infos...),
+		EncryptedContentInfo: encryptedContentInfo{
+			ContentType:                oidData,
+			ContentEncryptionAlgorithm: algorithmIdentifier{Algorithm: oidAES256CBC, Parameters: asn1.RawValue{FullBytes: ivParam}},
+			EncryptedContent:           encrypted,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return asn1.Marshal(contentInfo{
+		ContentType: oidEnvelopedData,
+		Content:     explicit(data),
+	})
+}
+
+func signatureAlgorithmFor(key crypto.Signer) (algorithmIdentifier, error) {
+	switch key.Public().(type) {
+	case *rsa.PublicKey:
+		return algorithmIdentifier{Algorithm: oidRSAEncryption, Parameters: asn1.NullRawValue}, nil
+	case *ecdsa.PublicKey:
+		return algorithmIdentifier{Algorithm: oidECDSAWithSHA256}, nil
+	default:
+		return algorithmIdentifier{}, fmt.Errorf("unsupported signing key type %T", key.Public())
+	}
+}
+
+func issuerAndSerialOf(cert *x509.Certificate) issuerAndSerial {
+	return issuerAndSerial{
+		Issuer:       asn1.RawValue{FullBytes: cert.RawIssuer},
+		SerialNumber: cert.SerialNumber,
+	}
+}
+
+type attributeValue struct {
+	oid   asn1.ObjectIdentifier
+	value any
+}
+
+func attributeOf(oid asn1.ObjectIdentifier, value any) attributeValue {
+	return attributeValue{oid: oid, value: value}
+}
+
+func encodeAttributes(values ...attributeValue) ([][]byte, error) {
+	encoded := make([][]byte, 0, len(values))
+	for _, v := range values {
+		value, err := asn1.Marshal(v.value)
+		if err != nil {
+			return nil, err
+		}
+		attr, err := asn1.Marshal(attribute{Type: v.oid, Values: setOf(value)})
+		if err != nil {
+			return nil, err
+		}
+		encoded = append(encoded, attr)
+	}
+	sortEncodings(encoded)
+	return encoded, nil
+}
+
+// setOf encodes a DER SET OF, which requires the elements sorted by encoding.
+func setOf(elements ...[]byte) asn1.RawValue {
+	sorted := make([][]byte, len(elements))
+	copy(sorted, elements)
+	sortEncodings(sorted)
+
+	set := asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true, Bytes: concat(sorted)}
+	set.FullBytes, _ = asn1.Marshal(set)
+	return set
+}
+
+func sortEncodings(encodings [][]byte) {
+	sort.Slice(encodings, func(i, j int) bool { return bytes.Compare(encodings[i], encodings[j]) < 0 })
+}
+
+// explicit wraps an encoded value in an [0] EXPLICIT tag.
+func explicit(encoded []byte) asn1.RawValue {
+	return asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: encoded}
+}
+
+func concat(parts [][]byte) []byte {
+	var b bytes.Buffer
+	for _, p := range parts {
+		b.Write(p)
+	}
+	return b.Bytes()
+}
+
+// pad applies PKCS#7 padding.
+func pad(data []byte, blockSize int) []byte {
+	n := blockSize - len(data)%blockSize
+	return append(append([]byte{}, data...), bytes.Repeat([]byte{byte(n)}, n)...)
+}
@@ -0,0 +1,355 @@
+package smime
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The testdata fixtures were produced with OpenSSL 3.0:
+//
+//	openssl req -x509 -newkey rsa:2048 -nodes -keyout key.pem -out cert.pem -days 36500 \
+//	  -subj "/CN=Sender/emailAddress=sender@example.com"
+//	openssl cms -sign -binary -nosmimecap -in content.txt -signer cert.pem -inkey key.pem \
+//	  -md sha256 -outform DER -out openssl-signed.p7s
+//	openssl cms -encrypt -binary -aes256 -in content.txt -outform DER -out openssl-enveloped.p7m cert.pem
+
+func loadTestIdentity(t *testing.T) *Identity {
+	t.Helper()
+	identity, err := LoadIdentity("testdata/cert.pem", "testdata/key.pem")
+	if err != nil {
+		t.Fatalf("LoadIdentity: %v", err)
+	}
+	return identity
+}
+
+func readFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile("testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// newTestCertificate issues a self-signed certificate for key.
+func newTestCertificate(t *testing.T, key crypto.Signer, name string) *x509.Certificate {
+	t.Helper()
+	template := &x509.Certificate{
+		SerialNumber:   big.NewInt(time.Now().UnixNano()),
+		Subject:        pkix.Name{CommonName: name},
+		EmailAddresses: []string{name},
+		NotBefore:      time.Now().Add(-time.Hour),
+		NotAfter:       time.Now().Add(time.Hour),
+		KeyUsage:       x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func newRSAKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// verifyDetached checks a detached SignedData over content independently of
+// signDetached: the certificate, the message digest attribute and the
+// signature over the DER SET of the signed attributes.
+func verifyDetached(t *testing.T, der, content []byte, cert *x509.Certificate) {
+	t.Helper()
+
+	var info contentInfo
+	if rest, err := asn1.Unmarshal(der, &info); err != nil || len(rest) > 0 {
+		t.Fatalf("ContentInfo: %v, %d trailing bytes", err, len(rest))
+	}
+	if !info.ContentType.Equal(oidSignedData) {
+		t.Fatalf("content type = %v, want signedData", info.ContentType)
+	}
+	var data signedData
+	if _, err := asn1.Unmarshal(info.Content.Bytes, &data); err != nil {
+		t.Fatalf("SignedData: %v", err)
+	}
+	if data.Version != 1 || !data.ContentInfo.ContentType.Equal(oidData) {
+		t.Fatalf("SignedData version %d, content type %v", data.Version, data.ContentInfo.ContentType)
+	}
+
+	certs, err := x509.ParseCertificates(data.Certificates.Bytes)
+	if err != nil || len(certs) == 0 || !certs[0].Equal(cert) {
+		t.Fatalf("certificates: %v, %d parsed", err, len(certs))
+	}
+
+	var signer signerInfo
+	if _, err := asn1.Unmarshal(data.SignerInfos.Bytes, &signer); err != nil {
+		t.Fatalf("SignerInfo: %v", err)
+	}
+	if signer.IssuerAndSerial.SerialNumber.Cmp(cert.SerialNumber) != 0 || !bytes.Equal(signer.IssuerAndSerial.Issuer.FullBytes, cert.RawIssuer) {
+		t.Fatal("SignerInfo does not identify the signing certificate")
+	}
+	if !signer.DigestAlgorithm.Algorithm.Equal(oidSHA256) {
+		t.Fatalf("digest algorithm = %v, want sha256", signer.DigestAlgorithm.Algorithm)
+	}
+
+	digest := sha256.Sum256(content)
+	var foundDigest, foundType bool
+	for rest := signer.SignedAttributes.Bytes; len(rest) > 0; {
+		var attr attribute
+		if rest, err = asn1.Unmarshal(rest, &attr); err != nil {
+			t.Fatalf("attribute: %v", err)
+		}
+		switch {
+		case attr.Type.Equal(oidAttributeMessageDigest):
+			var value []byte
+			if _, err := asn1.Unmarshal(attr.Values.Bytes, &value); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(value, digest[:]) {
+				t.Fatal("message digest attribute does not match the content")
+			}
+			foundDigest = true
+		case attr.Type.Equal(oidAttributeContentType):
+			var value asn1.ObjectIdentifier
+			if _, err := asn1.Unmarshal(attr.Values.Bytes, &value); err != nil {
+				t.Fatal(err)
+			}
+			foundType = value.Equal(oidData)
+		}
+	}
+	if !foundDigest || !foundType {
+		t.Fatalf("signed attributes: message digest %v, content type %v", foundDigest, foundType)
+	}
+
+	// the signature covers the attributes re-tagged as a SET
+	signed := append([]byte{0x31}, signer.SignedAttributes.FullBytes[1:]...)
+	algorithm := x509.SHA256WithRSA
+	if _, ok := cert.PublicKey.(*ecdsa.PublicKey); ok {
+		algorithm = x509.ECDSAWithSHA256
+	}
+	if err := cert.CheckSignature(algorithm, signed, signer.Signature); err != nil {
+		t.Fatalf("signature: %v", err)
+	}
+}
+
+// decryptEnveloped decrypts an EnvelopedData for the recipient cert.
+func decryptEnveloped(t *testing.T, der []byte, cert *x509.Certificate, key *rsa.PrivateKey) []byte {
+	t.Helper()
+
+	var info contentInfo
+	if rest, err := asn1.Unmarshal(der, &info); err != nil || len(rest) > 0 {
+		t.Fatalf("ContentInfo: %v, %d trailing bytes", err, len(rest))
+	}
+	if !info.ContentType.Equal(oidEnvelopedData) {
+		t.Fatalf("content type = %v, want envelopedData", info.ContentType)
+	}
+	var data envelopedData
+	if _, err := asn1.Unmarshal(info.Content.Bytes, &data); err != nil {
+		t.Fatalf("EnvelopedData: %v", err)
+	}
+
+	var contentKey []byte
+	for rest := data.RecipientInfos.Bytes; len(rest) > 0; {
+		var recipient keyTransRecipientInfo
+		var err error
+		if rest, err = asn1.Unmarshal(rest, &recipient); err != nil {
+			t.Fatalf("RecipientInfo: %v", err)
+		}
+		if recipient.IssuerAndSerial.SerialNumber.Cmp(cert.SerialNumber) != 0 || !bytes.Equal(recipient.IssuerAndSerial.Issuer.FullBytes, cert.RawIssuer) {
+			continue
+		}
+		if contentKey, err = rsa.DecryptPKCS1v15(nil, key, recipient.EncryptedKey); err != nil {
+			t.Fatalf("content key: %v", err)
+		}
+	}
+	if contentKey == nil {
+		t.Fatal("no RecipientInfo for the certificate")
+	}
+
+	encrypted := data.EncryptedContentInfo
+	if !encrypted.ContentEncryptionAlgorithm.Algorithm.Equal(oidAES256CBC) {
+		t.Fatalf("content encryption = %v, want aes256-cbc", encrypted.ContentEncryptionAlgorithm.Algorithm)
+	}
+	var iv []byte
+	if _, err := asn1.Unmarshal(encrypted.ContentEncryptionAlgorithm.Parameters.FullBytes, &iv); err != nil {
+		t.Fatalf("IV: %v", err)
+	}
+	block, err := aes.NewCipher(contentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(encrypted.EncryptedContent)%aes.BlockSize != 0 || len(iv) != aes.BlockSize {
+		t.Fatalf("%d bytes of content with a %d byte IV", len(encrypted.EncryptedContent), len(iv))
+	}
+	plain := make([]byte, len(encrypted.EncryptedContent))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plain, encrypted.EncryptedContent)
+
+	n := int(plain[len(plain)-1])
+	if n == 0 || n > aes.BlockSize || !bytes.Equal(plain[len(plain)-n:], bytes.Repeat([]byte{byte(n)}, n)) {
+		t.Fatal("invalid padding")
+	}
+	return plain[:len(plain)-n]
+}
+
+// skeleton lists the tags of a DER encoding in order, with object
+// identifiers and integers, but without lengths and other values such as
+// keys, signatures and times.
+func skeleton(t *testing.T, der []byte) []string {
+	t.Helper()
+	var out []string
+	var walk func(data []byte, depth int)
+	walk = func(data []byte, depth int) {
+		for len(data) > 0 {
+			var v asn1.RawValue
+			rest, err := asn1.Unmarshal(data, &v)
+			if err != nil {
+				t.Fatalf("skeleton: %v", err)
+			}
+			node := fmt.Sprintf("%s%d/%d", strings.Repeat(" ", depth), v.Class, v.Tag)
+			switch {
+			case v.IsCompound:
+				out = append(out, node)
+				walk(v.Bytes, depth+1)
+			case v.Class == asn1.ClassUniversal && v.Tag == asn1.TagOID:
+				var oid asn1.ObjectIdentifier
+				if _, err := asn1.Unmarshal(v.FullBytes, &oid); err != nil {
+					t.Fatal(err)
+				}
+				out = append(out, node+" "+oid.String())
+			case v.Class == asn1.ClassUniversal && v.Tag == asn1.TagInteger:
+				out = append(out, node+" "+new(big.Int).SetBytes(v.Bytes).String())
+			default:
+				out = append(out, node)
+			}
+			data = rest
+		}
+	}
+	walk(der, 0)
+	return out
+}
+
+func compareSkeletons(t *testing.T, got, want []string) {
+	t.Helper()
+	if strings.Join(got, "\n") == strings.Join(want, "\n") {
+		return
+	}
+	for i := 0; i < len(got) && i < len(want); i++ {
+		if got[i] != want[i] {
+			t.Fatalf("DER structure differs at node %d: got %q, want %q", i, got[i], want[i])
+		}
+	}
+	t.Fatalf("DER structure has %d nodes, want %d", len(got), len(want))
+}
+
+func TestVerifyOpenSSLSignature(t *testing.T) {
+	identity := loadTestIdentity(t)
+	verifyDetached(t, readFixture(t, "openssl-signed.p7s"), readFixture(t, "content.txt"), identity.Certificate)
+}
+
+func TestDecryptOpenSSLEnvelope(t *testing.T) {
+	identity := loadTestIdentity(t)
+	got := decryptEnveloped(t, readFixture(t, "openssl-enveloped.p7m"), identity.Certificate, identity.Key.(*rsa.PrivateKey))
+	if want := readFixture(t, "content.txt"); !bytes.Equal(got, want) {
+		t.Fatalf("decrypted %q, want %q", got, want)
+	}
+}
+
+func TestSignDetached(t *testing.T) {
+	content := []byte("Content-Type: text/plain\r\n\r\nSigned body\r\n")
+
+	t.Run("rsa", func(t *testing.T) {
+		identity := loadTestIdentity(t)
+		der, err := signDetached(content, identity.Certificate, nil, identity.Key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		verifyDetached(t, der, content, identity.Certificate)
+	})
+
+	t.Run("ecdsa", func(t *testing.T) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert := newTestCertificate(t, key, "ec@example.com")
+		der, err := signDetached(content, cert, nil, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		verifyDetached(t, der, content, cert)
+	})
+
+}
+
+func TestSignDetachedMatchesOpenSSLStructure(t *testing.T) {
+	identity := loadTestIdentity(t)
+	der, err := signDetached(readFixture(t, "content.txt"), identity.Certificate, nil, identity.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compareSkeletons(t, skeleton(t, der), skeleton(t, readFixture(t, "openssl-signed.p7s")))
+}
+
+func TestEncrypt(t *testing.T) {
+	identity := loadTestIdentity(t)
+	otherKey := newRSAKey(t)
+	other := newTestCertificate(t, otherKey, "other@example.com")
+
+	for _, size := range []int{0, 1, 15, 16, 17, 1000} {
+		t.Run(fmt.Sprintf("%d bytes", size), func(t *testing.T) {
+			content := bytes.Repeat([]byte("x"), size)
+			der, err := encrypt(content, []*x509.Certificate{identity.Certificate, other})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := decryptEnveloped(t, der, identity.Certificate, identity.Key.(*rsa.PrivateKey)); !bytes.Equal(got, content) {
+				t.Fatalf("first recipient decrypted %q", got)
+			}
+			if got := decryptEnveloped(t, der, other, otherKey); !bytes.Equal(got, content) {
+				t.Fatalf("second recipient decrypted %q", got)
+			}
+		})
+	}
+}
+
+func TestEncryptMatchesOpenSSLStructure(t *testing.T) {
+	identity := loadTestIdentity(t)
+	der, err := encrypt(readFixture(t, "content.txt"), []*x509.Certificate{identity.Certificate})
+	if err != nil {
+		t.Fatal(err)
+	}
+	compareSkeletons(t, skeleton(t, der), skeleton(t, readFixture(t, "openssl-enveloped.p7m")))
+}
+
+func TestEncryptRejectsNonRSARecipients(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := encrypt([]byte("x"), []*x509.Certificate{newTestCertificate(t, key, "ec@example.com")}); err == nil {
+		t.Fatal("encrypted to an ECDSA certificate")
+	}
+}
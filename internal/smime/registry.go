@@ -0,0 +1,55 @@
+package smime
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var ErrCertificateNotFound = errors.New("certificate not found")
+
+// CertificateRegistry resolves recipient certificates used for encryption.
+type CertificateRegistry interface {
+	Lookup(address string) (*x509.Certificate, error)
+}
+
+// DirectoryRegistry keeps one PEM file per recipient, named after the
+// lowercased address, e.g. "ivan@example.com.pem".
+type DirectoryRegistry struct {
+	dir string
+}
+
+func NewDirectoryRegistry(dir string) *DirectoryRegistry {
+	return &DirectoryRegistry{dir: dir}
+}
+
+// Lookup only accepts a bare address, anything else could name a file
+// outside the directory.
+func (r *DirectoryRegistry) Lookup(address string) (*x509.Certificate, error) {
+	parsed, err := mail.ParseAddress(address)
+	if err != nil || parsed.Address != address || strings.ContainsAny(address, `/\`) {
+		return nil, fmt.Errorf("invalid address %q", address)
+	}
+	name := strings.ToLower(address) + ".pem"
+
+	path := filepath.Join(r.dir, name)
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w for %s", ErrCertificateNotFound, address)
+	}
+
+	certs, err := loadCertificates(path)
+	if err != nil {
+		return nil, err
+	}
+
+	cert := certs[0]
+	if time.Now().After(cert.NotAfter) {
+		return nil, fmt.Errorf("certificate for %s expired at %s", address, cert.NotAfter.Format(time.RFC3339))
+	}
+	return cert, nil
+}
@@ -0,0 +1,49 @@
+package smime
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeCertificate(t *testing.T, path string, cert *x509.Certificate) {
+	t.Helper()
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDirectoryRegistryLookup(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "certs")
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	cert := newTestCertificate(t, newRSAKey(t), "ann@example.com")
+	writeCertificate(t, filepath.Join(dir, "ann@example.com.pem"), cert)
+	// files next to the directory must not be reachable
+	writeCertificate(t, filepath.Join(root, "secret.pem"), cert)
+
+	registry := NewDirectoryRegistry(dir)
+	for _, address := range []string{"ann@example.com", "Ann@Example.com"} {
+		found, err := registry.Lookup(address)
+		if err != nil || !found.Equal(cert) {
+			t.Errorf("Lookup(%q) = %v, want the certificate", address, err)
+		}
+	}
+
+	if _, err := registry.Lookup("bob@example.com"); !errors.Is(err, ErrCertificateNotFound) {
+		t.Errorf("Lookup of an unknown address = %v, want ErrCertificateNotFound", err)
+	}
+
+	invalid := []string{"", ".", "..", "../secret", "..@example.com/../../secret", `ann\@example.com`, "Ann <ann@example.com>", "ann@example.com, bob@example.com", " ann@example.com"}
+	for _, address := range invalid {
+		if _, err := registry.Lookup(address); err == nil || errors.Is(err, ErrCertificateNotFound) {
+			t.Errorf("Lookup(%q) = %v, want the address rejected", address, err)
+		}
+	}
+}
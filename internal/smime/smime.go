@@ -0,0 +1,187 @@
+package smime
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"handyhub-email-svc/internal/config"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+var log = logrus.StandardLogger()
+
+// contentHeaders describe the MIME entity and move into the signed or
+// encrypted part, everything else stays on the outer message.
+var contentHeaders = map[string]bool{
+	"content-type":              true,
+	"content-transfer-encoding": true,
+	"content-disposition":       true,
+	"content-id":                true,
+	"content-description":       true,
+}
+
+// Service signs messages with the identity of their sender and encrypts
+// them to recipient certificates from the registry.
+type Service struct {
+	identities map[string]*Identity
+	registry   CertificateRegistry
+}
+
+func NewService(cfg config.SMIMEConfig) (*Service, error) {
+	identities := make(map[string]*Identity, len(cfg.Identities))
+	for _, idCfg := range cfg.Identities {
+		identity, err := LoadIdentity(idCfg.Cert, idCfg.Key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load S/MIME identity for %s: %w", idCfg.From, err)
+		}
+		identities[strings.ToLower(idCfg.From)] = identity
+		log.WithField("from", idCfg.From).Info("S/MIME identity loaded")
+	}
+
+	return &Service{
+		identities: identities,
+		registry:   NewDirectoryRegistry(cfg.CertificatesDir),
+	}, nil
+}
+
+// Apply signs and/or encrypts a complete RFC 5322 message. Signing happens
+// first so the signature is protected by the encryption.
+func (s *Service) Apply(raw []byte, from string, recipients []string, sign, encrypt bool) ([]byte, error) {
+	outer, entity := splitMessage(raw)
+
+	if sign {
+		identity, ok := s.identities[strings.ToLower(from)]
+		if !ok {
+			return nil, fmt.Errorf("no S/MIME identity configured for %s", from)
+		}
+		signed, err := signEntity(entity, identity)
+		if err != nil {
+			return nil, err
+		}
+		entity = signed
+	}
+
+	if encrypt {
+		certs := make([]*x509.Certificate, 0, len(recipients))
+		for _, recipient := range recipients {
+			cert, err := s.registry.Lookup(recipient)
+			if err != nil {
+				return nil, err
+			}
+			certs = append(certs, cert)
+		}
+		// the sender must be able to read its own sent mail
+		if identity, ok := s.identities[strings.ToLower(from)]; ok {
+			certs = append(certs, identity.Certificate)
+		}
+		encrypted, err := encryptEntity(entity, certs)
+		if err != nil {
+			return nil, err
+		}
+		entity = encrypted
+	}
+
+	var b bytes.Buffer
+	b.Write(outer)
+	b.Write(entity)
+	return b.Bytes(), nil
+}
+
+func signEntity(entity []byte, identity *Identity) ([]byte, error) {
+	signature, err := signDetached(entity, identity.Certificate, identity.Chain, identity.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	boundary, err := newBoundary()
+	if err != nil {
+		return nil, err
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "Content-Type: multipart/signed; protocol=\"application/pkcs7-signature\"; micalg=sha-256; boundary=\"%s\"\r\n\r\n", boundary)
+	b.WriteString("This is a cryptographically signed message in MIME format.\r\n\r\n")
+	fmt.Fprintf(&b, "--%s\r\n", boundary)
+	b.Write(entity)
+	fmt.Fprintf(&b, "\r\n--%s\r\n", boundary)
+	b.WriteString("Content-Type: application/pkcs7-signature; name=\"smime.p7s\"\r\n")
+	b.WriteString("Content-Transfer-Encoding: base64\r\n")
+	b.WriteString("Content-Disposition: attachment; filename=\"smime.p7s\"\r\n\r\n")
+	writeBase64(&b, signature)
+	fmt.Fprintf(&b, "--%s--\r\n", boundary)
+	return b.Bytes(), nil
+}
+
+func encryptEntity(entity []byte, certs []*x509.Certificate) ([]byte, error) {
+	enveloped, err := encrypt(entity, certs)
+	if err != nil {
+		return nil, err
+	}
+
+	var b bytes.Buffer
+	b.WriteString("Content-Type: application/pkcs7-mime; smime-type=enveloped-data; name=\"smime.p7m\"\r\n")
+	b.WriteString("Content-Transfer-Encoding: base64\r\n")
+	b.WriteString("Content-Disposition: attachment; filename=\"smime.p7m\"\r\n\r\n")
+	writeBase64(&b, enveloped)
+	return b.Bytes(), nil
+}
+
+// splitMessage separates the outer headers from the MIME entity (content
+// headers and body). Line endings are normalized to CRLF, the canonical form
+// S/MIME signatures are computed over.
+func splitMessage(raw []byte) ([]byte, []byte) {
+	raw = canonicalize(raw)
+
+	headerEnd := bytes.Index(raw, []byte("\r\n\r\n"))
+	if headerEnd < 0 {
+		return nil, raw
+	}
+	headers, body := raw[:headerEnd+2], raw[headerEnd+4:]
+
+	var outer, entity bytes.Buffer
+	current := &outer
+	for _, line := range strings.SplitAfter(string(headers), "\r\n") {
+		if line == "" {
+			continue
+		}
+		if line[0] != ' ' && line[0] != '\t' {
+			name := strings.ToLower(strings.TrimSpace(line[:max(strings.IndexByte(line, ':'), 0)]))
+			current = &outer
+			if contentHeaders[name] {
+				current = &entity
+			}
+		}
+		current.WriteString(line)
+	}
+
+	entity.WriteString("\r\n")
+	entity.Write(body)
+	return outer.Bytes(), entity.Bytes()
+}
+
+func canonicalize(raw []byte) []byte {
+	normalized := bytes.ReplaceAll(raw, []byte("\r\n"), []byte("\n"))
+	return bytes.ReplaceAll(normalized, []byte("\n"), []byte("\r\n"))
+}
+
+func writeBase64(b *bytes.Buffer, data []byte) {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for len(encoded) > 76 {
+		b.WriteString(encoded[:76] + "\r\n")
+		encoded = encoded[76:]
+	}
+	b.WriteString(encoded + "\r\n")
+}
+
+func newBoundary() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return "smime-" + hex.EncodeToString(buf), nil
+}
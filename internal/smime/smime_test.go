@@ -0,0 +1,236 @@
+package smime
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"io"
+	"mime"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testMessage = "From: Sender <sender@example.com>\n" +
+	"To: rcpt@example.com\n" +
+	"Subject: Hello\n" +
+	"MIME-Version: 1.0\n" +
+	"Content-Type: text/plain; charset=utf-8\n" +
+	"Content-Transfer-Encoding: quoted-printable\n" +
+	"\n" +
+	"Hello,=\n world\n"
+
+// the content headers and body of testMessage in canonical form
+const testEntity = "Content-Type: text/plain; charset=utf-8\r\n" +
+	"Content-Transfer-Encoding: quoted-printable\r\n" +
+	"\r\n" +
+	"Hello,=\r\n world\r\n"
+
+type testRecipient struct {
+	cert *x509.Certificate
+	key  *rsa.PrivateKey
+}
+
+func newTestService(t *testing.T) (*Service, *Identity, testRecipient) {
+	t.Helper()
+	identity := loadTestIdentity(t)
+
+	key := newRSAKey(t)
+	recipient := testRecipient{cert: newTestCertificate(t, key, "rcpt@example.com"), key: key}
+	dir := t.TempDir()
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: recipient.cert.Raw})
+	if err := os.WriteFile(filepath.Join(dir, "rcpt@example.com.pem"), certPEM, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	service := &Service{
+		identities: map[string]*Identity{"sender@example.com": identity},
+		registry:   NewDirectoryRegistry(dir),
+	}
+	return service, identity, recipient
+}
+
+// readMessage parses a message, checks the outer headers survived and
+// returns its media type.
+func readMessage(t *testing.T, raw []byte) (*mail.Message, string, map[string]string) {
+	t.Helper()
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("ReadMessage: %v", err)
+	}
+	for _, name := range []string{"From", "To", "Subject", "Mime-Version"} {
+		if msg.Header.Get(name) == "" {
+			t.Errorf("outer header %s is missing", name)
+		}
+	}
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatalf("Content-Type: %v", err)
+	}
+	return msg, mediaType, params
+}
+
+func decodeBase64Body(t *testing.T, body string) []byte {
+	t.Helper()
+	data, err := base64.StdEncoding.DecodeString(strings.NewReplacer("\r", "", "\n", "").Replace(body))
+	if err != nil {
+		t.Fatalf("base64: %v", err)
+	}
+	return data
+}
+
+// verifySigned checks a multipart/signed entity and returns the signed part.
+func verifySigned(t *testing.T, boundary, body string, cert *x509.Certificate) string {
+	t.Helper()
+	delimiter := "--" + boundary + "\r\n"
+	start := strings.Index(body, delimiter)
+	if start < 0 {
+		t.Fatalf("multipart/signed body without parts:\n%s", body)
+	}
+	start += len(delimiter)
+	end := strings.Index(body[start:], "\r\n--"+boundary+"\r\n")
+	if end < 0 {
+		t.Fatalf("multipart/signed body without a signature part:\n%s", body)
+	}
+	end += start
+	signedPart := body[start:end]
+
+	signaturePart := body[end+len("\r\n--"+boundary+"\r\n"):]
+	signatureMsg, err := mail.ReadMessage(strings.NewReader(signaturePart))
+	if err != nil {
+		t.Fatalf("signature part: %v", err)
+	}
+	if ct := signatureMsg.Header.Get("Content-Type"); !strings.HasPrefix(ct, "application/pkcs7-signature") {
+		t.Fatalf("signature part Content-Type = %q", ct)
+	}
+	encoded, _ := io.ReadAll(signatureMsg.Body)
+	encoded = bytes.TrimSuffix(bytes.TrimSpace(encoded), []byte("--"+boundary+"--"))
+
+	verifyDetached(t, decodeBase64Body(t, string(encoded)), []byte(signedPart), cert)
+	return signedPart
+}
+
+func TestApplySign(t *testing.T) {
+	service, identity, _ := newTestService(t)
+
+	out, err := service.Apply([]byte(testMessage), "sender@example.com", []string{"rcpt@example.com"}, true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, mediaType, params := readMessage(t, out)
+	if mediaType != "multipart/signed" || params["protocol"] != "application/pkcs7-signature" || params["micalg"] != "sha-256" {
+		t.Fatalf("Content-Type = %q %v", mediaType, params)
+	}
+	body, _ := io.ReadAll(msg.Body)
+	if signed := verifySigned(t, params["boundary"], string(body), identity.Certificate); signed != testEntity {
+		t.Fatalf("signed part = %q, want %q", signed, testEntity)
+	}
+}
+
+func TestApplyEncrypt(t *testing.T) {
+	service, identity, recipient := newTestService(t)
+
+	out, err := service.Apply([]byte(testMessage), "sender@example.com", []string{"rcpt@example.com"}, false, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, mediaType, params := readMessage(t, out)
+	if mediaType != "application/pkcs7-mime" || params["smime-type"] != "enveloped-data" {
+		t.Fatalf("Content-Type = %q %v", mediaType, params)
+	}
+	body, _ := io.ReadAll(msg.Body)
+	der := decodeBase64Body(t, string(body))
+
+	if got := decryptEnveloped(t, der, recipient.cert, recipient.key); string(got) != testEntity {
+		t.Fatalf("recipient decrypted %q, want %q", got, testEntity)
+	}
+	// the sender can read its sent mail
+	if got := decryptEnveloped(t, der, identity.Certificate, identity.Key.(*rsa.PrivateKey)); string(got) != testEntity {
+		t.Fatalf("sender decrypted %q, want %q", got, testEntity)
+	}
+}
+
+func TestApplySignAndEncrypt(t *testing.T) {
+	service, identity, recipient := newTestService(t)
+
+	out, err := service.Apply([]byte(testMessage), "Sender@Example.com", []string{"rcpt@example.com"}, true, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, _, _ := readMessage(t, out)
+	body, _ := io.ReadAll(msg.Body)
+	entity := decryptEnveloped(t, decodeBase64Body(t, string(body)), recipient.cert, recipient.key)
+
+	// the entity only has content headers, give it outer ones to parse it
+	inner, mediaType, params := readMessage(t, append([]byte("From: a@b.c\r\nTo: a@b.c\r\nSubject: x\r\nMIME-Version: 1.0\r\n"), entity...))
+	if mediaType != "multipart/signed" {
+		t.Fatalf("encrypted entity is %q, want multipart/signed", mediaType)
+	}
+	innerBody, _ := io.ReadAll(inner.Body)
+	if signed := verifySigned(t, params["boundary"], string(innerBody), identity.Certificate); signed != testEntity {
+		t.Fatalf("signed part = %q, want %q", signed, testEntity)
+	}
+}
+
+func TestApplyErrors(t *testing.T) {
+	service, _, _ := newTestService(t)
+
+	if _, err := service.Apply([]byte(testMessage), "other@example.com", nil, true, false); err == nil {
+		t.Error("signed without an identity for the sender")
+	}
+	_, err := service.Apply([]byte(testMessage), "sender@example.com", []string{"unknown@example.com"}, false, true)
+	if !errors.Is(err, ErrCertificateNotFound) {
+		t.Errorf("encrypt to unknown recipient: %v, want ErrCertificateNotFound", err)
+	}
+}
+
+func TestSplitMessage(t *testing.T) {
+	tests := []struct {
+		name   string
+		raw    string
+		outer  string
+		entity string
+	}{
+		{
+			name:   "content headers move to the entity",
+			raw:    testMessage,
+			outer:  "From: Sender <sender@example.com>\r\nTo: rcpt@example.com\r\nSubject: Hello\r\nMIME-Version: 1.0\r\n",
+			entity: testEntity,
+		},
+		{
+			name: "folded headers stay with their header",
+			raw: "Subject: A long\r\n\tsubject\r\n" +
+				"Content-Type: multipart/alternative;\r\n boundary=\"b1\"\r\n" +
+				"To: ann@example.com,\r\n bob@example.com\r\n" +
+				"content-disposition: inline\r\n" +
+				"\r\n" +
+				"body\r\n",
+			outer: "Subject: A long\r\n\tsubject\r\nTo: ann@example.com,\r\n bob@example.com\r\n",
+			entity: "Content-Type: multipart/alternative;\r\n boundary=\"b1\"\r\n" +
+				"content-disposition: inline\r\n" +
+				"\r\n" +
+				"body\r\n",
+		},
+		{
+			name:   "no header block",
+			raw:    "just a body\n",
+			entity: "just a body\r\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outer, entity := splitMessage([]byte(tt.raw))
+			if string(outer) != tt.outer {
+				t.Errorf("outer = %q, want %q", outer, tt.outer)
+			}
+			if string(entity) != tt.entity {
+				t.Errorf("entity = %q, want %q", entity, tt.entity)
+			}
+		})
+	}
+}
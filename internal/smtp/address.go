@@ -0,0 +1,68 @@
+package smtp
+
+import (
+	"fmt"
+	"net/mail"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/idna"
+)
+
+// ParseAddress parses a single address such as "Иван Петров <ivan@пример.рф>".
+// The domain is converted to its ASCII (IDNA) form so it can be used on the
+// wire, non-ASCII local parts are kept as is and require SMTPUTF8.
+func ParseAddress(raw string) (*mail.Address, error) {
+	addr, err := mail.ParseAddress(strings.TrimSpace(raw))
+	if err != nil {
+		return nil, fmt.Errorf("invalid address %q: %w", raw, err)
+	}
+
+	at := strings.LastIndex(addr.Address, "@")
+	if at <= 0 || at == len(addr.Address)-1 {
+		return nil, fmt.Errorf("invalid address %q: missing local part or domain", raw)
+	}
+
+	domain, err := idna.Lookup.ToASCII(addr.Address[at+1:])
+	if err != nil {
+		return nil, fmt.Errorf("invalid domain in address %q: %w", raw, err)
+	}
+	addr.Address = addr.Address[:at+1] + domain
+
+	return addr, nil
+}
+
+// ParseAddressList parses every address in raw, failing on the first invalid one.
+func ParseAddressList(raw []string) ([]*mail.Address, error) {
+	addrs := make([]*mail.Address, 0, len(raw))
+	for _, r := range raw {
+		addr, err := ParseAddress(r)
+		if err != nil {
+			return nil, err
+		}
+		addrs = append(addrs, addr)
+	}
+	return addrs, nil
+}
+
+// NeedsSMTPUTF8 reports whether the local part of addr contains non-ASCII
+// characters and therefore can only be delivered with the SMTPUTF8 extension.
+func NeedsSMTPUTF8(addr *mail.Address) bool {
+	local := addr.Address[:strings.LastIndex(addr.Address, "@")]
+	for i := 0; i < len(local); i++ {
+		if local[i] >= utf8.RuneSelf {
+			return true
+		}
+	}
+	return false
+}
+
+// formatAddressList renders addresses for a header, encoding display names
+// per RFC 2047.
+func formatAddressList(addrs []*mail.Address) string {
+	formatted := make([]string, 0, len(addrs))
+	for _, addr := range addrs {
+		formatted = append(formatted, addr.String())
+	}
+	return strings.Join(formatted, ", ")
+}
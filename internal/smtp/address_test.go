@@ -0,0 +1,71 @@
+package smtp
+
+import "testing"
+
+func TestParseAddress(t *testing.T) {
+	tests := []struct {
+		raw      string
+		address  string
+		name     string
+		header   string
+		smtputf8 bool
+		wantErr  bool
+	}{
+		{raw: "ann@example.com", address: "ann@example.com", header: "<ann@example.com>"},
+		{raw: "  Ann <ann@EXAMPLE.com> ", address: "ann@example.com", name: "Ann", header: `"Ann" <ann@example.com>`},
+		{raw: `"Ann, Lee" <ann@example.com>`, address: "ann@example.com", name: "Ann, Lee", header: `"Ann, Lee" <ann@example.com>`},
+		// IDNA domain, RFC 2047 display name
+		{raw: "Иван <ivan@пример.рф>", address: "ivan@xn--e1afmkfd.xn--p1ai", name: "Иван", header: "=?utf-8?q?=D0=98=D0=B2=D0=B0=D0=BD?= <ivan@xn--e1afmkfd.xn--p1ai>"},
+		{raw: "=?UTF-8?B?0JjQstCw0L0=?= <ivan@example.com>", address: "ivan@example.com", name: "Иван", header: "=?utf-8?q?=D0=98=D0=B2=D0=B0=D0=BD?= <ivan@example.com>"},
+		// non-ASCII local parts are kept and need SMTPUTF8
+		{raw: "иван@пример.рф", address: "иван@xn--e1afmkfd.xn--p1ai", header: "<иван@xn--e1afmkfd.xn--p1ai>", smtputf8: true},
+		// header injection through the display name
+		{raw: "\"Ann\r\nBcc: eve@example.com\" <ann@example.com>", wantErr: true},
+		{raw: "Ann\r\nBcc: eve@example.com <ann@example.com>", wantErr: true},
+		{raw: "Ann <ann@example.com>\r\nBcc: eve@example.com", wantErr: true},
+		{raw: "", wantErr: true},
+		{raw: "ann", wantErr: true},
+		{raw: "@example.com", wantErr: true},
+		{raw: "ann@", wantErr: true},
+		{raw: "ann@exa mple.com", wantErr: true},
+		{raw: "ann@xn--a.com", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			addr, err := ParseAddress(tt.raw)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ParseAddress = %q, want an error", addr.String())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseAddress: %v", err)
+			}
+			if addr.Address != tt.address || addr.Name != tt.name {
+				t.Errorf("ParseAddress = %q %q, want %q %q", addr.Name, addr.Address, tt.name, tt.address)
+			}
+			if got := addr.String(); got != tt.header {
+				t.Errorf("header value = %q, want %q", got, tt.header)
+			}
+			if got := NeedsSMTPUTF8(addr); got != tt.smtputf8 {
+				t.Errorf("NeedsSMTPUTF8 = %v, want %v", got, tt.smtputf8)
+			}
+		})
+	}
+}
+
+func TestParseAddressList(t *testing.T) {
+	addrs, err := ParseAddressList([]string{"ann@example.com", "Иван <ivan@пример.рф>"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "<ann@example.com>, =?utf-8?q?=D0=98=D0=B2=D0=B0=D0=BD?= <ivan@xn--e1afmkfd.xn--p1ai>"
+	if got := formatAddressList(addrs); got != want {
+		t.Errorf("formatAddressList = %q, want %q", got, want)
+	}
+
+	if _, err := ParseAddressList([]string{"ann@example.com", "Eve\r\nBcc: eve@example.com"}); err == nil {
+		t.Error("ParseAddressList accepted an injected address")
+	}
+}
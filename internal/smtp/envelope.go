@@ -0,0 +1,131 @@
+package smtp
+
+import (
+	"fmt"
+	"handyhub-email-svc/internal/models"
+	"net/mail"
+	"net/textproto"
+	"strings"
+
+	"gopkg.in/gomail.v2"
+)
+
+// envelope holds the parsed sender and recipients of an email.
+type envelope struct {
+	from *mail.Address
+	to   []*mail.Address
+}
+
+func newEnvelope(email *models.EmailMessage, defaultFrom string) (*envelope, error) {
+	if len(email.To) == 0 {
+		return nil, fmt.Errorf("no recipients specified")
+	}
+
+	fromEmail := email.From
+	if fromEmail == "" {
+		fromEmail = defaultFrom
+	}
+	from, err := ParseAddress(fromEmail)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sender: %w", err)
+	}
+
+	to, err := ParseAddressList(email.To)
+	if err != nil {
+		return nil, fmt.Errorf("invalid recipient: %w", err)
+	}
+
+	return &envelope{from: from, to: to}, nil
+}
+
+// needsSMTPUTF8 reports whether any envelope address has a non-ASCII local part.
+func (e *envelope) needsSMTPUTF8() bool {
+	if NeedsSMTPUTF8(e.from) {
+		return true
+	}
+	for _, addr := range e.to {
+		if NeedsSMTPUTF8(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// setAddressHeaders writes From and To. SetAddressHeader with an empty name
+// stores the value verbatim, whereas SetHeader would Q-encode the whole value
+// and break already encoded display names and UTF-8 local parts.
+func (e *envelope) setAddressHeaders(msg *gomail.Message) {
+	msg.SetAddressHeader("From", e.from.String(), "")
+	msg.SetAddressHeader("To", formatAddressList(e.to), "")
+}
+
+// reservedHeaders are set by the service and cannot be given as custom headers.
+var reservedHeaders = map[string]bool{
+	"From": true, "To": true, "Cc": true, "Bcc": true, "Subject": true,
+	"Message-Id": true, "In-Reply-To": true, "References": true,
+	"Mime-Version": true, "Content-Type": true, "Content-Transfer-Encoding": true,
+}
+
+// messageHeaders returns the custom headers of an email together with
+// Message-ID and the threading headers. Reserved names and values spanning
+// lines are dropped to rule out header injection.
+func messageHeaders(email *models.EmailMessage) map[string]string {
+	headers := make(map[string]string, len(email.Headers)+3)
+	for name, value := range email.Headers {
+		canonical := textproto.CanonicalMIMEHeaderKey(name)
+		if name == "" || reservedHeaders[canonical] || strings.ContainsAny(name, "\r\n: ") || strings.ContainsAny(value, "\r\n") {
+			log.WithField("header", name).Warn("Dropping invalid custom header")
+			continue
+		}
+		headers[canonical] = value
+	}
+	if email.MessageID != "" {
+		headers["Message-ID"] = FormatMessageID(email.MessageID)
+	}
+	if email.InReplyTo != "" {
+		headers["In-Reply-To"] = FormatMessageID(email.InReplyTo)
+	}
+	if len(email.References) > 0 {
+		refs := make([]string, 0, len(email.References))
+		for _, ref := range email.References {
+			refs = append(refs, FormatMessageID(ref))
+		}
+		headers["References"] = strings.Join(refs, " ")
+	}
+	return headers
+}
+
+func setMessageHeaders(msg *gomail.Message, email *models.EmailMessage) {
+	for name, value := range messageHeaders(email) {
+		msg.SetHeader(name, value)
+	}
+}
+
+// FormatMessageID adds the angle brackets RFC 5322 requires around a msg-id.
+func FormatMessageID(id string) string {
+	id = strings.TrimSpace(id)
+	if id == "" {
+		return ""
+	}
+	if strings.HasPrefix(id, "<") && strings.HasSuffix(id, ">") {
+		return id
+	}
+	return "<" + strings.Trim(id, "<>") + ">"
+}
+
+// setBody writes the message parts. With both bodies present the text part
+// goes first, clients pick the last alternative they can display.
+func setBody(msg *gomail.Message, email *models.EmailMessage) error {
+	switch {
+	case email.BodyHTML != "" && email.BodyText != "":
+		msg.SetBody("text/plain", email.BodyText)
+		msg.AddAlternative("text/html", email.BodyHTML)
+	case email.BodyHTML != "":
+		msg.SetBody("text/html", email.BodyHTML)
+	case email.BodyText != "":
+		msg.SetBody("text/plain", email.BodyText)
+	default:
+		return fmt.Errorf("email body is required")
+	}
+	return nil
+}
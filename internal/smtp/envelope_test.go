@@ -0,0 +1,88 @@
+package smtp
+
+import (
+	"handyhub-email-svc/internal/models"
+	"testing"
+)
+
+func TestMessageHeaders(t *testing.T) {
+	email := &models.EmailMessage{
+		Headers: map[string]string{
+			"x-campaign":  "spring",
+			"X-Injected":  "a\r\nBcc: eve@example.com",
+			"X-Folded":    "a\n b",
+			"Bcc":         "eve@example.com",
+			"subject":     "Other subject",
+			"X-Bad: Name": "value",
+			"X-Bad\r\nTo": "value",
+			"":            "value",
+		},
+		MessageID:  "abc@example.com",
+		InReplyTo:  "<parent@example.com>",
+		References: []string{"root@example.com", "<parent@example.com>"},
+	}
+
+	want := map[string]string{
+		"X-Campaign":  "spring",
+		"Message-ID":  "<abc@example.com>",
+		"In-Reply-To": "<parent@example.com>",
+		"References":  "<root@example.com> <parent@example.com>",
+	}
+	got := messageHeaders(email)
+	if len(got) != len(want) {
+		t.Errorf("messageHeaders = %q, want %q", got, want)
+	}
+	for name, value := range want {
+		if got[name] != value {
+			t.Errorf("%s = %q, want %q", name, got[name], value)
+		}
+	}
+}
+
+func TestNewEnvelope(t *testing.T) {
+	tests := []struct {
+		name     string
+		email    models.EmailMessage
+		smtputf8 bool
+		wantErr  bool
+	}{
+		{name: "default sender", email: models.EmailMessage{To: []string{"ann@example.com"}}},
+		{name: "IDNA recipient", email: models.EmailMessage{To: []string{"ivan@пример.рф"}}},
+		{name: "UTF-8 recipient", email: models.EmailMessage{To: []string{"иван@пример.рф"}}, smtputf8: true},
+		{name: "UTF-8 sender", email: models.EmailMessage{From: "почта@пример.рф", To: []string{"ann@example.com"}}, smtputf8: true},
+		{name: "no recipients", wantErr: true},
+		{name: "injected sender", email: models.EmailMessage{From: "Eve <eve@example.com>\r\nBcc: x@example.com", To: []string{"ann@example.com"}}, wantErr: true},
+		{name: "injected recipient", email: models.EmailMessage{To: []string{"ann@example.com\r\nBcc: x@example.com"}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env, err := newEnvelope(&tt.email, "HandyHub <noreply@handyhub.example>")
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("newEnvelope succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("newEnvelope: %v", err)
+			}
+			if got := env.needsSMTPUTF8(); got != tt.smtputf8 {
+				t.Errorf("needsSMTPUTF8 = %v, want %v", got, tt.smtputf8)
+			}
+		})
+	}
+}
+
+func TestFormatMessageID(t *testing.T) {
+	tests := map[string]string{
+		"abc@example.com":   "<abc@example.com>",
+		"<abc@example.com>": "<abc@example.com>",
+		" <abc@example.com": "<abc@example.com>",
+		"  ":                "",
+	}
+	for id, want := range tests {
+		if got := FormatMessageID(id); got != want {
+			t.Errorf("FormatMessageID(%q) = %q, want %q", id, got, want)
+		}
+	}
+}
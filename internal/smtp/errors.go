@@ -0,0 +1,61 @@
+package smtp
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/textproto"
+)
+
+// TransientError is a send failure worth retrying later, e.g. a throttled
+// or unavailable provider API.
+type TransientError struct {
+	Err error
+}
+
+func (e *TransientError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *TransientError) Unwrap() error {
+	return e.Err
+}
+
+// UnconfirmedError is a send that failed after the message was handed over,
+// e.g. a connection lost while waiting for the reply to the end of DATA. The
+// email may have been delivered, so it is never retried.
+type UnconfirmedError struct {
+	Err error
+}
+
+func (e *UnconfirmedError) Error() string {
+	return "delivery unconfirmed: " + e.Err.Error()
+}
+
+func (e *UnconfirmedError) Unwrap() error {
+	return e.Err
+}
+
+// IsTransient reports whether a failed send may succeed on retry: network
+// failures before the message was handed over, 4xx SMTP replies and
+// TransientError. Anything else, such as an invalid message, a 5xx reply or
+// an UnconfirmedError, fails again the same way or risks a duplicate.
+func IsTransient(err error) bool {
+	var unconfirmed *UnconfirmedError
+	if errors.As(err, &unconfirmed) {
+		return false
+	}
+	var transient *TransientError
+	if errors.As(err, &transient) {
+		return true
+	}
+	var reply *textproto.Error
+	if errors.As(err, &reply) {
+		return reply.Code >= 400 && reply.Code < 500
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
@@ -3,27 +3,70 @@ package smtp
 import (
 	"fmt"
 	"handyhub-email-svc/internal/config"
+	"handyhub-email-svc/internal/smime"
+
+	"github.com/sirupsen/logrus"
 )
 
-func NewSMTPProvider(cfg config.SMTPConfig) (SMTPProvider, error) {
-	switch cfg.Provider {
+// NewSMTPProviders builds every configured provider instance.
+func NewSMTPProviders(cfg config.SMTPConfig) (*ProviderRegistry, error) {
+	if len(cfg.Providers) == 0 {
+		return nil, fmt.Errorf("no SMTP providers configured")
+	}
+
+	var secure *smime.Service
+	if cfg.SMIME.Enabled {
+		service, err := smime.NewService(cfg.SMIME)
+		if err != nil {
+			return nil, err
+		}
+		secure = service
+	}
+
+	providers := make(map[string]SMTPProvider, len(cfg.Providers))
+	for name, providerCfg := range cfg.Providers {
+		from := providerCfg.From
+		if from == "" {
+			from = cfg.DefaultFrom
+		}
+		provider, err := NewSMTPProvider(providerCfg, from, secure)
+		if err != nil {
+			return nil, fmt.Errorf("provider %s: %w", name, err)
+		}
+		providers[name] = provider
+		log.WithFields(logrus.Fields{
+			"name": name,
+			"type": providerCfg.Type,
+		}).Info("SMTP provider initialized")
+	}
+
+	return NewProviderRegistry(providers, cfg.Provider)
+}
+
+func NewSMTPProvider(cfg config.ProviderConfig, from string, secure *smime.Service) (SMTPProvider, error) {
+	switch cfg.Type {
 	case "gmail":
-		if cfg.Gmail.Username == "" || cfg.Gmail.Password == "" {
+		if cfg.Username == "" || cfg.Password == "" {
 			return nil, fmt.Errorf("gmail provider requires username and password")
 		}
-		return NewGmailProvider(cfg.Gmail, cfg.DefaultFrom), nil
+		return NewGmailProvider(config.GmailConfig{
+			Username: cfg.Username,
+			Password: cfg.Password,
+			Host:     cfg.Host,
+			Port:     cfg.Port,
+		}, from, secure), nil
 	case "sendgrid":
-		if cfg.SendGrid.ApiKey == "" || cfg.SendGrid.Url == "" {
+		if cfg.ApiKey == "" || cfg.Url == "" {
 			return nil, fmt.Errorf("sendgrid provider requires api key and url")
 		}
-		return NewSendGridProvider(cfg.SendGrid, cfg.DefaultFrom), nil
+		return NewSendGridProvider(config.SendGridConfig{ApiKey: cfg.ApiKey, Url: cfg.Url}, from), nil
 
 	case "mailhog":
-		if cfg.MailHog.Host == "" || cfg.MailHog.Port == 0 {
+		if cfg.Host == "" || cfg.Port == 0 {
 			return nil, fmt.Errorf("mailhog provider requires host and port")
 		}
-		return NewMailHogProvider(cfg.MailHog, cfg.DefaultFrom), nil
+		return NewMailHogProvider(config.MailHogConfig{Host: cfg.Host, Port: cfg.Port}, from, secure), nil
 	default:
-		return nil, fmt.Errorf("unsupported SMTP provider: %s", cfg.Provider)
+		return nil, fmt.Errorf("unsupported SMTP provider: %s", cfg.Type)
 	}
 }
@@ -4,55 +4,57 @@ import (
 	"fmt"
 	"handyhub-email-svc/internal/config"
 	"handyhub-email-svc/internal/models"
+	"handyhub-email-svc/internal/smime"
 
 	"gopkg.in/gomail.v2"
 )
 
 type GmailProvider struct {
-	config config.GmailConfig
-	from   string
+	config    config.GmailConfig
+	from      string
+	transport *smtpTransport
+	secure    *smime.Service
 }
 
-func NewGmailProvider(cfg config.GmailConfig, from string) *GmailProvider {
+func NewGmailProvider(cfg config.GmailConfig, from string, secure *smime.Service) *GmailProvider {
 	return &GmailProvider{
 		config: cfg,
 		from:   from,
+		transport: &smtpTransport{
+			host:     cfg.Host,
+			port:     cfg.Port,
+			username: cfg.Username,
+			password: cfg.Password,
+		},
+		secure: secure,
 	}
 }
 
-func (g *GmailProvider) SendEmail(email *models.EmailMessage) error {
-	m := gomail.NewMessage()
-
-	fromEmail := email.From
-	if fromEmail == "" {
-		fromEmail = g.from
+func (g *GmailProvider) SendEmail(email *models.EmailMessage) (string, error) {
+	env, err := newEnvelope(email, g.from)
+	if err != nil {
+		return "", err
 	}
-	m.SetHeader("From", fromEmail)
 
-	if len(email.To) == 0 {
-		return fmt.Errorf("no recipients specified")
-	}
-	m.SetHeader("To", email.To...)
+	m := gomail.NewMessage()
+	env.setAddressHeaders(m)
 	m.SetHeader("Subject", email.Subject)
+	setMessageHeaders(m, email)
 
-	if email.BodyHTML != "" {
-		m.SetBody("text/html", email.BodyHTML)
-		if email.BodyText != "" {
-			m.AddAlternative("text/plain", email.BodyText)
-		}
-	} else if email.BodyText != "" {
-		m.SetBody("text/plain", email.BodyText)
-	} else {
-		return fmt.Errorf("email body is required")
+	if err := setBody(m, email); err != nil {
+		return "", err
 	}
 
-	d := gomail.NewDialer(g.config.Host, g.config.Port, g.config.Username, g.config.Password)
+	raw, err := secureMessage(g.secure, m, env, email)
+	if err != nil {
+		return "", err
+	}
 
-	if err := d.DialAndSend(m); err != nil {
-		return fmt.Errorf("failed to send email via Gmail: %w", err)
+	if err := g.transport.send(env, raw); err != nil {
+		return "", fmt.Errorf("failed to send email via Gmail: %w", err)
 	}
 
-	return nil
+	return email.MessageID, nil
 }
 
 func (g *GmailProvider) GetProviderName() string {
@@ -3,6 +3,8 @@ package smtp
 import "handyhub-email-svc/internal/models"
 
 type SMTPProvider interface {
-	SendEmail(email *models.EmailMessage) error
+	// SendEmail returns the ID the provider uses for the message in its
+	// delivery notifications.
+	SendEmail(email *models.EmailMessage) (string, error)
 	GetProviderName() string
 }
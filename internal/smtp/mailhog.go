@@ -4,59 +4,54 @@ import (
 	"fmt"
 	"handyhub-email-svc/internal/config"
 	"handyhub-email-svc/internal/models"
+	"handyhub-email-svc/internal/smime"
 
 	"gopkg.in/gomail.v2"
 )
 
 type MailHogProvider struct {
-	config config.MailHogConfig
-	from   string
+	config    config.MailHogConfig
+	from      string
+	transport *smtpTransport
+	secure    *smime.Service
 }
 
-func NewMailHogProvider(cfg config.MailHogConfig, from string) *MailHogProvider {
+func NewMailHogProvider(cfg config.MailHogConfig, from string, secure *smime.Service) *MailHogProvider {
 	return &MailHogProvider{
-		config: cfg,
-		from:   from,
+		config:    cfg,
+		from:      from,
+		transport: &smtpTransport{host: cfg.Host, port: cfg.Port},
+		secure:    secure,
 	}
 }
 
-func (m *MailHogProvider) SendEmail(email *models.EmailMessage) error {
-	if len(email.To) == 0 {
-		return fmt.Errorf("no recipients specified")
-	}
-	if email.BodyHTML == "" && email.BodyText == "" {
-		return fmt.Errorf("email body is required")
+func (m *MailHogProvider) SendEmail(email *models.EmailMessage) (string, error) {
+	env, err := newEnvelope(email, m.from)
+	if err != nil {
+		return "", err
 	}
 
 	msg := gomail.NewMessage()
-	m.setHeaders(msg, email)
-
-	if email.BodyHTML != "" {
-		msg.SetBody("text/html", email.BodyHTML)
-		if email.BodyText != "" {
-			msg.AddAlternative("text/plain", email.BodyText)
-		}
-	} else {
-		msg.SetBody("text/plain", email.BodyText)
+	m.setHeaders(msg, env, email)
+	if err := setBody(msg, email); err != nil {
+		return "", err
 	}
 
-	d := gomail.NewDialer(m.config.Host, m.config.Port, "", "")
-	d.TLSConfig = nil
+	raw, err := secureMessage(m.secure, msg, env, email)
+	if err != nil {
+		return "", err
+	}
 
-	if err := d.DialAndSend(msg); err != nil {
-		return fmt.Errorf("failed to send email via MailHog: %w", err)
+	if err := m.transport.send(env, raw); err != nil {
+		return "", fmt.Errorf("failed to send email via MailHog: %w", err)
 	}
-	return nil
+	return email.MessageID, nil
 }
 
-func (m *MailHogProvider) setHeaders(msg *gomail.Message, email *models.EmailMessage) {
-	fromEmail := email.From
-	if fromEmail == "" {
-		fromEmail = m.from
-	}
-	msg.SetHeader("From", fromEmail)
-	msg.SetHeader("To", email.To...)
+func (m *MailHogProvider) setHeaders(msg *gomail.Message, env *envelope, email *models.EmailMessage) {
+	env.setAddressHeaders(msg)
 	msg.SetHeader("Subject", email.Subject)
+	setMessageHeaders(msg, email)
 	msg.SetHeader("X-Mailer", "HandyHub Email Service")
 	msg.SetHeader("X-Environment", "development")
 }
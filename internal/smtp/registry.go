@@ -0,0 +1,53 @@
+package smtp
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/sirupsen/logrus"
+)
+
+var log = logrus.StandardLogger()
+
+// ProviderRegistry holds the named provider instances, e.g. separate
+// SendGrid accounts for transactional and marketing mail.
+type ProviderRegistry struct {
+	providers   map[string]SMTPProvider
+	defaultName string
+}
+
+func NewProviderRegistry(providers map[string]SMTPProvider, defaultName string) (*ProviderRegistry, error) {
+	if _, ok := providers[defaultName]; !ok {
+		return nil, fmt.Errorf("default SMTP provider %q is not configured", defaultName)
+	}
+	return &ProviderRegistry{
+		providers:   providers,
+		defaultName: defaultName,
+	}, nil
+}
+
+// Resolve returns the instance with the given name, or the default instance
+// when name is empty.
+func (r *ProviderRegistry) Resolve(name string) (string, SMTPProvider, error) {
+	if name == "" {
+		name = r.defaultName
+	}
+	provider, ok := r.providers[name]
+	if !ok {
+		return "", nil, fmt.Errorf("unknown SMTP provider %q", name)
+	}
+	return name, provider, nil
+}
+
+func (r *ProviderRegistry) DefaultName() string {
+	return r.defaultName
+}
+
+func (r *ProviderRegistry) Names() []string {
+	names := make([]string, 0, len(r.providers))
+	for name := range r.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
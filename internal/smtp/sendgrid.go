@@ -3,10 +3,13 @@ package smtp
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"handyhub-email-svc/internal/config"
 	"handyhub-email-svc/internal/models"
+	"net"
 	"net/http"
+	"net/mail"
 )
 
 type SendGridProvider struct {
@@ -19,6 +22,7 @@ type sendGridMessage struct {
 	From             sendGridEmail             `json:"from"`
 	Subject          string                    `json:"subject"`
 	Content          []sendGridContent         `json:"content"`
+	Headers          map[string]string         `json:"headers,omitempty"`
 }
 type sendGridPersonalization struct {
 	To []sendGridEmail `json:"to"`
@@ -26,6 +30,7 @@ type sendGridPersonalization struct {
 
 type sendGridEmail struct {
 	Email string `json:"email"`
+	Name  string `json:"name,omitempty"`
 }
 
 type sendGridContent struct {
@@ -40,51 +45,60 @@ func NewSendGridProvider(cfg config.SendGridConfig, from string) *SendGridProvid
 	}
 }
 
-func (s *SendGridProvider) SendEmail(email *models.EmailMessage) error {
-	if len(email.To) == 0 {
-		return fmt.Errorf("no recipients specified")
+func (s *SendGridProvider) SendEmail(email *models.EmailMessage) (string, error) {
+	if email.Sign || email.Encrypt {
+		return "", fmt.Errorf("S/MIME is not supported by the SendGrid provider")
 	}
 
-	to := s.buildRecipients(email.To)
-	content, err := s.buildContent(email)
+	env, err := newEnvelope(email, s.from)
 	if err != nil {
-		return err
+		return "", err
 	}
 
-	fromEmail := email.From
-	if fromEmail == "" {
-		fromEmail = s.from
+	to := s.buildRecipients(env.to)
+	content, err := s.buildContent(email)
+	if err != nil {
+		return "", err
 	}
 
-	message := s.buildMessage(to, fromEmail, email.Subject, content)
+	message := s.buildMessage(to, s.buildEmail(env.from), email.Subject, content)
+	message.Headers = messageHeaders(email)
 	jsonData, err := json.Marshal(message)
 	if err != nil {
-		return fmt.Errorf("failed to marshal SendGrid message: %w", err)
+		return "", fmt.Errorf("failed to marshal SendGrid message: %w", err)
 	}
 
 	req, err := s.createRequest(jsonData)
 	if err != nil {
-		return err
+		return "", err
 	}
 
 	s.setHeaders(req)
 	resp, err := s.sendRequest(req)
 	if err != nil {
-		return err
+		return "", err
 	}
 	defer resp.Body.Close()
 
-	return s.handleResponse(resp)
+	if err := s.handleResponse(resp); err != nil {
+		return "", err
+	}
+	return resp.Header.Get("X-Message-Id"), nil
 }
 
-func (s *SendGridProvider) buildRecipients(recipients []string) []sendGridEmail {
+func (s *SendGridProvider) buildRecipients(recipients []*mail.Address) []sendGridEmail {
 	to := make([]sendGridEmail, 0, len(recipients))
 	for _, recipient := range recipients {
-		to = append(to, sendGridEmail{Email: recipient})
+		to = append(to, s.buildEmail(recipient))
 	}
 	return to
 }
 
+// buildEmail keeps the display name unencoded, SendGrid applies RFC 2047 itself.
+func (s *SendGridProvider) buildEmail(addr *mail.Address) sendGridEmail {
+	return sendGridEmail{Email: addr.Address, Name: addr.Name}
+}
+
 func (s *SendGridProvider) buildContent(email *models.EmailMessage) ([]sendGridContent, error) {
 	var content []sendGridContent
 	if email.BodyText != "" {
@@ -105,10 +119,10 @@ func (s *SendGridProvider) buildContent(email *models.EmailMessage) ([]sendGridC
 	return content, nil
 }
 
-func (s *SendGridProvider) buildMessage(to []sendGridEmail, from, subject string, content []sendGridContent) sendGridMessage {
+func (s *SendGridProvider) buildMessage(to []sendGridEmail, from sendGridEmail, subject string, content []sendGridContent) sendGridMessage {
 	return sendGridMessage{
 		Personalizations: []sendGridPersonalization{{To: to}},
-		From:             sendGridEmail{Email: from},
+		From:             from,
 		Subject:          subject,
 		Content:          content,
 	}
@@ -131,12 +145,21 @@ func (s *SendGridProvider) sendRequest(req *http.Request) (*http.Response, error
 	client := &http.Client{}
 	resp, err := client.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to send request to SendGrid: %w", err)
+		err = fmt.Errorf("failed to send request to SendGrid: %w", err)
+		// once connected the request may have been accepted before it failed
+		var opErr *net.OpError
+		if errors.As(err, &opErr) && opErr.Op == "dial" {
+			return nil, err
+		}
+		return nil, &UnconfirmedError{Err: err}
 	}
 	return resp, nil
 }
 
 func (s *SendGridProvider) handleResponse(resp *http.Response) error {
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError {
+		return &TransientError{Err: fmt.Errorf("SendGrid API returned status %d", resp.StatusCode)}
+	}
 	if resp.StatusCode != http.StatusAccepted {
 		return fmt.Errorf("SendGrid API returned status %d", resp.StatusCode)
 	}
@@ -0,0 +1,38 @@
+package smtp
+
+import (
+	"bytes"
+	"fmt"
+	"handyhub-email-svc/internal/models"
+	"handyhub-email-svc/internal/smime"
+	"io"
+
+	"gopkg.in/gomail.v2"
+)
+
+// secureMessage renders msg and signs and/or encrypts it when the email asks
+// for S/MIME, otherwise msg is returned as is.
+func secureMessage(service *smime.Service, msg *gomail.Message, env *envelope, email *models.EmailMessage) (io.WriterTo, error) {
+	if !email.Sign && !email.Encrypt {
+		return msg, nil
+	}
+	if service == nil {
+		return nil, fmt.Errorf("S/MIME requested but smtp.smime is not enabled")
+	}
+
+	var buf bytes.Buffer
+	if _, err := msg.WriteTo(&buf); err != nil {
+		return nil, fmt.Errorf("failed to render message: %w", err)
+	}
+
+	recipients := make([]string, 0, len(env.to))
+	for _, addr := range env.to {
+		recipients = append(recipients, addr.Address)
+	}
+
+	raw, err := service.Apply(buf.Bytes(), env.from.Address, recipients, email.Sign, email.Encrypt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to apply S/MIME: %w", err)
+	}
+	return bytes.NewReader(raw), nil
+}
@@ -0,0 +1,111 @@
+package smtp
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"time"
+)
+
+const dialTimeout = 10 * time.Second
+
+// smtpTransport delivers gomail messages over SMTP. It is used instead of
+// gomail.Dialer because the envelope may carry SMTPUTF8 addresses, which
+// requires checking the server capabilities before MAIL FROM.
+type smtpTransport struct {
+	host     string
+	port     int
+	username string
+	password string
+}
+
+func (t *smtpTransport) send(env *envelope, msg io.WriterTo) error {
+	client, err := t.dial()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if env.needsSMTPUTF8() {
+		if ok, _ := client.Extension("SMTPUTF8"); !ok {
+			return fmt.Errorf("server %s does not support SMTPUTF8 required for non-ASCII addresses", t.host)
+		}
+	}
+
+	// net/smtp adds the SMTPUTF8 parameter itself when the server advertises it
+	if err := client.Mail(env.from.Address); err != nil {
+		return fmt.Errorf("MAIL FROM rejected: %w", err)
+	}
+	for _, addr := range env.to {
+		if err := client.Rcpt(addr.Address); err != nil {
+			return fmt.Errorf("RCPT TO %s rejected: %w", addr.Address, err)
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := msg.WriteTo(w); err != nil {
+		w.Close()
+		return err
+	}
+	if err := w.Close(); err != nil {
+		// a reply is the server's verdict, anything else leaves it unknown
+		var reply *textproto.Error
+		if errors.As(err, &reply) {
+			return err
+		}
+		return &UnconfirmedError{Err: err}
+	}
+
+	// the server accepted the message with the reply to DATA, failing now
+	// would retry an email that is already on its way
+	if err := client.Quit(); err != nil {
+		log.WithError(err).WithField("host", t.host).Warn("SMTP QUIT failed after the message was accepted")
+	}
+	return nil
+}
+
+func (t *smtpTransport) dial() (*smtp.Client, error) {
+	implicitTLS := t.port == 465
+
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(t.host, strconv.Itoa(t.port)), dialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	if implicitTLS {
+		conn = tls.Client(conn, &tls.Config{ServerName: t.host})
+	}
+
+	client, err := smtp.NewClient(conn, t.host)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if !implicitTLS {
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			if err := client.StartTLS(&tls.Config{ServerName: t.host}); err != nil {
+				client.Close()
+				return nil, err
+			}
+		}
+	}
+
+	if t.username != "" {
+		if ok, _ := client.Extension("AUTH"); ok {
+			if err := client.Auth(smtp.PlainAuth("", t.username, t.password, t.host)); err != nil {
+				client.Close()
+				return nil, err
+			}
+		}
+	}
+
+	return client, nil
+}
@@ -0,0 +1,182 @@
+package smtp
+
+import (
+	"bufio"
+	"handyhub-email-svc/internal/config"
+	"handyhub-email-svc/internal/models"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+)
+
+// fakeServer is an SMTP server that accepts one message and records the
+// commands and data it received.
+type fakeServer struct {
+	host       string
+	port       int
+	extensions []string
+	commands   []string
+	data       string
+	done       chan struct{}
+}
+
+func newFakeServer(t *testing.T, extensions ...string) *fakeServer {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	addr := listener.Addr().(*net.TCPAddr)
+	s := &fakeServer{host: addr.IP.String(), port: addr.Port, extensions: extensions, done: make(chan struct{})}
+	go s.serve(listener)
+	return s
+}
+
+func (s *fakeServer) serve(listener net.Listener) {
+	defer close(s.done)
+	conn, err := listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	text := textproto.NewConn(conn)
+	text.PrintfLine("220 fake ESMTP")
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		s.commands = append(s.commands, line)
+		verb := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch verb {
+		case "EHLO":
+			text.PrintfLine("250-fake")
+			for _, ext := range s.extensions {
+				text.PrintfLine("250-%s", ext)
+			}
+			text.PrintfLine("250 8BITMIME")
+		case "DATA":
+			text.PrintfLine("354 go ahead")
+			data, err := text.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			s.data = string(data)
+			text.PrintfLine("250 queued")
+		case "QUIT":
+			text.PrintfLine("221 bye")
+			return
+		default:
+			text.PrintfLine("250 ok")
+		}
+	}
+}
+
+// command returns the first received command starting with prefix.
+func (s *fakeServer) command(prefix string) string {
+	for _, command := range s.commands {
+		if strings.HasPrefix(command, prefix) {
+			return command
+		}
+	}
+	return ""
+}
+
+func (s *fakeServer) header(name string) string {
+	reader := textproto.NewReader(bufio.NewReader(strings.NewReader(s.data)))
+	header, _ := reader.ReadMIMEHeader()
+	return header.Get(name)
+}
+
+func sendVia(t *testing.T, s *fakeServer, email *models.EmailMessage) error {
+	t.Helper()
+	provider := NewMailHogProvider(config.MailHogConfig{Host: s.host, Port: s.port}, "HandyHub <noreply@handyhub.example>", nil)
+	_, err := provider.SendEmail(email)
+	<-s.done
+	return err
+}
+
+func TestSendSMTPUTF8(t *testing.T) {
+	tests := []struct {
+		name       string
+		extensions []string
+		to         string
+		mail       string
+		rcpt       string
+		wantErr    bool
+	}{
+		{
+			name: "ASCII local part with IDNA domain",
+			to:   "ivan@пример.рф",
+			mail: "MAIL FROM:<noreply@handyhub.example> BODY=8BITMIME",
+			rcpt: "RCPT TO:<ivan@xn--e1afmkfd.xn--p1ai>",
+		},
+		{
+			name:       "UTF-8 local part with SMTPUTF8",
+			extensions: []string{"SMTPUTF8"},
+			to:         "иван@пример.рф",
+			mail:       "MAIL FROM:<noreply@handyhub.example> BODY=8BITMIME SMTPUTF8",
+			rcpt:       "RCPT TO:<иван@xn--e1afmkfd.xn--p1ai>",
+		},
+		{
+			name:    "UTF-8 local part without SMTPUTF8",
+			to:      "иван@пример.рф",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newFakeServer(t, tt.extensions...)
+			err := sendVia(t, server, &models.EmailMessage{To: []string{tt.to}, Subject: "Hi", BodyText: "Hello"})
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("SendEmail succeeded, want an error")
+				}
+				if server.command("MAIL") != "" {
+					t.Errorf("sent %q to a server without SMTPUTF8", server.command("MAIL"))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("SendEmail: %v", err)
+			}
+			if got := server.command("MAIL"); got != tt.mail {
+				t.Errorf("MAIL = %q, want %q", got, tt.mail)
+			}
+			if got := server.command("RCPT"); got != tt.rcpt {
+				t.Errorf("RCPT = %q, want %q", got, tt.rcpt)
+			}
+		})
+	}
+}
+
+func TestSendEncodesHeaders(t *testing.T) {
+	server := newFakeServer(t)
+	err := sendVia(t, server, &models.EmailMessage{
+		From:     "Иван Петров <ivan@пример.рф>",
+		To:       []string{"Ann <ann@example.com>"},
+		Subject:  "Привет\r\nBcc: eve@example.com",
+		BodyText: "Hello",
+		Headers:  map[string]string{"X-Campaign": "spring\r\nBcc: eve@example.com"},
+	})
+	if err != nil {
+		t.Fatalf("SendEmail: %v", err)
+	}
+
+	if strings.Contains(server.data, "\nBcc:") || server.header("Bcc") != "" {
+		t.Errorf("message has an injected Bcc header:\n%s", server.data)
+	}
+	if got := server.header("X-Campaign"); got != "" {
+		t.Errorf("X-Campaign = %q, want the multi-line header dropped", got)
+	}
+	if from := server.header("From"); !strings.HasPrefix(from, "=?utf-8?") || !strings.HasSuffix(from, "<ivan@xn--e1afmkfd.xn--p1ai>") {
+		t.Errorf("From = %q, want an RFC 2047 name and the IDNA domain", from)
+	}
+	if subject := server.header("Subject"); !strings.HasPrefix(subject, "=?UTF-8?") {
+		t.Errorf("Subject = %q, want it RFC 2047 encoded", subject)
+	}
+}
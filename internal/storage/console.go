@@ -4,6 +4,7 @@ import (
 	"handyhub-email-svc/internal/models"
 
 	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type ConsoleStorage struct{}
@@ -26,6 +27,36 @@ func (cs *ConsoleStorage) Store(emailLog *models.EmailLog) error {
 	return nil
 }
 
+func (cs *ConsoleStorage) AddEvent(id primitive.ObjectID, event models.DeliveryEvent) error {
+	logrus.WithFields(logrus.Fields{
+		"id":    id.Hex(),
+		"event": event.Type,
+	}).Info("Email log event")
+
+	return nil
+}
+
+// FindByThreadKey has nothing to search, console storage keeps no history.
+func (cs *ConsoleStorage) FindByThreadKey(threadKey string, limit int) ([]*models.EmailLog, error) {
+	return nil, nil
+}
+
+func (cs *ConsoleStorage) FindByID(id primitive.ObjectID) (*models.EmailLog, error) {
+	return nil, ErrNotFound
+}
+
+func (cs *ConsoleStorage) FindByTrackingID(trackingID string) ([]*models.EmailLog, error) {
+	return nil, nil
+}
+
+func (cs *ConsoleStorage) FindByMessageID(messageID string) (*models.EmailLog, error) {
+	return nil, ErrNotFound
+}
+
+func (cs *ConsoleStorage) FindByProviderMessageID(providerMessageID string) (*models.EmailLog, error) {
+	return nil, ErrNotFound
+}
+
 func (cs *ConsoleStorage) Close() error {
 	log.Info("Console storage closed")
 	return nil
@@ -2,11 +2,15 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"handyhub-email-svc/internal/database"
 	"handyhub-email-svc/internal/models"
 	"time"
 
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type DatabaseStorage struct {
@@ -17,6 +21,11 @@ type DatabaseStorage struct {
 func NewDatabaseStorage(mongodb *database.MongoDB, collectionName string) (*DatabaseStorage, error) {
 	collection := mongodb.Database.Collection(collectionName)
 
+	if err := ensureIndexes(collection); err != nil {
+		log.WithError(err).Error("Failed to create email log indexes")
+		return nil, err
+	}
+
 	log.Info("Database storage initialized")
 
 	return &DatabaseStorage{
@@ -28,7 +37,7 @@ func NewDatabaseStorage(mongodb *database.MongoDB, collectionName string) (*Data
 func (ds *DatabaseStorage) Store(emailLog *models.EmailLog) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
-	_, err := ds.collection.InsertOne(ctx, emailLog)
+	_, err := ds.collection.ReplaceOne(ctx, bson.M{"_id": emailLog.ID}, emailLog, options.Replace().SetUpsert(true))
 	if err != nil {
 		log.WithError(err).Error("Failed to store email log in database")
 		return err
@@ -39,7 +48,146 @@ func (ds *DatabaseStorage) Store(emailLog *models.EmailLog) error {
 	return nil
 }
 
+func (ds *DatabaseStorage) AddEvent(id primitive.ObjectID, event models.DeliveryEvent) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if event.Type == models.EventOpened {
+		return ds.addOpen(ctx, id, event)
+	}
+
+	result, err := ds.collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$push": bson.M{"events": event}})
+	if err != nil {
+		log.WithError(err).Error("Failed to add event to email log in database")
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+
+	// concurrent events race here, the filter keeps the higher ranked status
+	if status, ok := event.Status(); ok {
+		filter := bson.M{"_id": id, "status": bson.M{"$nin": models.OutrankingStatuses(status)}}
+		if _, err := ds.collection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"status": status}}); err != nil {
+			log.WithError(err).Error("Failed to update email log status in database")
+			return err
+		}
+	}
+
+	log.Info("Email log event added in database")
+	return nil
+}
+
+// addOpen counts the open and pushes the event only for the first one.
+func (ds *DatabaseStorage) addOpen(ctx context.Context, id primitive.ObjectID, event models.DeliveryEvent) error {
+	result, err := ds.collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$inc": bson.M{"opens": 1}})
+	if err != nil {
+		log.WithError(err).Error("Failed to count open of email log in database")
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+
+	filter := bson.M{"_id": id, "events.type": bson.M{"$ne": models.EventOpened}}
+	if _, err := ds.collection.UpdateOne(ctx, filter, bson.M{"$push": bson.M{"events": event}}); err != nil {
+		log.WithError(err).Error("Failed to add open to email log in database")
+		return err
+	}
+	return nil
+}
+
+func (ds *DatabaseStorage) FindByID(id primitive.ObjectID) (*models.EmailLog, error) {
+	return ds.findOne(bson.M{"_id": id})
+}
+
+func (ds *DatabaseStorage) FindByMessageID(messageID string) (*models.EmailLog, error) {
+	return ds.findOne(bson.M{"message_id": messageID})
+}
+
+func (ds *DatabaseStorage) FindByProviderMessageID(providerMessageID string) (*models.EmailLog, error) {
+	return ds.findOne(bson.M{"provider_message_id": providerMessageID})
+}
+
+func (ds *DatabaseStorage) findOne(filter bson.M) (*models.EmailLog, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var emailLog models.EmailLog
+	opts := options.FindOne().SetSort(bson.D{{Key: "sent_at", Value: -1}})
+	err := ds.collection.FindOne(ctx, filter, opts).Decode(&emailLog)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		log.WithError(err).Error("Failed to find email log in database")
+		return nil, err
+	}
+	return &emailLog, nil
+}
+
+func (ds *DatabaseStorage) FindByThreadKey(threadKey string, limit int) ([]*models.EmailLog, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{
+		"thread_key": threadKey,
+		"status":     bson.M{"$in": models.SentStatuses()},
+		"message_id": bson.M{"$exists": true},
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "sent_at", Value: -1}}).SetLimit(int64(limit))
+
+	cursor, err := ds.collection.Find(ctx, filter, opts)
+	if err != nil {
+		log.WithError(err).Error("Failed to find thread in database")
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var logs []*models.EmailLog
+	if err := cursor.All(ctx, &logs); err != nil {
+		return nil, err
+	}
+
+	for i, j := 0, len(logs)-1; i < j; i, j = i+1, j-1 {
+		logs[i], logs[j] = logs[j], logs[i]
+	}
+	return logs, nil
+}
+
+func (ds *DatabaseStorage) FindByTrackingID(trackingID string) ([]*models.EmailLog, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "sent_at", Value: 1}})
+	cursor, err := ds.collection.Find(ctx, bson.M{"tracking_id": trackingID}, opts)
+	if err != nil {
+		log.WithError(err).Error("Failed to find email logs by tracking ID in database")
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var logs []*models.EmailLog
+	if err := cursor.All(ctx, &logs); err != nil {
+		return nil, err
+	}
+	return logs, nil
+}
+
 func (ds *DatabaseStorage) Close() error {
 	log.Info("Database storage closed")
 	return nil
 }
+
+func ensureIndexes(collection *mongo.Collection) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "message_id", Value: 1}}},
+		{Keys: bson.D{{Key: "provider_message_id", Value: 1}}},
+		{Keys: bson.D{{Key: "tracking_id", Value: 1}}},
+		{Keys: bson.D{{Key: "thread_key", Value: 1}, {Key: "sent_at", Value: -1}}},
+	})
+	return err
+}
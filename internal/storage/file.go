@@ -1,16 +1,23 @@
 package storage
 
 import (
+	"bufio"
 	"encoding/json"
 	"handyhub-email-svc/internal/config"
 	"handyhub-email-svc/internal/models"
 	"os"
 	"path/filepath"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// FileStorage appends email logs as JSON lines. Updates append a new version
+// of the log, the latest line for an ID wins when reading.
 type FileStorage struct {
 	config config.FileStorageConfig
 	file   *os.File
+	mu     sync.Mutex
 }
 
 func NewFileStorage(cfg config.FileStorageConfig) (*FileStorage, error) {
@@ -33,6 +40,40 @@ func NewFileStorage(cfg config.FileStorageConfig) (*FileStorage, error) {
 }
 
 func (fs *FileStorage) Store(emailLog *models.EmailLog) error {
+	if err := fs.write(emailLog); err != nil {
+		return err
+	}
+	log.Info("Email log entry stored in file")
+	return nil
+}
+
+// AddEvent holds the write lock while it reads the latest version of the log,
+// so concurrent events cannot overwrite each other.
+func (fs *FileStorage) AddEvent(id primitive.ObjectID, event models.DeliveryEvent) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	emailLog, err := fs.findOne(func(emailLog *models.EmailLog) bool {
+		return emailLog.ID == id
+	})
+	if err != nil {
+		return err
+	}
+	emailLog.ApplyEvent(event)
+	if err := fs.writeLocked(emailLog); err != nil {
+		return err
+	}
+	log.Info("Email log event added in file")
+	return nil
+}
+
+func (fs *FileStorage) write(emailLog *models.EmailLog) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return fs.writeLocked(emailLog)
+}
+
+func (fs *FileStorage) writeLocked(emailLog *models.EmailLog) error {
 	data, err := json.Marshal(emailLog)
 	if err != nil {
 		return err
@@ -40,11 +81,109 @@ func (fs *FileStorage) Store(emailLog *models.EmailLog) error {
 
 	data = append(data, '\n')
 	_, err = fs.file.Write(data)
+	return err
+}
+
+// FindByThreadKey scans the whole log file, it is meant for development
+// volumes only.
+func (fs *FileStorage) FindByThreadKey(threadKey string, limit int) ([]*models.EmailLog, error) {
+	all, err := fs.latest()
+	if err != nil {
+		return nil, err
+	}
+
+	var logs []*models.EmailLog
+	for _, emailLog := range all {
+		if emailLog.ThreadKey == threadKey && emailLog.WasSent() && emailLog.MessageID != "" {
+			logs = append(logs, emailLog)
+		}
+	}
+
+	if len(logs) > limit {
+		logs = logs[len(logs)-limit:]
+	}
+	return logs, nil
+}
+
+func (fs *FileStorage) FindByID(id primitive.ObjectID) (*models.EmailLog, error) {
+	return fs.findOne(func(emailLog *models.EmailLog) bool {
+		return emailLog.ID == id
+	})
+}
+
+func (fs *FileStorage) FindByTrackingID(trackingID string) ([]*models.EmailLog, error) {
+	all, err := fs.latest()
+	if err != nil {
+		return nil, err
+	}
+
+	var logs []*models.EmailLog
+	for _, emailLog := range all {
+		if emailLog.TrackingID == trackingID {
+			logs = append(logs, emailLog)
+		}
+	}
+	return logs, nil
+}
+
+func (fs *FileStorage) FindByMessageID(messageID string) (*models.EmailLog, error) {
+	return fs.findOne(func(emailLog *models.EmailLog) bool {
+		return emailLog.MessageID == messageID
+	})
+}
+
+func (fs *FileStorage) FindByProviderMessageID(providerMessageID string) (*models.EmailLog, error) {
+	return fs.findOne(func(emailLog *models.EmailLog) bool {
+		return emailLog.ProviderMessageID == providerMessageID
+	})
+}
+
+func (fs *FileStorage) findOne(match func(emailLog *models.EmailLog) bool) (*models.EmailLog, error) {
+	all, err := fs.latest()
+	if err != nil {
+		return nil, err
+	}
+	for i := len(all) - 1; i >= 0; i-- {
+		if match(all[i]) {
+			return all[i], nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// latest returns the current version of every log in insertion order.
+func (fs *FileStorage) latest() ([]*models.EmailLog, error) {
+	var logs []*models.EmailLog
+	index := make(map[string]int)
+	err := fs.scan(func(emailLog *models.EmailLog) {
+		id := emailLog.ID.Hex()
+		if i, ok := index[id]; ok {
+			logs[i] = emailLog
+			return
+		}
+		index[id] = len(logs)
+		logs = append(logs, emailLog)
+	})
+	return logs, err
+}
+
+func (fs *FileStorage) scan(fn func(emailLog *models.EmailLog)) error {
+	file, err := os.Open(fs.config.Path)
 	if err != nil {
 		return err
 	}
-	log.Info("Email log entry stored in file")
-	return nil
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+	for scanner.Scan() {
+		var emailLog models.EmailLog
+		if err := json.Unmarshal(scanner.Bytes(), &emailLog); err != nil {
+			continue
+		}
+		fn(&emailLog)
+	}
+	return scanner.Err()
 }
 
 func (fs *FileStorage) Close() error {
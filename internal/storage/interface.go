@@ -1,8 +1,27 @@
 package storage
 
-import "handyhub-email-svc/internal/models"
+import (
+	"errors"
+	"handyhub-email-svc/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var ErrNotFound = errors.New("email log not found")
 
 type EmailStorage interface {
+	// Store inserts a log, or replaces the stored log with the same ID
 	Store(emailLog *models.EmailLog) error
+	// AddEvent appends a delivery event to a stored log and advances its
+	// status in one step, a lower ranked event never moves the status back
+	AddEvent(id primitive.ObjectID, event models.DeliveryEvent) error
+	// FindByThreadKey returns up to limit of the latest sent emails of a
+	// thread, oldest first
+	FindByThreadKey(threadKey string, limit int) ([]*models.EmailLog, error)
+	FindByID(id primitive.ObjectID) (*models.EmailLog, error)
+	// FindByTrackingID returns every log of a queued message, oldest first
+	FindByTrackingID(trackingID string) ([]*models.EmailLog, error)
+	FindByMessageID(messageID string) (*models.EmailLog, error)
+	FindByProviderMessageID(providerMessageID string) (*models.EmailLog, error)
 	Close() error
 }
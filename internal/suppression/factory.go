@@ -0,0 +1,17 @@
+package suppression
+
+import (
+	"handyhub-email-svc/internal/config"
+	"handyhub-email-svc/internal/database"
+
+	"github.com/sirupsen/logrus"
+)
+
+func NewStore(cfg *config.Configuration, mongodb *database.MongoDB) (Store, error) {
+	if cfg.Storage.Type == "database" {
+		logrus.Info("Using Database Suppression Store")
+		return NewMongoStore(mongodb, cfg.Suppression.Collection)
+	}
+	logrus.Info("Using In-Memory Suppression Store")
+	return NewMemoryStore(), nil
+}
@@ -0,0 +1,77 @@
+package suppression
+
+import (
+	"handyhub-email-svc/internal/models"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps suppressions in process memory, used with console and
+// file storage. Its content is lost on restart.
+type MemoryStore struct {
+	mu           sync.RWMutex
+	suppressions map[string]*models.Suppression
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{suppressions: make(map[string]*models.Suppression)}
+}
+
+func (m *MemoryStore) Put(suppression *models.Suppression) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored := *suppression
+	m.suppressions[suppression.Address] = &stored
+	return nil
+}
+
+func (m *MemoryStore) Get(address string) (*models.Suppression, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	suppression, ok := m.suppressions[address]
+	if !ok || suppression.Expired(time.Now()) {
+		return nil, ErrNotFound
+	}
+	found := *suppression
+	return &found, nil
+}
+
+func (m *MemoryStore) Delete(address string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.suppressions[address]; !ok {
+		return ErrNotFound
+	}
+	delete(m.suppressions, address)
+	return nil
+}
+
+func (m *MemoryStore) List(offset, limit int) ([]*models.Suppression, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	list := make([]*models.Suppression, 0, len(m.suppressions))
+	for address, suppression := range m.suppressions {
+		if suppression.Expired(now) {
+			delete(m.suppressions, address)
+			continue
+		}
+		found := *suppression
+		list = append(list, &found)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.After(list[j].CreatedAt) })
+
+	if offset >= len(list) {
+		return []*models.Suppression{}, nil
+	}
+	list = list[offset:]
+	if limit > 0 && limit < len(list) {
+		list = list[:limit]
+	}
+	return list, nil
+}
@@ -0,0 +1,102 @@
+package suppression
+
+import (
+	"context"
+	"errors"
+	"handyhub-email-svc/internal/database"
+	"handyhub-email-svc/internal/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoStore keeps suppressions in MongoDB, a TTL index removes expired ones.
+type MongoStore struct {
+	collection *mongo.Collection
+}
+
+func NewMongoStore(mongodb *database.MongoDB, collectionName string) (*MongoStore, error) {
+	collection := mongodb.Database.Collection(collectionName)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &MongoStore{collection: collection}, nil
+}
+
+func (m *MongoStore) Put(suppression *models.Suppression) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := m.collection.ReplaceOne(ctx, bson.M{"_id": suppression.Address}, suppression, options.Replace().SetUpsert(true))
+	return err
+}
+
+func (m *MongoStore) Get(address string) (*models.Suppression, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var suppression models.Suppression
+	err := m.collection.FindOne(ctx, bson.M{"_id": address}).Decode(&suppression)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// the TTL monitor only runs once a minute
+	if suppression.Expired(time.Now()) {
+		return nil, ErrNotFound
+	}
+	return &suppression, nil
+}
+
+func (m *MongoStore) Delete(address string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := m.collection.DeleteOne(ctx, bson.M{"_id": address})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (m *MongoStore) List(offset, limit int) ([]*models.Suppression, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"$or": bson.A{
+		bson.M{"expires_at": bson.M{"$exists": false}},
+		bson.M{"expires_at": bson.M{"$gt": time.Now()}},
+	}}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}}).
+		SetSkip(int64(offset)).
+		SetLimit(int64(limit))
+
+	cursor, err := m.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	list := []*models.Suppression{}
+	if err := cursor.All(ctx, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
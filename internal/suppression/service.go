@@ -0,0 +1,170 @@
+package suppression
+
+import (
+	"errors"
+	"fmt"
+	"handyhub-email-svc/internal/config"
+	"handyhub-email-svc/internal/models"
+	"handyhub-email-svc/internal/smtp"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+var log = logrus.StandardLogger()
+
+type Service struct {
+	store  Store
+	expiry map[string]time.Duration
+}
+
+func NewService(cfg config.SuppressionConfig, store Store) *Service {
+	expiry := make(map[string]time.Duration, len(cfg.ExpiryDays))
+	for reason, days := range cfg.ExpiryDays {
+		if days > 0 {
+			expiry[strings.ToLower(reason)] = time.Duration(days) * 24 * time.Hour
+		}
+	}
+	return &Service{store: store, expiry: expiry}
+}
+
+// Suppress adds or updates the suppression of an address. Without an
+// explicit expiry the configured one for the reason applies. An existing
+// suppression keeps a stronger reason and is never shortened, remove it first
+// to lift it earlier.
+func (s *Service) Suppress(address, reason, note string, expiresAt *time.Time) (*models.Suppression, error) {
+	if !models.IsSuppressionReason(reason) {
+		return nil, fmt.Errorf("unknown suppression reason: %s", reason)
+	}
+	normalized, err := Normalize(address)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if expiresAt == nil {
+		if ttl, ok := s.expiry[reason]; ok {
+			expires := now.Add(ttl)
+			expiresAt = &expires
+		}
+	}
+
+	suppression := &models.Suppression{
+		Address:   normalized,
+		Reason:    reason,
+		Note:      note,
+		CreatedAt: now,
+		ExpiresAt: expiresAt,
+	}
+
+	existing, err := s.store.Get(normalized)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return nil, fmt.Errorf("failed to load suppression for %s: %w", normalized, err)
+	}
+	if existing != nil {
+		suppression = merge(existing, suppression)
+	}
+
+	if err := s.store.Put(suppression); err != nil {
+		return nil, fmt.Errorf("failed to store suppression for %s: %w", normalized, err)
+	}
+
+	log.WithFields(logrus.Fields{
+		"address": normalized,
+		"reason":  suppression.Reason,
+	}).Info("Address suppressed")
+	return suppression, nil
+}
+
+// merge keeps the stronger reason of both suppressions and the later expiry.
+func merge(existing, added *models.Suppression) *models.Suppression {
+	merged := *added
+	merged.CreatedAt = existing.CreatedAt
+	if models.SuppressionOutranks(existing.Reason, added.Reason) {
+		merged.Reason = existing.Reason
+		merged.Note = existing.Note
+	}
+	if existing.ExpiresAt == nil || (added.ExpiresAt != nil && existing.ExpiresAt.After(*added.ExpiresAt)) {
+		merged.ExpiresAt = existing.ExpiresAt
+	}
+	return &merged
+}
+
+func (s *Service) Remove(address string) error {
+	normalized, err := Normalize(address)
+	if err != nil {
+		return err
+	}
+	return s.store.Delete(normalized)
+}
+
+func (s *Service) Get(address string) (*models.Suppression, error) {
+	normalized, err := Normalize(address)
+	if err != nil {
+		return nil, err
+	}
+	return s.store.Get(normalized)
+}
+
+func (s *Service) List(offset, limit int) ([]*models.Suppression, error) {
+	return s.store.List(offset, limit)
+}
+
+// Filter splits recipients into those that may be sent to and the active
+// suppressions of the others. Unparsable addresses are left to the provider.
+func (s *Service) Filter(recipients []string) ([]string, []*models.Suppression, error) {
+	allowed := make([]string, 0, len(recipients))
+	var suppressed []*models.Suppression
+	for _, recipient := range recipients {
+		normalized, err := Normalize(recipient)
+		if err != nil {
+			allowed = append(allowed, recipient)
+			continue
+		}
+
+		suppression, err := s.store.Get(normalized)
+		if errors.Is(err, ErrNotFound) {
+			allowed = append(allowed, recipient)
+			continue
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to check suppression for %s: %w", normalized, err)
+		}
+		suppressed = append(suppressed, suppression)
+	}
+	return allowed, suppressed, nil
+}
+
+// Record suppresses the recipients of hard bounces and spam complaints.
+func (s *Service) Record(event models.DeliveryEvent) error {
+	var reason string
+	switch event.Type {
+	case models.EventBounced:
+		reason = models.SuppressionBounce
+	case models.EventComplaint:
+		reason = models.SuppressionComplaint
+	default:
+		return nil
+	}
+	if event.Recipient == "" {
+		return nil
+	}
+
+	note := event.Provider
+	if event.Reason != "" {
+		note = fmt.Sprintf("%s: %s", event.Provider, event.Reason)
+	}
+	_, err := s.Suppress(event.Recipient, reason, note, nil)
+	return err
+}
+
+// Normalize reduces an address, possibly with a display name, to the
+// lowercase bare form suppressions are keyed by.
+func Normalize(address string) (string, error) {
+	parsed, err := smtp.ParseAddress(address)
+	if err != nil {
+		return "", err
+	}
+	return strings.ToLower(parsed.Address), nil
+}
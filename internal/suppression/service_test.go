@@ -0,0 +1,79 @@
+package suppression
+
+import (
+	"handyhub-email-svc/internal/config"
+	"handyhub-email-svc/internal/models"
+	"testing"
+	"time"
+)
+
+func TestSuppressKeepsStrongerSuppression(t *testing.T) {
+	in := func(d time.Duration) *time.Time {
+		at := time.Now().Add(d)
+		return &at
+	}
+	const day = 24 * time.Hour
+	bounce := models.DeliveryEvent{Type: models.EventBounced, Provider: "dsn", Recipient: "Ann <ann@example.com>"}
+
+	tests := []struct {
+		name       string
+		reason     string
+		expiresAt  *time.Time
+		wantReason string
+		// wantExpiry is the remaining lifetime, 0 never expires
+		wantExpiry time.Duration
+	}{
+		{name: "permanent complaint", reason: models.SuppressionComplaint, wantReason: models.SuppressionComplaint},
+		{name: "permanent manual", reason: models.SuppressionManual, wantReason: models.SuppressionManual},
+		{name: "manual is extended", reason: models.SuppressionManual, expiresAt: in(time.Hour), wantReason: models.SuppressionManual, wantExpiry: 90 * day},
+		{name: "manual is not shortened", reason: models.SuppressionManual, expiresAt: in(200 * day), wantReason: models.SuppressionManual, wantExpiry: 200 * day},
+		{name: "unsubscribe", reason: models.SuppressionUnsubscribe, wantReason: models.SuppressionUnsubscribe},
+		{name: "bounce is extended", reason: models.SuppressionBounce, expiresAt: in(time.Hour), wantReason: models.SuppressionBounce, wantExpiry: 90 * day},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := NewService(config.SuppressionConfig{ExpiryDays: map[string]int{"bounce": 90}}, NewMemoryStore())
+			existing, err := service.Suppress("ann@example.com", tt.reason, "support ticket", tt.expiresAt)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := service.Record(bounce); err != nil {
+				t.Fatal(err)
+			}
+			got, err := service.Get("ann@example.com")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Reason != tt.wantReason {
+				t.Errorf("Reason = %q, want %q", got.Reason, tt.wantReason)
+			}
+			switch {
+			case tt.wantExpiry == 0 && got.ExpiresAt != nil:
+				t.Errorf("ExpiresAt = %v, want never", got.ExpiresAt)
+			case tt.wantExpiry != 0 && (got.ExpiresAt == nil || got.ExpiresAt.Before(time.Now().Add(tt.wantExpiry-time.Minute))):
+				t.Errorf("ExpiresAt = %v, want in %v", got.ExpiresAt, tt.wantExpiry)
+			}
+			if !got.CreatedAt.Equal(existing.CreatedAt) {
+				t.Errorf("CreatedAt = %v, want the first suppression %v", got.CreatedAt, existing.CreatedAt)
+			}
+		})
+	}
+}
+
+func TestSuppressExpiredIsReplaced(t *testing.T) {
+	store := NewMemoryStore()
+	expired := time.Now().Add(-time.Minute)
+	if err := store.Put(&models.Suppression{Address: "ann@example.com", Reason: models.SuppressionManual, ExpiresAt: &expired}); err != nil {
+		t.Fatal(err)
+	}
+
+	service := NewService(config.SuppressionConfig{}, store)
+	got, err := service.Suppress("ann@example.com", models.SuppressionBounce, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Reason != models.SuppressionBounce || got.ExpiresAt != nil {
+		t.Fatalf("Suppress = %+v, want a permanent bounce", got)
+	}
+}
@@ -0,0 +1,17 @@
+package suppression
+
+import (
+	"errors"
+	"handyhub-email-svc/internal/models"
+)
+
+var ErrNotFound = errors.New("suppression not found")
+
+// Store persists suppressions keyed by normalized address. Expired entries
+// are never returned.
+type Store interface {
+	Put(suppression *models.Suppression) error
+	Get(address string) (*models.Suppression, error)
+	Delete(address string) error
+	List(offset, limit int) ([]*models.Suppression, error)
+}
@@ -0,0 +1,145 @@
+package templates
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"handyhub-email-svc/internal/models"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+const (
+	subjectFile  = "subject.tmpl"
+	htmlFile     = "html.tmpl"
+	textFile     = "text.tmpl"
+	settingsFile = "template.json"
+)
+
+var templateID = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// DirectoryStore reads templates from <dir>/<id>/, holding subject.tmpl and
+// at least one of html.tmpl and text.tmpl. Subdirectories named after a
+// locale, e.g. <id>/ru/, hold translated variants with the same files. An
+// optional template.json carries settings such as {"layout": "base"}.
+// Layouts and partials live in <dir>/_layouts/<name>/ and
+// <dir>/_partials/<name>/ with html.tmpl, text.tmpl and locale directories.
+type DirectoryStore struct {
+	dir string
+}
+
+func NewDirectoryStore(dir string) *DirectoryStore {
+	return &DirectoryStore{dir: dir}
+}
+
+func (d *DirectoryStore) Get(id string) (*models.EmailTemplate, error) {
+	if !templateID.MatchString(id) {
+		return nil, ErrNotFound
+	}
+	dir := filepath.Join(d.dir, id)
+	info, err := os.Stat(dir)
+	if errors.Is(err, fs.ErrNotExist) || (err == nil && !info.IsDir()) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	tmpl := &models.EmailTemplate{ID: id, UpdatedAt: info.ModTime()}
+	settings, err := os.ReadFile(filepath.Join(dir, settingsFile))
+	if err == nil {
+		if err := json.Unmarshal(settings, tmpl); err != nil {
+			return nil, fmt.Errorf("invalid %s of template %s: %w", settingsFile, id, err)
+		}
+		tmpl.ID = id
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read template %s: %w", id, err)
+	}
+
+	base, err := readVariant(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read template %s: %w", id, err)
+	}
+	tmpl.Subject, tmpl.HTML, tmpl.Text = base.Subject, base.HTML, base.Text
+
+	if tmpl.Locales, err = readLocales(dir); err != nil {
+		return nil, fmt.Errorf("failed to read template %s: %w", id, err)
+	}
+	return tmpl, nil
+}
+
+func (d *DirectoryStore) Layout(name string) (*models.TemplatePartial, error) {
+	return d.partial("_layouts", KindLayout, name)
+}
+
+func (d *DirectoryStore) Partial(name string) (*models.TemplatePartial, error) {
+	return d.partial("_partials", KindPartial, name)
+}
+
+func (d *DirectoryStore) partial(subdir, kind, name string) (*models.TemplatePartial, error) {
+	if !templateID.MatchString(name) {
+		return nil, ErrPartialNotFound
+	}
+	dir := filepath.Join(d.dir, subdir, name)
+	info, err := os.Stat(dir)
+	if errors.Is(err, fs.ErrNotExist) || (err == nil && !info.IsDir()) {
+		return nil, ErrPartialNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	base, err := readVariant(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s %s: %w", kind, name, err)
+	}
+	p := &models.TemplatePartial{Name: name, Kind: kind, HTML: base.HTML, Text: base.Text, UpdatedAt: info.ModTime()}
+	if p.Locales, err = readLocales(dir); err != nil {
+		return nil, fmt.Errorf("failed to read %s %s: %w", kind, name, err)
+	}
+	return p, nil
+}
+
+// readLocales reads the locale subdirectories of a template, layout or partial.
+func readLocales(dir string) (map[string]models.LocalizedTemplate, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var locales map[string]models.LocalizedTemplate
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		variant, err := readVariant(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("locale %s: %w", entry.Name(), err)
+		}
+		if locales == nil {
+			locales = make(map[string]models.LocalizedTemplate)
+		}
+		locales[CanonicalLocale(entry.Name())] = *variant
+	}
+	return locales, nil
+}
+
+func readVariant(dir string) (*models.LocalizedTemplate, error) {
+	variant := &models.LocalizedTemplate{}
+	for name, target := range map[string]*string{
+		subjectFile: &variant.Subject,
+		htmlFile:    &variant.HTML,
+		textFile:    &variant.Text,
+	} {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		*target = string(data)
+	}
+	return variant, nil
+}
@@ -0,0 +1,64 @@
+package templates
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestDirectoryStoreGet(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "templates")
+	writeFiles(t, dir, map[string]string{
+		"welcome/template.json":      `{"id": "other", "layout": "base", "version": 3}`,
+		"welcome/subject.tmpl":       "Welcome",
+		"welcome/text.tmpl":          "Hi {{.name}}",
+		"welcome/pt_br/subject.tmpl": "Bem-vindo",
+		"welcome/pt_br/text.tmpl":    "Olá {{.name}}",
+		"_layouts/base/html.tmpl":    `<main>{{block "content" .}}{{end}}</main>`,
+		"broken/template.json":       `{`,
+	})
+	writeFiles(t, root, map[string]string{"secret/subject.tmpl": "outside"})
+	store := NewDirectoryStore(dir)
+
+	tmpl, err := store.Get("welcome")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tmpl.ID != "welcome" || tmpl.Layout != "base" || tmpl.Version != 3 || tmpl.Subject != "Welcome" || tmpl.Text != "Hi {{.name}}" {
+		t.Errorf("Get = %+v, want the settings and files of welcome", tmpl)
+	}
+	if pt := tmpl.Locales["pt-BR"]; pt.Subject != "Bem-vindo" || pt.Text != "Olá {{.name}}" {
+		t.Errorf("pt-BR variant = %+v, want the pt_br files", pt)
+	}
+
+	for _, id := range []string{"missing", "../secret", "_layouts/base", ".hidden", ""} {
+		if _, err := store.Get(id); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Get(%q) = %v, want ErrNotFound", id, err)
+		}
+	}
+	if _, err := store.Get("broken"); err == nil || errors.Is(err, ErrNotFound) {
+		t.Errorf("Get of a broken template.json = %v, want a read error", err)
+	}
+
+	if layout, err := store.Layout("base"); err != nil || layout.Kind != KindLayout {
+		t.Errorf("Layout = %+v, %v, want the base layout", layout, err)
+	}
+	if _, err := store.Partial("base"); !errors.Is(err, ErrPartialNotFound) {
+		t.Errorf("Partial(base) = %v, want ErrPartialNotFound", err)
+	}
+}
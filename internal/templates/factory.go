@@ -0,0 +1,25 @@
+package templates
+
+import (
+	"fmt"
+	"handyhub-email-svc/internal/config"
+	"handyhub-email-svc/internal/database"
+
+	"github.com/sirupsen/logrus"
+)
+
+func NewStore(cfg config.TemplatesConfig, mongodb *database.MongoDB) (Store, error) {
+	switch cfg.Source {
+	case "directory":
+		logrus.WithField("dir", cfg.Dir).Info("Using Directory Template Store")
+		return NewDirectoryStore(cfg.Dir), nil
+	case "database":
+		if mongodb == nil {
+			return nil, fmt.Errorf("template source database requires MongoDB")
+		}
+		logrus.Info("Using Database Template Store")
+		return NewMongoStore(mongodb, cfg.Collection, cfg.PartialsCollection), nil
+	default:
+		return nil, fmt.Errorf("unknown template source: %s", cfg.Source)
+	}
+}
@@ -0,0 +1,57 @@
+package templates
+
+import (
+	"fmt"
+	htmltemplate "html/template"
+	"text/template"
+)
+
+type funcs struct {
+	text template.FuncMap
+	html htmltemplate.FuncMap
+}
+
+// newFuncs returns the functions available in templates. The links are
+// returned as template.URL in HTML, they are generated by the service and
+// must not be filtered.
+func newFuncs(links Links, f *formatter) *funcs {
+	common := map[string]any{
+		"date":     f.Date,
+		"time":     f.Time,
+		"datetime": f.DateTime,
+		"number":   f.Number,
+		"currency": f.Currency,
+		"dict":     dict,
+	}
+
+	text := template.FuncMap{
+		"unsubscribe_url": func() string { return links.Unsubscribe },
+		"preferences_url": func() string { return links.Preferences },
+	}
+	html := htmltemplate.FuncMap{
+		"unsubscribe_url": func() htmltemplate.URL { return htmltemplate.URL(links.Unsubscribe) },
+		"preferences_url": func() htmltemplate.URL { return htmltemplate.URL(links.Preferences) },
+	}
+	for name, fn := range common {
+		text[name] = fn
+		html[name] = fn
+	}
+	return &funcs{text: text, html: html}
+}
+
+// dict builds the data passed to a partial, e.g.
+// {{template "button" dict "url" .profile_url "label" "Open"}}.
+func dict(pairs ...any) (map[string]any, error) {
+	if len(pairs)%2 != 0 {
+		return nil, fmt.Errorf("dict expects key and value pairs, got %d arguments", len(pairs))
+	}
+	values := make(map[string]any, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		key, ok := pairs[i].(string)
+		if !ok {
+			return nil, fmt.Errorf("dict key %v is not a string", pairs[i])
+		}
+		values[key] = pairs[i+1]
+	}
+	return values, nil
+}
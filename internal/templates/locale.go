@@ -0,0 +1,264 @@
+package templates
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/text/currency"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+	"golang.org/x/text/number"
+)
+
+// CanonicalLocale normalizes a locale tag, "ru_ru" becomes "ru-RU".
+// Unparsable tags are returned trimmed and lowercased.
+func CanonicalLocale(locale string) string {
+	locale = strings.TrimSpace(locale)
+	if locale == "" {
+		return ""
+	}
+	tag, err := language.Parse(strings.ReplaceAll(locale, "_", "-"))
+	if err != nil {
+		return strings.ToLower(locale)
+	}
+	return tag.String()
+}
+
+// localeFallbacks lists the variants to try for a locale, most specific
+// first: "ru-RU" gives "ru-RU", "ru", the default locale and finally the
+// base template (empty locale).
+func localeFallbacks(locale, defaultLocale string) []string {
+	var fallbacks []string
+	add := func(l string) {
+		for _, existing := range fallbacks {
+			if existing == l {
+				return
+			}
+		}
+		fallbacks = append(fallbacks, l)
+	}
+
+	for _, l := range []string{CanonicalLocale(locale), CanonicalLocale(defaultLocale)} {
+		for l != "" {
+			add(l)
+			i := strings.LastIndex(l, "-")
+			if i < 0 {
+				break
+			}
+			l = l[:i]
+		}
+	}
+	add("")
+	return fallbacks
+}
+
+// localeFormat holds the month names, date patterns and currency symbol
+// placement of a language. Date patterns use {d}, {dd}, {m}, {mm}, {month}
+// and {y} placeholders, dateTime combines {date} and {time}.
+type localeFormat struct {
+	months    [12]string
+	long      string
+	short     string
+	dateTime  string
+	hour12    bool
+	symbolEnd bool
+}
+
+var localeFormats = map[string]localeFormat{
+	"en": {
+		months:   [12]string{"January", "February", "March", "April", "May", "June", "July", "August", "September", "October", "November", "December"},
+		long:     "{month} {d}, {y}",
+		short:    "{m}/{d}/{y}",
+		dateTime: "{date} at {time}",
+		hour12:   true,
+	},
+	"ru": {
+		months:    [12]string{"января", "февраля", "марта", "апреля", "мая", "июня", "июля", "августа", "сентября", "октября", "ноября", "декабря"},
+		long:      "{d} {month} {y} г.",
+		short:     "{dd}.{mm}.{y}",
+		dateTime:  "{date}, {time}",
+		symbolEnd: true,
+	},
+	"uk": {
+		months:    [12]string{"січня", "лютого", "березня", "квітня", "травня", "червня", "липня", "серпня", "вересня", "жовтня", "листопада", "грудня"},
+		long:      "{d} {month} {y} р.",
+		short:     "{dd}.{mm}.{y}",
+		dateTime:  "{date}, {time}",
+		symbolEnd: true,
+	},
+	"de": {
+		months:    [12]string{"Januar", "Februar", "März", "April", "Mai", "Juni", "Juli", "August", "September", "Oktober", "November", "Dezember"},
+		long:      "{d}. {month} {y}",
+		short:     "{dd}.{mm}.{y}",
+		dateTime:  "{date}, {time}",
+		symbolEnd: true,
+	},
+	"fr": {
+		months:    [12]string{"janvier", "février", "mars", "avril", "mai", "juin", "juillet", "août", "septembre", "octobre", "novembre", "décembre"},
+		long:      "{d} {month} {y}",
+		short:     "{dd}/{mm}/{y}",
+		dateTime:  "{date} à {time}",
+		symbolEnd: true,
+	},
+	"es": {
+		months:    [12]string{"enero", "febrero", "marzo", "abril", "mayo", "junio", "julio", "agosto", "septiembre", "octubre", "noviembre", "diciembre"},
+		long:      "{d} de {month} de {y}",
+		short:     "{dd}/{mm}/{y}",
+		dateTime:  "{date}, {time}",
+		symbolEnd: true,
+	},
+}
+
+// formatter formats dates, numbers and amounts for one locale.
+type formatter struct {
+	printer *message.Printer
+	format  localeFormat
+}
+
+func newFormatter(locale string) *formatter {
+	tag, err := language.Parse(locale)
+	if err != nil || locale == "" {
+		tag = language.English
+	}
+	base, _ := tag.Base()
+	format, ok := localeFormats[base.String()]
+	if !ok {
+		format = localeFormats["en"]
+	}
+	return &formatter{printer: message.NewPrinter(tag), format: format}
+}
+
+// Date formats a date in the long form, "2 января 2025 г.", or the short
+// one, "02.01.2025", with {{date .value "short"}}.
+func (f *formatter) Date(value any, style ...string) (string, error) {
+	t, err := toTime(value)
+	if err != nil {
+		return "", err
+	}
+	pattern := f.format.long
+	if len(style) > 0 && style[0] == "short" {
+		pattern = f.format.short
+	}
+	return f.formatDate(pattern, t), nil
+}
+
+func (f *formatter) Time(value any) (string, error) {
+	t, err := toTime(value)
+	if err != nil {
+		return "", err
+	}
+	return f.formatTime(t), nil
+}
+
+func (f *formatter) DateTime(value any) (string, error) {
+	t, err := toTime(value)
+	if err != nil {
+		return "", err
+	}
+	return strings.NewReplacer(
+		"{date}", f.formatDate(f.format.long, t),
+		"{time}", f.formatTime(t),
+	).Replace(f.format.dateTime), nil
+}
+
+func (f *formatter) formatDate(pattern string, t time.Time) string {
+	return strings.NewReplacer(
+		"{dd}", fmt.Sprintf("%02d", t.Day()),
+		"{mm}", fmt.Sprintf("%02d", int(t.Month())),
+		"{d}", strconv.Itoa(t.Day()),
+		"{m}", strconv.Itoa(int(t.Month())),
+		"{month}", f.format.months[t.Month()-1],
+		"{y}", strconv.Itoa(t.Year()),
+	).Replace(pattern)
+}
+
+func (f *formatter) formatTime(t time.Time) string {
+	if f.format.hour12 {
+		return t.Format("3:04 PM")
+	}
+	return t.Format("15:04")
+}
+
+// Number groups digits the locale way, {{number .value 2}} fixes the
+// fraction digits.
+func (f *formatter) Number(value any, decimals ...int) (string, error) {
+	n, err := toFloat(value)
+	if err != nil {
+		return "", err
+	}
+	if len(decimals) > 0 {
+		return f.printer.Sprint(number.Decimal(n, number.Scale(decimals[0]))), nil
+	}
+	return f.printer.Sprint(number.Decimal(n, number.MaxFractionDigits(3))), nil
+}
+
+// Currency formats an amount with the symbol of the ISO 4217 code and its
+// standard fraction digits, "1 234,50 ₽" or "$1,234.50".
+func (f *formatter) Currency(value any, code string) (string, error) {
+	n, err := toFloat(value)
+	if err != nil {
+		return "", err
+	}
+	unit, err := currency.ParseISO(code)
+	if err != nil {
+		return "", fmt.Errorf("unknown currency %q", code)
+	}
+
+	scale, _ := currency.Standard.Rounding(unit)
+	amount := f.printer.Sprint(number.Decimal(math.Abs(n), number.Scale(scale)))
+	symbol := f.printer.Sprint(currency.NarrowSymbol(unit))
+	sign := ""
+	if n < 0 {
+		sign = "-"
+	}
+	if f.format.symbolEnd {
+		return sign + amount + " " + symbol, nil
+	}
+	return sign + symbol + amount, nil
+}
+
+// toTime accepts time.Time and the RFC 3339 or YYYY-MM-DD strings template
+// data carries after JSON decoding.
+func toTime(value any) (time.Time, error) {
+	switch v := value.(type) {
+	case time.Time:
+		return v, nil
+	case *time.Time:
+		if v != nil {
+			return *v, nil
+		}
+	case string:
+		for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02"} {
+			if t, err := time.Parse(layout, v); err == nil {
+				return t, nil
+			}
+		}
+	}
+	return time.Time{}, fmt.Errorf("cannot format %v (%T) as date", value, value)
+}
+
+func toFloat(value any) (float64, error) {
+	switch v := value.(type) {
+	case float64:
+		return v, nil
+	case float32:
+		return float64(v), nil
+	case int:
+		return float64(v), nil
+	case int32:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	case json.Number:
+		return v.Float64()
+	case string:
+		if f, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+			return f, nil
+		}
+	}
+	return 0, fmt.Errorf("cannot format %v (%T) as number", value, value)
+}
@@ -0,0 +1,162 @@
+package templates
+
+import (
+	"handyhub-email-svc/internal/models"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestCanonicalLocale(t *testing.T) {
+	tests := map[string]string{
+		"ru_ru":         "ru-RU",
+		" pt-br ":       "pt-BR",
+		"EN":            "en",
+		"":              "",
+		"   ":           "",
+		"not a locale!": "not a locale!",
+	}
+	for locale, want := range tests {
+		if got := CanonicalLocale(locale); got != want {
+			t.Errorf("CanonicalLocale(%q) = %q, want %q", locale, got, want)
+		}
+	}
+}
+
+func TestLocaleFallbacks(t *testing.T) {
+	tests := []struct {
+		locale        string
+		defaultLocale string
+		want          []string
+	}{
+		{"pt-BR", "en", []string{"pt-BR", "pt", "en", ""}},
+		{"pt_br", "en-US", []string{"pt-BR", "pt", "en-US", "en", ""}},
+		{"ru", "ru-RU", []string{"ru", "ru-RU", ""}},
+		{"en", "en", []string{"en", ""}},
+		{"", "en", []string{"en", ""}},
+		{"", "", []string{""}},
+		{"not a locale!", "en", []string{"not a locale!", "en", ""}},
+	}
+	for _, tt := range tests {
+		if got := localeFallbacks(tt.locale, tt.defaultLocale); !slices.Equal(got, tt.want) {
+			t.Errorf("localeFallbacks(%q, %q) = %q, want %q", tt.locale, tt.defaultLocale, got, tt.want)
+		}
+	}
+}
+
+func TestFormatterDates(t *testing.T) {
+	date := time.Date(2025, time.January, 2, 15, 4, 0, 0, time.UTC)
+	tests := []struct {
+		locale   string
+		long     string
+		short    string
+		dateTime string
+	}{
+		{"en", "January 2, 2025", "1/2/2025", "January 2, 2025 at 3:04 PM"},
+		{"ru-RU", "2 января 2025 г.", "02.01.2025", "2 января 2025 г., 15:04"},
+		{"de", "2. Januar 2025", "02.01.2025", "2. Januar 2025, 15:04"},
+		// languages without a format and unknown or empty locales use English
+		{"pt-BR", "January 2, 2025", "1/2/2025", "January 2, 2025 at 3:04 PM"},
+		{"not a locale!", "January 2, 2025", "1/2/2025", "January 2, 2025 at 3:04 PM"},
+		{"", "January 2, 2025", "1/2/2025", "January 2, 2025 at 3:04 PM"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.locale, func(t *testing.T) {
+			f := newFormatter(tt.locale)
+			if got, err := f.Date(date); err != nil || got != tt.long {
+				t.Errorf("Date = %q, %v, want %q", got, err, tt.long)
+			}
+			if got, err := f.Date("2025-01-02", "short"); err != nil || got != tt.short {
+				t.Errorf("short Date = %q, %v, want %q", got, err, tt.short)
+			}
+			if got, err := f.DateTime("2025-01-02T15:04:00Z"); err != nil || got != tt.dateTime {
+				t.Errorf("DateTime = %q, %v, want %q", got, err, tt.dateTime)
+			}
+		})
+	}
+
+	if _, err := newFormatter("en").Date("tomorrow"); err == nil {
+		t.Error("Date accepted an unparsable value")
+	}
+}
+
+func TestFormatterNumbers(t *testing.T) {
+	tests := []struct {
+		locale   string
+		number   string
+		fixed    string
+		currency string
+	}{
+		{"en", "1,234.568", "1,234.57", "$1,234.57"},
+		{"ru", "1\u00a0234,568", "1\u00a0234,57", "1\u00a0234,57\u00a0$"},
+		{"de-DE", "1.234,568", "1.234,57", "1.234,57\u00a0$"},
+		{"not a locale!", "1,234.568", "1,234.57", "$1,234.57"},
+		{"", "1,234.568", "1,234.57", "$1,234.57"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.locale, func(t *testing.T) {
+			f := newFormatter(tt.locale)
+			if got, err := f.Number(1234.5678); err != nil || got != tt.number {
+				t.Errorf("Number = %q, %v, want %q", got, err, tt.number)
+			}
+			if got, err := f.Number("1234.5678", 2); err != nil || got != tt.fixed {
+				t.Errorf("Number with 2 decimals = %q, %v, want %q", got, err, tt.fixed)
+			}
+			if got, err := f.Currency(1234.567, "USD"); err != nil || got != tt.currency {
+				t.Errorf("Currency = %q, %v, want %q", got, err, tt.currency)
+			}
+		})
+	}
+
+	f := newFormatter("en")
+	if got, err := f.Currency(-5, "JPY"); err != nil || got != "-¥5" {
+		t.Errorf("Currency(-5, JPY) = %q, %v, want -¥5", got, err)
+	}
+	if _, err := f.Currency(5, "XYZ1"); err == nil {
+		t.Error("Currency accepted an unknown code")
+	}
+	if _, err := f.Number("many"); err == nil {
+		t.Error("Number accepted an unparsable value")
+	}
+}
+
+func TestRenderLocaleFallback(t *testing.T) {
+	source := &models.EmailTemplate{
+		ID:   "receipt",
+		Text: "Paid {{number .amount 2}}",
+		Locales: map[string]models.LocalizedTemplate{
+			"pt": {Text: "Pago {{number .amount 2}}"},
+			"de": {Text: "Bezahlt {{number .amount 2}}"},
+		},
+	}
+	data := map[string]any{"amount": 1234.5}
+
+	tests := []struct {
+		locale        string
+		defaultLocale string
+		variant       string
+		text          string
+	}{
+		{"pt-BR", "de", "pt", "Pago 1.234,50"},
+		{"pt", "de", "pt", "Pago 1.234,50"},
+		// the default variant, formatted for the requested locale
+		{"en-US", "de", "de", "Bezahlt 1,234.50"},
+		{"", "de", "de", "Bezahlt 1.234,50"},
+		{"not a locale!", "de", "de", "Bezahlt 1,234.50"},
+		// the base template when neither has a variant
+		{"fr", "", "", "Paid 1\u00a0234,50"},
+		{"", "", "", "Paid 1,234.50"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.locale+"/"+tt.defaultLocale, func(t *testing.T) {
+			renderer := NewRenderer(&stubStore{}, time.Minute, tt.defaultLocale)
+			rendered, err := renderer.RenderTemplate(source, tt.locale, data, Links{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rendered.Locale != tt.variant || rendered.Text != tt.text {
+				t.Errorf("rendered %q variant %q, want %q variant %q", rendered.Text, rendered.Locale, tt.text, tt.variant)
+			}
+		})
+	}
+}
@@ -0,0 +1,270 @@
+package templates
+
+import (
+	"context"
+	"errors"
+	"handyhub-email-svc/internal/database"
+	"handyhub-email-svc/internal/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoStore keeps one document per template holding all of its versions.
+// Layouts and partials are kept unversioned in a separate collection.
+type MongoStore struct {
+	collection *mongo.Collection
+	partials   *mongo.Collection
+}
+
+func NewMongoStore(mongodb *database.MongoDB, collectionName, partialsCollectionName string) *MongoStore {
+	return &MongoStore{
+		collection: mongodb.Database.Collection(collectionName),
+		partials:   mongodb.Database.Collection(partialsCollectionName),
+	}
+}
+
+func (m *MongoStore) Get(id string) (*models.EmailTemplate, error) {
+	record, err := m.Record(id)
+	if err != nil {
+		return nil, err
+	}
+	if record.PublishedVersion == 0 {
+		return nil, ErrNotFound
+	}
+	published := record.Version(record.PublishedVersion)
+	if published == nil {
+		return nil, ErrVersionNotFound
+	}
+	return published, nil
+}
+
+func (m *MongoStore) List() ([]*models.TemplateRecord, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().
+		SetProjection(bson.M{"versions": 0}).
+		SetSort(bson.D{{Key: "_id", Value: 1}})
+	cursor, err := m.collection.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	records := []*models.TemplateRecord{}
+	if err := cursor.All(ctx, &records); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+func (m *MongoStore) Record(id string) (*models.TemplateRecord, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var record models.TemplateRecord
+	err := m.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&record)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+func (m *MongoStore) Create(tmpl *models.EmailTemplate) (*models.EmailTemplate, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	version := *tmpl
+	version.Version = 1
+	version.UpdatedAt = now
+	record := &models.TemplateRecord{
+		ID:             tmpl.ID,
+		LatestVersion:  1,
+		PublishHistory: []int{},
+		Versions:       []models.EmailTemplate{version},
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+
+	if _, err := m.collection.InsertOne(ctx, record); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, ErrExists
+		}
+		return nil, err
+	}
+	return &version, nil
+}
+
+// AddVersion reserves the version number with $inc first, so concurrent
+// updates never share a number.
+func (m *MongoStore) AddVersion(tmpl *models.EmailTemplate) (*models.EmailTemplate, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var reserved models.TemplateRecord
+	err := m.collection.FindOneAndUpdate(ctx,
+		bson.M{"_id": tmpl.ID},
+		bson.M{"$inc": bson.M{"latest_version": 1}},
+		options.FindOneAndUpdate().
+			SetReturnDocument(options.After).
+			SetProjection(bson.M{"latest_version": 1}),
+	).Decode(&reserved)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	version := *tmpl
+	version.Version = reserved.LatestVersion
+	version.UpdatedAt = time.Now()
+	_, err = m.collection.UpdateOne(ctx,
+		bson.M{"_id": tmpl.ID},
+		bson.M{
+			"$push": bson.M{"versions": version},
+			"$set":  bson.M{"updated_at": version.UpdatedAt},
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &version, nil
+}
+
+func (m *MongoStore) Publish(id string, version int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := m.collection.UpdateOne(ctx,
+		bson.M{"_id": id, "versions.version": version, "published_version": bson.M{"$ne": version}},
+		bson.M{
+			"$set":  bson.M{"published_version": version, "updated_at": time.Now()},
+			"$push": bson.M{"publish_history": version},
+		},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		record, err := m.Record(id)
+		if err != nil {
+			return err
+		}
+		if record.PublishedVersion == version {
+			return nil
+		}
+		return ErrVersionNotFound
+	}
+	return nil
+}
+
+// Rollback drops the current publish from the history, the update only
+// applies if nobody published in between.
+func (m *MongoStore) Rollback(id string) (int, error) {
+	record, err := m.Record(id)
+	if err != nil {
+		return 0, err
+	}
+	history := record.PublishHistory
+	if len(history) < 2 {
+		return 0, ErrNoRollback
+	}
+	previous := history[len(history)-2]
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := m.collection.UpdateOne(ctx,
+		bson.M{"_id": id, "publish_history": history},
+		bson.M{
+			"$set": bson.M{"published_version": previous, "updated_at": time.Now()},
+			"$pop": bson.M{"publish_history": 1},
+		},
+	)
+	if err != nil {
+		return 0, err
+	}
+	if result.MatchedCount == 0 {
+		return 0, ErrConflict
+	}
+	return previous, nil
+}
+
+func (m *MongoStore) Layout(name string) (*models.TemplatePartial, error) {
+	return m.findPartial(KindLayout, name)
+}
+
+func (m *MongoStore) Partial(name string) (*models.TemplatePartial, error) {
+	return m.findPartial(KindPartial, name)
+}
+
+func (m *MongoStore) findPartial(kind, name string) (*models.TemplatePartial, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var partial models.TemplatePartial
+	err := m.partials.FindOne(ctx, bson.M{"_id": partialKey(kind, name)}).Decode(&partial)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrPartialNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &partial, nil
+}
+
+func (m *MongoStore) ListPartials(kind string) ([]*models.TemplatePartial, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cursor, err := m.partials.Find(ctx, bson.M{"kind": kind}, options.Find().SetSort(bson.D{{Key: "name", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	partials := []*models.TemplatePartial{}
+	if err := cursor.All(ctx, &partials); err != nil {
+		return nil, err
+	}
+	return partials, nil
+}
+
+func (m *MongoStore) SavePartial(partial *models.TemplatePartial) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	partial.UpdatedAt = time.Now()
+	_, err := m.partials.ReplaceOne(ctx,
+		bson.M{"_id": partialKey(partial.Kind, partial.Name)},
+		partial,
+		options.Replace().SetUpsert(true),
+	)
+	return err
+}
+
+func (m *MongoStore) DeletePartial(kind, name string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := m.partials.DeleteOne(ctx, bson.M{"_id": partialKey(kind, name)})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrPartialNotFound
+	}
+	return nil
+}
+
+func partialKey(kind, name string) string {
+	return kind + "/" + name
+}
@@ -0,0 +1,220 @@
+package templates
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"handyhub-email-svc/internal/config"
+	"handyhub-email-svc/internal/database"
+	"handyhub-email-svc/internal/models"
+	"os"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newTestMongoStore connects to MONGODB_TEST_URL and uses a database of its
+// own, dropped after the test. Without the variable the test is skipped.
+func newTestMongoStore(t *testing.T) *MongoStore {
+	t.Helper()
+	url := os.Getenv("MONGODB_TEST_URL")
+	if url == "" {
+		t.Skip("MONGODB_TEST_URL is not set")
+	}
+	mongodb, err := database.NewMongoDB(config.Configuration{Database: config.Database{
+		Url:     url,
+		DbName:  fmt.Sprintf("email_templates_test_%d", time.Now().UnixNano()),
+		Timeout: 5,
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		mongodb.Database.Drop(ctx)
+		mongodb.Disconnect(ctx)
+	})
+	return NewMongoStore(mongodb, "templates", "template_partials")
+}
+
+// createVersions stores a template with versions 1 to n.
+func createVersions(t *testing.T, store *MongoStore, id string, n int) {
+	t.Helper()
+	if _, err := store.Create(&models.EmailTemplate{ID: id, Subject: "v1", Text: "v1"}); err != nil {
+		t.Fatal(err)
+	}
+	for v := 2; v <= n; v++ {
+		version, err := store.AddVersion(&models.EmailTemplate{ID: id, Subject: fmt.Sprintf("v%d", v), Text: "text"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if version.Version != v {
+			t.Fatalf("AddVersion stored version %d, want %d", version.Version, v)
+		}
+	}
+}
+
+func TestMongoStoreCreate(t *testing.T) {
+	store := newTestMongoStore(t)
+	createVersions(t, store, "welcome", 1)
+
+	if _, err := store.Create(&models.EmailTemplate{ID: "welcome"}); !errors.Is(err, ErrExists) {
+		t.Errorf("second Create = %v, want ErrExists", err)
+	}
+	if _, err := store.Get("welcome"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get of an unpublished template = %v, want ErrNotFound", err)
+	}
+	if _, err := store.AddVersion(&models.EmailTemplate{ID: "missing"}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("AddVersion of a missing template = %v, want ErrNotFound", err)
+	}
+}
+
+func TestMongoStorePublish(t *testing.T) {
+	store := newTestMongoStore(t)
+	createVersions(t, store, "welcome", 3)
+
+	// an older draft can be published over a newer one
+	if err := store.Publish("welcome", 2); err != nil {
+		t.Fatal(err)
+	}
+	published, err := store.Get("welcome")
+	if err != nil || published.Version != 2 || published.Subject != "v2" {
+		t.Fatalf("Get = %+v, %v, want version 2", published, err)
+	}
+
+	// publishing the published version again is a no-op
+	if err := store.Publish("welcome", 2); err != nil {
+		t.Errorf("republish = %v, want nil", err)
+	}
+	if err := store.Publish("welcome", 9); !errors.Is(err, ErrVersionNotFound) {
+		t.Errorf("Publish of a missing version = %v, want ErrVersionNotFound", err)
+	}
+	if err := store.Publish("missing", 1); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Publish of a missing template = %v, want ErrNotFound", err)
+	}
+
+	record, err := store.Record("welcome")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.PublishedVersion != 2 || len(record.PublishHistory) != 1 || record.LatestVersion != 3 {
+		t.Errorf("record published %d, history %v, latest %d, want 2, [2], 3", record.PublishedVersion, record.PublishHistory, record.LatestVersion)
+	}
+}
+
+func TestMongoStoreRollback(t *testing.T) {
+	store := newTestMongoStore(t)
+	createVersions(t, store, "welcome", 3)
+
+	if _, err := store.Rollback("welcome"); !errors.Is(err, ErrNoRollback) {
+		t.Errorf("Rollback without publishes = %v, want ErrNoRollback", err)
+	}
+	for _, v := range []int{1, 3} {
+		if err := store.Publish("welcome", v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	version, err := store.Rollback("welcome")
+	if err != nil || version != 1 {
+		t.Fatalf("Rollback = %d, %v, want version 1", version, err)
+	}
+	if published, err := store.Get("welcome"); err != nil || published.Version != 1 {
+		t.Errorf("Get after rollback = %+v, %v, want version 1", published, err)
+	}
+	if _, err := store.Rollback("welcome"); !errors.Is(err, ErrNoRollback) {
+		t.Errorf("Rollback past the first publish = %v, want ErrNoRollback", err)
+	}
+	if _, err := store.Rollback("missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Rollback of a missing template = %v, want ErrNotFound", err)
+	}
+}
+
+func TestMongoStoreConcurrentAddVersion(t *testing.T) {
+	store := newTestMongoStore(t)
+	createVersions(t, store, "welcome", 1)
+
+	const writers = 10
+	versions := make([]int, writers)
+	errs := make([]error, writers)
+	var wg sync.WaitGroup
+	for i := range writers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			version, err := store.AddVersion(&models.EmailTemplate{ID: "welcome", Subject: fmt.Sprintf("writer %d", i)})
+			errs[i] = err
+			if err == nil {
+				versions[i] = version.Version
+			}
+		}()
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("writer %d: %v", i, err)
+		}
+	}
+	sort.Ints(versions)
+	for i, v := range versions {
+		if v != i+2 {
+			t.Fatalf("concurrent versions %v, want 2 to %d without duplicates", versions, writers+1)
+		}
+	}
+	record, err := store.Record("welcome")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.LatestVersion != writers+1 || len(record.Versions) != writers+1 {
+		t.Errorf("record has latest %d and %d versions, want %d", record.LatestVersion, len(record.Versions), writers+1)
+	}
+}
+
+// Concurrent rollbacks read the same history, only one of them may pop it
+// per read, the others get ErrConflict.
+func TestMongoStoreConcurrentRollback(t *testing.T) {
+	store := newTestMongoStore(t)
+	createVersions(t, store, "welcome", 4)
+	for v := 1; v <= 4; v++ {
+		if err := store.Publish("welcome", v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	const callers = 8
+	errs := make([]error, callers)
+	var wg sync.WaitGroup
+	for i := range callers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, errs[i] = store.Rollback("welcome")
+		}()
+	}
+	wg.Wait()
+
+	succeeded := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			succeeded++
+		case errors.Is(err, ErrConflict), errors.Is(err, ErrNoRollback):
+		default:
+			t.Fatalf("Rollback = %v, want nil, ErrConflict or ErrNoRollback", err)
+		}
+	}
+
+	record, err := store.Record("welcome")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if succeeded == 0 || len(record.PublishHistory) != 4-succeeded {
+		t.Fatalf("%d rollbacks succeeded leaving history %v, want one entry popped per success", succeeded, record.PublishHistory)
+	}
+	if want := record.PublishHistory[len(record.PublishHistory)-1]; record.PublishedVersion != want {
+		t.Errorf("published version %d, want the last history entry %d", record.PublishedVersion, want)
+	}
+}
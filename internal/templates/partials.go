@@ -0,0 +1,338 @@
+package templates
+
+import (
+	"errors"
+	"fmt"
+	"handyhub-email-svc/internal/models"
+	htmltemplate "html/template"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+const (
+	KindLayout  = "layout"
+	KindPartial = "partial"
+
+	// contentBlock is the block of a layout the template body fills
+	contentBlock = "content"
+)
+
+var ErrPartialNotFound = errors.New("partial not found")
+
+// storeError is a failure to load a layout or partial. It is passed up
+// unwrapped instead of as a *RenderError, the store may be back on retry.
+type storeError struct {
+	err error
+}
+
+func (e *storeError) Error() string {
+	return e.err.Error()
+}
+
+func (e *storeError) Unwrap() error {
+	return e.err
+}
+
+// reservedNames cannot be used for partials, they name the parts of a template.
+var reservedNames = map[string]bool{"subject": true, "html": true, "text": true, contentBlock: true}
+
+// templateSet abstracts the text/template and html/template sets a body,
+// its layout and its partials are parsed into.
+type templateSet interface {
+	lookup(name string) *parse.Tree
+	add(name, source string) error
+	trees() map[string]*parse.Tree
+}
+
+type textSet struct{ t *template.Template }
+
+func (s textSet) lookup(name string) *parse.Tree {
+	if t := s.t.Lookup(name); t != nil {
+		return t.Tree
+	}
+	return nil
+}
+
+func (s textSet) add(name, source string) error {
+	t := s.t
+	if name != t.Name() {
+		t = t.New(name)
+	}
+	_, err := t.Parse(source)
+	return err
+}
+
+func (s textSet) trees() map[string]*parse.Tree {
+	trees := make(map[string]*parse.Tree)
+	for _, t := range s.t.Templates() {
+		if t.Tree != nil {
+			trees[t.Name()] = t.Tree
+		}
+	}
+	return trees
+}
+
+type htmlSet struct{ t *htmltemplate.Template }
+
+func (s htmlSet) lookup(name string) *parse.Tree {
+	if t := s.t.Lookup(name); t != nil {
+		return t.Tree
+	}
+	return nil
+}
+
+func (s htmlSet) add(name, source string) error {
+	t := s.t
+	if name != t.Name() {
+		t = t.New(name)
+	}
+	_, err := t.Parse(source)
+	return err
+}
+
+func (s htmlSet) trees() map[string]*parse.Tree {
+	trees := make(map[string]*parse.Tree)
+	for _, t := range s.t.Templates() {
+		if t.Tree != nil {
+			trees[t.Name()] = t.Tree
+		}
+	}
+	return trees
+}
+
+// partialResolver loads the partials a template set references, choosing
+// their variant with the locale fallbacks of the template variant.
+type partialResolver struct {
+	store     Store
+	fallbacks []string
+	loaded    map[string]*models.TemplatePartial
+}
+
+func newPartialResolver(store Store, fallbacks []string) *partialResolver {
+	return &partialResolver{store: store, fallbacks: fallbacks, loaded: make(map[string]*models.TemplatePartial)}
+}
+
+// layout returns the source of a layout for the html or text part, empty if
+// the layout has no such part.
+func (r *partialResolver) layout(name, part string) (string, error) {
+	layout, err := r.store.Layout(name)
+	if errors.Is(err, ErrPartialNotFound) {
+		return "", fmt.Errorf("layout %q not found", name)
+	}
+	if err != nil {
+		return "", &storeError{fmt.Errorf("failed to load layout %q: %w", name, err)}
+	}
+	return variantSource(layout, part, r.fallbacks), nil
+}
+
+func (r *partialResolver) partial(name, part string) (string, error) {
+	if reservedNames[name] {
+		return "", fmt.Errorf("%q is not defined", name)
+	}
+	p, ok := r.loaded[name]
+	if !ok {
+		var err error
+		p, err = r.store.Partial(name)
+		if errors.Is(err, ErrPartialNotFound) {
+			return "", fmt.Errorf("partial %q not found", name)
+		}
+		if err != nil {
+			return "", &storeError{fmt.Errorf("failed to load partial %q: %w", name, err)}
+		}
+		r.loaded[name] = p
+	}
+
+	source := variantSource(p, part, r.fallbacks)
+	if source == "" {
+		return "", fmt.Errorf("partial %q has no %s variant", name, part)
+	}
+	return source, nil
+}
+
+// resolve adds every referenced partial to the set until nothing is missing
+// and rejects partials that include each other.
+func (r *partialResolver) resolve(set templateSet, part string) error {
+	for {
+		missing := missingTemplates(set)
+		if len(missing) == 0 {
+			break
+		}
+		for _, name := range missing {
+			source, err := r.partial(name, part)
+			if err != nil {
+				return err
+			}
+			if err := set.add(name, source); err != nil {
+				return fmt.Errorf("partial %q: %w", name, err)
+			}
+		}
+	}
+	return checkCycles(set.trees())
+}
+
+func missingTemplates(set templateSet) []string {
+	var missing []string
+	seen := make(map[string]bool)
+	for _, tree := range set.trees() {
+		for _, name := range references(tree.Root) {
+			if !seen[name] && set.lookup(name) == nil {
+				seen[name] = true
+				missing = append(missing, name)
+			}
+		}
+	}
+	return missing
+}
+
+// references lists the templates a node includes with {{template}} or
+// {{block}}.
+func references(node parse.Node) []string {
+	var names []string
+	var walk func(parse.Node)
+	walk = func(node parse.Node) {
+		switch n := node.(type) {
+		case *parse.ListNode:
+			if n == nil {
+				return
+			}
+			for _, child := range n.Nodes {
+				walk(child)
+			}
+		case *parse.IfNode:
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.RangeNode:
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.WithNode:
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.TemplateNode:
+			names = append(names, n.Name)
+		}
+	}
+	walk(node)
+	return names
+}
+
+// checkCycles fails on templates that include themselves, directly or
+// through other partials, which would recurse until the stack runs out.
+func checkCycles(trees map[string]*parse.Tree) error {
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := make(map[string]int, len(trees))
+	var path []string
+
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case visiting:
+			start := 0
+			for i, n := range path {
+				if n == name {
+					start = i
+				}
+			}
+			return fmt.Errorf("partial cycle: %s -> %s", strings.Join(path[start:], " -> "), name)
+		case done:
+			return nil
+		}
+
+		state[name] = visiting
+		path = append(path, name)
+		if tree, ok := trees[name]; ok {
+			for _, ref := range references(tree.Root) {
+				if err := visit(ref); err != nil {
+					return err
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		state[name] = done
+		return nil
+	}
+
+	for name := range trees {
+		if err := visit(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// variantSource picks the html or text source of a layout or partial for
+// the first matching locale, the empty locale being the base variant.
+func variantSource(p *models.TemplatePartial, part string, fallbacks []string) string {
+	pick := func(html, text string) string {
+		if part == "html" {
+			return html
+		}
+		return text
+	}
+	for _, locale := range fallbacks {
+		if locale == "" {
+			if source := pick(p.HTML, p.Text); source != "" {
+				return source
+			}
+			continue
+		}
+		if variant, ok := p.Locales[locale]; ok {
+			if source := pick(variant.HTML, variant.Text); source != "" {
+				return source
+			}
+		}
+	}
+	return ""
+}
+
+// ValidatePartial checks the name and syntax of a layout or partial before it
+// is saved. References to other partials are resolved when templates render.
+func ValidatePartial(p *models.TemplatePartial) error {
+	if !templateID.MatchString(p.Name) || reservedNames[p.Name] {
+		return fmt.Errorf("invalid %s name %q", p.Kind, p.Name)
+	}
+	variants := map[string]models.LocalizedTemplate{"": {HTML: p.HTML, Text: p.Text}}
+	for locale, variant := range p.Locales {
+		variants[locale] = variant
+	}
+
+	funcs := newFuncs(Links{}, newFormatter(""))
+	for locale, variant := range variants {
+		if locale != "" && variant.HTML == "" && variant.Text == "" {
+			return fmt.Errorf("%s variant %q has neither HTML nor text", p.Kind, locale)
+		}
+		if variant.HTML != "" {
+			t, err := htmltemplate.New(p.Name).Funcs(funcs.html).Parse(variant.HTML)
+			if err != nil {
+				return err
+			}
+			if err := checkLayout(p, t.Tree); err != nil {
+				return err
+			}
+		}
+		if variant.Text != "" {
+			t, err := template.New(p.Name).Funcs(funcs.text).Parse(variant.Text)
+			if err != nil {
+				return err
+			}
+			if err := checkLayout(p, t.Tree); err != nil {
+				return err
+			}
+		}
+	}
+	if p.HTML == "" && p.Text == "" && len(p.Locales) == 0 {
+		return fmt.Errorf("%s has neither HTML nor text", p.Kind)
+	}
+	return nil
+}
+
+func checkLayout(p *models.TemplatePartial, tree *parse.Tree) error {
+	if p.Kind == KindLayout && !containsName(references(tree.Root), contentBlock) {
+		return fmt.Errorf("layout %q has no %q block", p.Name, contentBlock)
+	}
+	return nil
+}
@@ -0,0 +1,348 @@
+package templates
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"handyhub-email-svc/internal/models"
+	htmltemplate "html/template"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+var log = logrus.StandardLogger()
+
+// RenderError is a template that cannot be parsed or executed with the given
+// data. Retrying will not help.
+type RenderError struct {
+	TemplateID string
+	Part       string
+	Err        error
+}
+
+func (e *RenderError) Error() string {
+	return fmt.Sprintf("failed to render %s of template %s: %v", e.Part, e.TemplateID, e.Err)
+}
+
+func (e *RenderError) Unwrap() error {
+	return e.Err
+}
+
+// Links are the recipient specific URLs templates reach through the
+// unsubscribe_url and preferences_url functions.
+type Links struct {
+	Unsubscribe string
+	Preferences string
+}
+
+// Rendered is the output of a template.
+type Rendered struct {
+	Subject string
+	HTML    string
+	Text    string
+	// Locale is the variant used, empty for the base template
+	Locale    string
+	Version   int
+	InlineCSS *bool
+}
+
+type variant struct {
+	subject *template.Template
+	html    *htmltemplate.Template
+	text    *template.Template
+}
+
+type parsed struct {
+	source   *models.EmailTemplate
+	variants map[string]*variant
+	loadedAt time.Time
+}
+
+// Renderer renders stored templates, keeping parsed ones for cacheTTL.
+type Renderer struct {
+	store         Store
+	cacheTTL      time.Duration
+	defaultLocale string
+
+	mu    sync.Mutex
+	cache map[string]*parsed
+}
+
+func NewRenderer(store Store, cacheTTL time.Duration, defaultLocale string) *Renderer {
+	return &Renderer{
+		store:         store,
+		cacheTTL:      cacheTTL,
+		defaultLocale: CanonicalLocale(defaultLocale),
+		cache:         make(map[string]*parsed),
+	}
+}
+
+// Render executes the template id in the variant closest to locale. Missing
+// templates and render failures are returned as ErrNotFound and
+// *RenderError, anything else is a storage failure.
+func (r *Renderer) Render(id, locale string, data map[string]any, links Links) (*Rendered, error) {
+	tmpl, err := r.load(id)
+	if err != nil {
+		return nil, err
+	}
+	return r.execute(tmpl, locale, data, links)
+}
+
+// RenderTemplate renders a template that is not necessarily published, used
+// for previews. It bypasses the cache.
+func (r *Renderer) RenderTemplate(source *models.EmailTemplate, locale string, data map[string]any, links Links) (*Rendered, error) {
+	tmpl, err := r.parse(source)
+	if err != nil {
+		return nil, err
+	}
+	return r.execute(tmpl, locale, data, links)
+}
+
+// RenderLayout wraps bodies rendered elsewhere, e.g. from Markdown, in a
+// layout. The HTML must already be safe, it is not escaped.
+func (r *Renderer) RenderLayout(layout, locale, html, text string, links Links) (*Rendered, error) {
+	// the bodies are a variant of the locale, so the layout variant is picked
+	// with the same fallbacks as for templates
+	locale = CanonicalLocale(locale)
+	key := "_layouts/" + layout + "/" + locale
+	r.mu.Lock()
+	tmpl, ok := r.cache[key]
+	r.mu.Unlock()
+	if !ok || time.Since(tmpl.loadedAt) >= r.cacheTTL {
+		source := &models.EmailTemplate{ID: key, Layout: layout}
+		body := models.LocalizedTemplate{HTML: "{{.html}}", Text: "{{.text}}"}
+		if locale == "" {
+			source.HTML, source.Text = body.HTML, body.Text
+		} else {
+			source.Locales = map[string]models.LocalizedTemplate{locale: body}
+		}
+		var err error
+		tmpl, err = r.parse(source)
+		if err != nil {
+			return nil, err
+		}
+		r.mu.Lock()
+		r.cache[key] = tmpl
+		r.mu.Unlock()
+	}
+	return r.execute(tmpl, locale, map[string]any{"html": htmltemplate.HTML(html), "text": text}, links)
+}
+
+// Validate reports parse errors of a template, including missing layouts
+// and partials, as *RenderError. Failures to load them are returned as is.
+func (r *Renderer) Validate(source *models.EmailTemplate) error {
+	_, err := r.parse(source)
+	return err
+}
+
+// Invalidate drops a cached template, e.g. after a publish.
+func (r *Renderer) Invalidate(id string) {
+	r.mu.Lock()
+	delete(r.cache, id)
+	r.mu.Unlock()
+}
+
+// Reset drops all cached templates, a changed layout or partial may be used
+// by any of them.
+func (r *Renderer) Reset() {
+	r.mu.Lock()
+	r.cache = make(map[string]*parsed)
+	r.mu.Unlock()
+}
+
+func (r *Renderer) execute(tmpl *parsed, locale string, data map[string]any, links Links) (*Rendered, error) {
+	id := tmpl.source.ID
+	var err error
+	var chosen *variant
+	rendered := &Rendered{Version: tmpl.source.Version, InlineCSS: tmpl.source.InlineCSS}
+	for _, candidate := range localeFallbacks(locale, r.defaultLocale) {
+		if v, ok := tmpl.variants[candidate]; ok {
+			chosen, rendered.Locale = v, candidate
+			break
+		}
+	}
+	if chosen == nil {
+		return nil, &RenderError{TemplateID: id, Part: "locale", Err: fmt.Errorf("no variant for locale %q", locale)}
+	}
+
+	// dates and numbers follow the requested locale even if the text falls back
+	formatLocale := CanonicalLocale(locale)
+	if formatLocale == "" {
+		formatLocale = r.defaultLocale
+	}
+	funcs := newFuncs(links, newFormatter(formatLocale))
+
+	if rendered.Subject, err = executeText(chosen.subject, data, funcs); err != nil {
+		return nil, &RenderError{TemplateID: id, Part: "subject", Err: err}
+	}
+	rendered.Subject = strings.Join(strings.Fields(rendered.Subject), " ")
+	if chosen.html != nil {
+		if rendered.HTML, err = executeHTML(chosen.html, data, funcs); err != nil {
+			return nil, &RenderError{TemplateID: id, Part: "html", Err: err}
+		}
+	}
+	if chosen.text != nil {
+		if rendered.Text, err = executeText(chosen.text, data, funcs); err != nil {
+			return nil, &RenderError{TemplateID: id, Part: "text", Err: err}
+		}
+	}
+	return rendered, nil
+}
+
+func (r *Renderer) load(id string) (*parsed, error) {
+	r.mu.Lock()
+	cached, ok := r.cache[id]
+	r.mu.Unlock()
+	if ok && time.Since(cached.loadedAt) < r.cacheTTL {
+		return cached, nil
+	}
+
+	source, err := r.store.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	tmpl, err := r.parse(source)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	r.cache[id] = tmpl
+	r.mu.Unlock()
+	log.WithField("template_id", id).Debug("Template loaded")
+	return tmpl, nil
+}
+
+func (r *Renderer) parse(source *models.EmailTemplate) (*parsed, error) {
+	tmpl := &parsed{source: source, variants: make(map[string]*variant), loadedAt: time.Now()}
+
+	if source.HTML != "" || source.Text != "" {
+		base, err := r.parseVariant(source, "", models.LocalizedTemplate{Subject: source.Subject, HTML: source.HTML, Text: source.Text})
+		if err != nil {
+			return nil, err
+		}
+		tmpl.variants[""] = base
+	}
+	for locale, content := range source.Locales {
+		v, err := r.parseVariant(source, CanonicalLocale(locale), content)
+		if err != nil {
+			return nil, err
+		}
+		tmpl.variants[CanonicalLocale(locale)] = v
+	}
+
+	if len(tmpl.variants) == 0 {
+		return nil, &RenderError{TemplateID: source.ID, Part: "body", Err: errors.New("template has neither HTML nor text")}
+	}
+	return tmpl, nil
+}
+
+// parseVariant parses one locale variant together with its layout and the
+// partials it includes, picked for the same locale.
+func (r *Renderer) parseVariant(source *models.EmailTemplate, locale string, content models.LocalizedTemplate) (*variant, error) {
+	part := func(name string) string {
+		if locale == "" {
+			return name
+		}
+		return fmt.Sprintf("%s (%s)", name, locale)
+	}
+	if content.HTML == "" && content.Text == "" {
+		return nil, &RenderError{TemplateID: source.ID, Part: part("body"), Err: errors.New("variant has neither HTML nor text")}
+	}
+
+	funcs := newFuncs(Links{}, newFormatter(""))
+	resolver := newPartialResolver(r.store, localeFallbacks(locale, r.defaultLocale))
+	v := &variant{}
+	var err error
+	if v.subject, err = template.New("subject").Funcs(funcs.text).Option("missingkey=error").Parse(content.Subject); err != nil {
+		return nil, &RenderError{TemplateID: source.ID, Part: part("subject"), Err: err}
+	}
+	if content.HTML != "" {
+		v.html = htmltemplate.New("html").Funcs(funcs.html).Option("missingkey=error")
+		if err := assemble(htmlSet{v.html}, "html", content.HTML, source.Layout, resolver); err != nil {
+			return nil, renderError(source.ID, part("html"), err)
+		}
+	}
+	if content.Text != "" {
+		v.text = template.New("text").Funcs(funcs.text).Option("missingkey=error")
+		if err := assemble(textSet{v.text}, "text", content.Text, source.Layout, resolver); err != nil {
+			return nil, renderError(source.ID, part("text"), err)
+		}
+	}
+	return v, nil
+}
+
+// renderError wraps a failed assemble in *RenderError unless a layout or
+// partial could not be loaded, which is returned as a storage failure.
+func renderError(id, part string, err error) error {
+	var storeErr *storeError
+	if errors.As(err, &storeErr) {
+		return fmt.Errorf("template %s: %w", id, storeErr.err)
+	}
+	return &RenderError{TemplateID: id, Part: part, Err: err}
+}
+
+// assemble parses the body into the root template of set, or into the
+// content block of the layout when the template has one, and resolves the
+// partials. A layout without the part leaves the body unwrapped.
+func assemble(set templateSet, part, body, layout string, resolver *partialResolver) error {
+	root := part
+	if layout != "" {
+		layoutSource, err := resolver.layout(layout, part)
+		if err != nil {
+			return err
+		}
+		if layoutSource != "" {
+			if err := set.add(root, layoutSource); err != nil {
+				return fmt.Errorf("layout %q: %w", layout, err)
+			}
+			if !containsName(references(set.lookup(root).Root), contentBlock) {
+				return fmt.Errorf("layout %q has no %q block", layout, contentBlock)
+			}
+			root = contentBlock
+		}
+	}
+	if err := set.add(root, body); err != nil {
+		return err
+	}
+	return resolver.resolve(set, part)
+}
+
+func containsName(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// executeText and executeHTML clone the cached template to bind the links
+// and locale of this email, templates are shared between concurrent renders.
+func executeText(tmpl *template.Template, data map[string]any, funcs *funcs) (string, error) {
+	clone, err := tmpl.Clone()
+	if err != nil {
+		return "", err
+	}
+	var b bytes.Buffer
+	if err := clone.Funcs(funcs.text).Execute(&b, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+func executeHTML(tmpl *htmltemplate.Template, data map[string]any, funcs *funcs) (string, error) {
+	clone, err := tmpl.Clone()
+	if err != nil {
+		return "", err
+	}
+	var b bytes.Buffer
+	if err := clone.Funcs(funcs.html).Execute(&b, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
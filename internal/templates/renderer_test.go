@@ -0,0 +1,154 @@
+package templates
+
+import (
+	"errors"
+	"handyhub-email-svc/internal/models"
+	"testing"
+	"time"
+)
+
+// stubStore serves partials from a map, failing with err when it is set.
+type stubStore struct {
+	partials map[string]*models.TemplatePartial
+	err      error
+}
+
+func (s *stubStore) Get(id string) (*models.EmailTemplate, error) {
+	return nil, ErrNotFound
+}
+
+func (s *stubStore) Layout(name string) (*models.TemplatePartial, error) {
+	return s.Partial("_layouts/" + name)
+}
+
+func (s *stubStore) Partial(name string) (*models.TemplatePartial, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	if p, ok := s.partials[name]; ok {
+		return p, nil
+	}
+	return nil, ErrPartialNotFound
+}
+
+func TestRenderTemplateErrors(t *testing.T) {
+	outage := errors.New("server selection timeout")
+	tests := []struct {
+		name       string
+		store      *stubStore
+		tmpl       *models.EmailTemplate
+		wantRender bool
+		wantErr    error
+	}{
+		{
+			name:    "partial store failure",
+			store:   &stubStore{err: outage},
+			tmpl:    &models.EmailTemplate{ID: "welcome", HTML: `{{template "button"}}`},
+			wantErr: outage,
+		},
+		{
+			name:    "layout store failure",
+			store:   &stubStore{err: outage},
+			tmpl:    &models.EmailTemplate{ID: "welcome", Layout: "base", Text: "Hi"},
+			wantErr: outage,
+		},
+		{
+			name:       "missing partial",
+			store:      &stubStore{},
+			tmpl:       &models.EmailTemplate{ID: "welcome", HTML: `{{template "button"}}`},
+			wantRender: true,
+		},
+		{
+			name:       "missing layout",
+			store:      &stubStore{},
+			tmpl:       &models.EmailTemplate{ID: "welcome", Layout: "base", Text: "Hi"},
+			wantRender: true,
+		},
+		{
+			name:       "broken partial",
+			store:      &stubStore{partials: map[string]*models.TemplatePartial{"button": {Name: "button", HTML: "{{if}}"}}},
+			tmpl:       &models.EmailTemplate{ID: "welcome", HTML: `{{template "button"}}`},
+			wantRender: true,
+		},
+		{
+			name:       "execute failure",
+			store:      &stubStore{},
+			tmpl:       &models.EmailTemplate{ID: "welcome", Text: "{{.missing}}"},
+			wantRender: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewRenderer(tt.store, time.Minute, "en").RenderTemplate(tt.tmpl, "", map[string]any{}, Links{})
+			if err == nil {
+				t.Fatal("RenderTemplate succeeded")
+			}
+			var renderErr *RenderError
+			if errors.As(err, &renderErr) != tt.wantRender {
+				t.Fatalf("RenderTemplate = %v (%T), want *RenderError %v", err, err, tt.wantRender)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("RenderTemplate = %v, want it to wrap %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRenderTemplateWithPartial(t *testing.T) {
+	store := &stubStore{partials: map[string]*models.TemplatePartial{
+		"_layouts/base": {Name: "base", Kind: KindLayout, HTML: `<main>{{block "content" .}}{{end}}</main>`},
+		"button":        {Name: "button", HTML: `<a href="{{.url}}">Go</a>`},
+	}}
+	tmpl := &models.EmailTemplate{ID: "welcome", Subject: "Hi {{.name}}", Layout: "base", HTML: `{{template "button" .}}`}
+
+	rendered, err := NewRenderer(store, time.Minute, "en").RenderTemplate(tmpl, "", map[string]any{"name": "Ann", "url": "https://x.test"}, Links{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rendered.Subject != "Hi Ann" || rendered.HTML != `<main><a href="https://x.test">Go</a></main>` {
+		t.Fatalf("rendered %q / %q", rendered.Subject, rendered.HTML)
+	}
+}
+
+func TestRenderLayoutLocale(t *testing.T) {
+	store := &stubStore{partials: map[string]*models.TemplatePartial{
+		"_layouts/base": {
+			Name: "base",
+			Kind: KindLayout,
+			HTML: `<main>{{block "content" .}}{{end}}</main><a href="{{unsubscribe_url}}">Unsubscribe</a>`,
+			Text: "{{block \"content\" .}}{{end}}\nUnsubscribe: {{unsubscribe_url}}",
+			Locales: map[string]models.LocalizedTemplate{
+				"ru": {
+					HTML: `<main>{{block "content" .}}{{end}}</main><a href="{{unsubscribe_url}}">Отписаться</a>`,
+					Text: "{{block \"content\" .}}{{end}}\nОтписаться: {{unsubscribe_url}}",
+				},
+			},
+		},
+	}}
+	renderer := NewRenderer(store, time.Minute, "en")
+	links := Links{Unsubscribe: "https://x.test/u"}
+
+	tests := []struct {
+		locale string
+		html   string
+		text   string
+	}{
+		{locale: "en", html: `<main><p>Hi</p></main><a href="https://x.test/u">Unsubscribe</a>`, text: "Hi\nUnsubscribe: https://x.test/u"},
+		{locale: "ru-RU", html: `<main><p>Hi</p></main><a href="https://x.test/u">Отписаться</a>`, text: "Hi\nОтписаться: https://x.test/u"},
+		{locale: "ru", html: `<main><p>Hi</p></main><a href="https://x.test/u">Отписаться</a>`, text: "Hi\nОтписаться: https://x.test/u"},
+		{locale: "", html: `<main><p>Hi</p></main><a href="https://x.test/u">Unsubscribe</a>`, text: "Hi\nUnsubscribe: https://x.test/u"},
+		{locale: "de", html: `<main><p>Hi</p></main><a href="https://x.test/u">Unsubscribe</a>`, text: "Hi\nUnsubscribe: https://x.test/u"},
+	}
+	// rendered in order, a cached English layout must not leak into ru
+	for _, tt := range tests {
+		t.Run(tt.locale, func(t *testing.T) {
+			rendered, err := renderer.RenderLayout("base", tt.locale, "<p>Hi</p>", "Hi", links)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rendered.HTML != tt.html || rendered.Text != tt.text {
+				t.Fatalf("rendered %q / %q, want %q / %q", rendered.HTML, rendered.Text, tt.html, tt.text)
+			}
+		})
+	}
+}
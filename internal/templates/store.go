@@ -0,0 +1,39 @@
+package templates
+
+import (
+	"errors"
+	"handyhub-email-svc/internal/models"
+)
+
+var (
+	ErrNotFound        = errors.New("template not found")
+	ErrExists          = errors.New("template already exists")
+	ErrVersionNotFound = errors.New("template version not found")
+	ErrNoRollback      = errors.New("no earlier published version to roll back to")
+	ErrConflict        = errors.New("template was changed concurrently, retry")
+)
+
+// Store returns the published version of a template and the layouts and
+// partials templates include.
+type Store interface {
+	Get(id string) (*models.EmailTemplate, error)
+	Layout(name string) (*models.TemplatePartial, error)
+	Partial(name string) (*models.TemplatePartial, error)
+}
+
+// VersionStore manages template versions, backing the template API.
+type VersionStore interface {
+	Store
+	List() ([]*models.TemplateRecord, error)
+	Record(id string) (*models.TemplateRecord, error)
+	Create(tmpl *models.EmailTemplate) (*models.EmailTemplate, error)
+	// AddVersion stores tmpl as the next draft version of an existing template
+	AddVersion(tmpl *models.EmailTemplate) (*models.EmailTemplate, error)
+	Publish(id string, version int) error
+	// Rollback republishes the version published before the current one
+	Rollback(id string) (int, error)
+
+	ListPartials(kind string) ([]*models.TemplatePartial, error)
+	SavePartial(partial *models.TemplatePartial) error
+	DeletePartial(kind, name string) error
+}
@@ -0,0 +1,113 @@
+package tracking
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// instrument rewrites trackable links with rewrite and appends the open
+// pixel to the body. Links marked data-track="false" are left alone, e.g.
+// password reset links that must not pass through a redirect.
+func instrument(body string, rewrite func(href string) (string, error), pixelURL string) (string, error) {
+	doc, err := html.Parse(strings.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("failed to parse HTML: %w", err)
+	}
+
+	if rewrite != nil {
+		if err := rewriteLinks(doc, rewrite); err != nil {
+			return "", err
+		}
+	}
+	if pixelURL != "" {
+		appendPixel(doc, pixelURL)
+	}
+
+	var b strings.Builder
+	if err := html.Render(&b, doc); err != nil {
+		return "", fmt.Errorf("failed to render HTML: %w", err)
+	}
+	return b.String(), nil
+}
+
+func rewriteLinks(n *html.Node, rewrite func(href string) (string, error)) error {
+	if n.Type == html.ElementNode && n.DataAtom == atom.A {
+		if err := rewriteLink(n, rewrite); err != nil {
+			return err
+		}
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if err := rewriteLinks(c, rewrite); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func rewriteLink(a *html.Node, rewrite func(href string) (string, error)) error {
+	href := -1
+	track := true
+	attrs := a.Attr[:0]
+	for _, attr := range a.Attr {
+		if attr.Namespace == "" && attr.Key == "data-track" {
+			track = !strings.EqualFold(strings.TrimSpace(attr.Val), "false")
+			continue
+		}
+		if attr.Namespace == "" && attr.Key == "href" {
+			href = len(attrs)
+		}
+		attrs = append(attrs, attr)
+	}
+	a.Attr = attrs
+
+	if !track || href < 0 || !trackable(a.Attr[href].Val) {
+		return nil
+	}
+	rewritten, err := rewrite(strings.TrimSpace(a.Attr[href].Val))
+	if err != nil {
+		return err
+	}
+	a.Attr[href].Val = rewritten
+	return nil
+}
+
+// trackable accepts absolute http(s) links only, mailto:, tel: and anchors
+// keep working without the redirect.
+func trackable(href string) bool {
+	href = strings.ToLower(strings.TrimSpace(href))
+	return strings.HasPrefix(href, "http://") || strings.HasPrefix(href, "https://")
+}
+
+func appendPixel(doc *html.Node, pixelURL string) {
+	body := findElement(doc, atom.Body)
+	if body == nil {
+		body = doc
+	}
+	body.AppendChild(&html.Node{
+		Type:     html.ElementNode,
+		Data:     "img",
+		DataAtom: atom.Img,
+		Attr: []html.Attribute{
+			{Key: "src", Val: pixelURL},
+			{Key: "width", Val: "1"},
+			{Key: "height", Val: "1"},
+			{Key: "alt", Val: ""},
+			{Key: "style", Val: "display:block;width:1px;height:1px;border:0"},
+		},
+	})
+}
+
+func findElement(n *html.Node, a atom.Atom) *html.Node {
+	if n.Type == html.ElementNode && n.DataAtom == a {
+		return n
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if found := findElement(c, a); found != nil {
+			return found
+		}
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package tracking
+
+import (
+	"errors"
+	"fmt"
+	"handyhub-email-svc/internal/config"
+	"handyhub-email-svc/internal/models"
+	"handyhub-email-svc/internal/signing"
+	"handyhub-email-svc/internal/storage"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var log = logrus.StandardLogger()
+
+const (
+	kindOpen  = "o"
+	kindClick = "c"
+
+	providerName = "tracking"
+)
+
+var ErrInvalidToken = signing.ErrInvalidToken
+
+type claims struct {
+	Kind  string `json:"k"`
+	LogID string `json:"l"`
+	URL   string `json:"u,omitempty"`
+}
+
+// Service instruments outgoing HTML with an open pixel and click redirects
+// and records the resulting events on the email log.
+type Service struct {
+	signer       *signing.Signer
+	baseURL      string
+	opens        bool
+	clicks       bool
+	emailStorage storage.EmailStorage
+}
+
+func NewService(cfg config.TrackingConfig, emailStorage storage.EmailStorage) (*Service, error) {
+	signer, err := signing.NewSigner(cfg.Secret)
+	if err != nil {
+		return nil, fmt.Errorf("tracking: %w", err)
+	}
+	base, err := url.Parse(cfg.BaseURL)
+	if err != nil || (base.Scheme != "http" && base.Scheme != "https") || base.Host == "" {
+		return nil, fmt.Errorf("tracking: invalid base-url %q", cfg.BaseURL)
+	}
+
+	return &Service{
+		signer:       signer,
+		baseURL:      strings.TrimRight(cfg.BaseURL, "/"),
+		opens:        cfg.Opens,
+		clicks:       cfg.Clicks,
+		emailStorage: emailStorage,
+	}, nil
+}
+
+// Instrument returns body with tracked links and the open pixel for the
+// email log logID.
+func (s *Service) Instrument(logID primitive.ObjectID, body string) (string, error) {
+	if body == "" || (!s.opens && !s.clicks) {
+		return body, nil
+	}
+
+	var rewrite func(string) (string, error)
+	if s.clicks {
+		rewrite = func(href string) (string, error) {
+			// links to this service, e.g. unsubscribe links, stay direct
+			if strings.HasPrefix(href, s.baseURL+"/") {
+				return href, nil
+			}
+			return s.url(claims{Kind: kindClick, LogID: logID.Hex(), URL: href})
+		}
+	}
+	var pixelURL string
+	if s.opens {
+		var err error
+		if pixelURL, err = s.url(claims{Kind: kindOpen, LogID: logID.Hex()}); err != nil {
+			return "", err
+		}
+	}
+
+	return instrument(body, rewrite, pixelURL)
+}
+
+func (s *Service) url(c claims) (string, error) {
+	token, err := s.signer.Sign(c)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s/t/%s/%s", s.baseURL, c.Kind, token), nil
+}
+
+// Open records an open of the email the token was issued for.
+func (s *Service) Open(token string) error {
+	c, err := s.verify(token, kindOpen)
+	if err != nil {
+		return err
+	}
+	return s.record(c, models.EventOpened)
+}
+
+// Click records a click and returns the original link. The link is returned
+// even if recording fails, the recipient must not end up on an error page.
+func (s *Service) Click(token string) (string, error) {
+	c, err := s.verify(token, kindClick)
+	if err != nil {
+		return "", err
+	}
+	if err := s.record(c, models.EventClicked); err != nil {
+		log.WithError(err).WithField("log_id", c.LogID).Warn("Failed to record click")
+	}
+	return c.URL, nil
+}
+
+func (s *Service) verify(token, kind string) (claims, error) {
+	var c claims
+	if err := s.signer.Verify(token, &c); err != nil {
+		return c, err
+	}
+	if c.Kind != kind {
+		return c, ErrInvalidToken
+	}
+	if kind == kindClick && !trackable(c.URL) {
+		return c, ErrInvalidToken
+	}
+	return c, nil
+}
+
+func (s *Service) record(c claims, eventType string) error {
+	id, err := primitive.ObjectIDFromHex(c.LogID)
+	if err != nil {
+		return ErrInvalidToken
+	}
+	emailLog, err := s.emailStorage.FindByID(id)
+	if errors.Is(err, storage.ErrNotFound) {
+		log.WithField("log_id", c.LogID).Debug("No email log for tracking event")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return s.emailStorage.AddEvent(id, models.DeliveryEvent{
+		Type:      eventType,
+		Provider:  providerName,
+		MessageID: emailLog.MessageID,
+		URL:       c.URL,
+		Timestamp: time.Now(),
+	})
+}
@@ -0,0 +1,142 @@
+package tracking
+
+import (
+	"errors"
+	"handyhub-email-svc/internal/config"
+	"handyhub-email-svc/internal/models"
+	"handyhub-email-svc/internal/storage"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const testSecret = "0123456789abcdef"
+
+func newTestService(t *testing.T, secret string) (*Service, *storage.FileStorage) {
+	t.Helper()
+	emailStorage, err := storage.NewFileStorage(config.FileStorageConfig{Path: filepath.Join(t.TempDir(), "emails.jsonl")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { emailStorage.Close() })
+	service, err := NewService(config.TrackingConfig{BaseURL: "https://mail.example.com/", Secret: secret, Opens: true, Clicks: true}, emailStorage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return service, emailStorage
+}
+
+var trackedURL = regexp.MustCompile(`https://mail\.example\.com/t/([oc])/([^"]+)`)
+
+// tokens returns the open and click tokens of an instrumented body.
+func tokens(t *testing.T, body string) (open, click string) {
+	t.Helper()
+	for _, match := range trackedURL.FindAllStringSubmatch(body, -1) {
+		if match[1] == kindOpen {
+			open = match[2]
+		} else {
+			click = match[2]
+		}
+	}
+	if open == "" || click == "" {
+		t.Fatalf("instrumented body has no open or click URL:\n%s", body)
+	}
+	return open, click
+}
+
+func TestClick(t *testing.T) {
+	service, _ := newTestService(t, testSecret)
+	forger, _ := newTestService(t, "fedcba9876543210")
+	logID := primitive.NewObjectID()
+
+	body, err := service.Instrument(logID, `<p><a href="https://handyhub.example/booking/42">Booking</a></p>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	openToken, clickToken := tokens(t, body)
+
+	target, err := service.Click(clickToken)
+	if err != nil || target != "https://handyhub.example/booking/42" {
+		t.Fatalf("Click = %q, %v, want the original link", target, err)
+	}
+
+	forged, err := forger.url(claims{Kind: kindClick, LogID: logID.Hex(), URL: "https://evil.example/login"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	script, err := service.signer.Sign(claims{Kind: kindClick, LogID: logID.Hex(), URL: "javascript:alert(1)"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]string{
+		"forged for another host": trackedURL.FindStringSubmatch(forged)[2],
+		"tampered":                clickToken[:len(clickToken)-2] + "AA",
+		"open token":              openToken,
+		"not a link":              script,
+		"garbage":                 "not-a-token",
+	}
+	for name, token := range tests {
+		t.Run(name, func(t *testing.T) {
+			target, err := service.Click(token)
+			if !errors.Is(err, ErrInvalidToken) || target != "" {
+				t.Errorf("Click = %q, %v, want ErrInvalidToken and no redirect", target, err)
+			}
+		})
+	}
+}
+
+func TestInstrumentKeepsUntrackedLinks(t *testing.T) {
+	service, _ := newTestService(t, testSecret)
+	body, err := service.Instrument(primitive.NewObjectID(), `<a href="mailto:ann@example.com">Mail</a>`+
+		`<a href="https://mail.example.com/u/token">Unsubscribe</a>`+
+		`<a data-track="false" href="https://handyhub.example/reset">Reset</a>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, href := range []string{`href="mailto:ann@example.com"`, `href="https://mail.example.com/u/token"`, `href="https://handyhub.example/reset"`} {
+		if !regexp.MustCompile(regexp.QuoteMeta(href)).MatchString(body) {
+			t.Errorf("body lost %s:\n%s", href, body)
+		}
+	}
+	if regexp.MustCompile(`/t/c/`).MatchString(body) {
+		t.Errorf("body has tracked links:\n%s", body)
+	}
+}
+
+func TestOpenRecordsFirstOpenOnce(t *testing.T) {
+	service, emailStorage := newTestService(t, testSecret)
+	emailLog := &models.EmailLog{ID: primitive.NewObjectID(), Status: models.StatusSuccess, MessageID: "<abc@example.com>"}
+	if err := emailStorage.Store(emailLog); err != nil {
+		t.Fatal(err)
+	}
+	body, err := service.Instrument(emailLog.ID, `<a href="https://handyhub.example/">Home</a>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	openToken, _ := tokens(t, body)
+
+	for range 3 {
+		if err := service.Open(openToken); err != nil {
+			t.Fatalf("Open: %v", err)
+		}
+	}
+
+	stored, err := emailStorage.FindByID(emailLog.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opened := 0
+	for _, event := range stored.Events {
+		if event.Type == models.EventOpened {
+			opened++
+		}
+	}
+	if opened != 1 || stored.Opens != 3 {
+		t.Errorf("%d open events and %d opens, want the first open recorded and 3 counted", opened, stored.Opens)
+	}
+	if err := service.Open(openToken[:len(openToken)-2] + "AA"); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Open with a tampered token = %v, want ErrInvalidToken", err)
+	}
+}
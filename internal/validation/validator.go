@@ -0,0 +1,150 @@
+package validation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"handyhub-email-svc/internal/config"
+	"handyhub-email-svc/internal/smtp"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+var log = logrus.StandardLogger()
+
+// defaultMXTimeout applies when validation.mx-timeout is not set.
+const defaultMXTimeout = 5 * time.Second
+
+// MXResolver looks up mail exchangers of a domain and, for domains without
+// them, its addresses. *net.Resolver satisfies it, tests can provide a stub
+// instead of hitting DNS.
+type MXResolver interface {
+	LookupMX(ctx context.Context, name string) ([]*net.MX, error)
+	LookupHost(ctx context.Context, host string) ([]string, error)
+}
+
+type InvalidRecipient struct {
+	Address string `json:"address" bson:"address"`
+	Reason  string `json:"reason" bson:"reason"`
+}
+
+type Validator struct {
+	config   config.ValidationConfig
+	blocked  map[string]struct{}
+	resolver MXResolver
+}
+
+func NewValidator(cfg config.ValidationConfig, resolver MXResolver) *Validator {
+	blocked := make(map[string]struct{}, len(cfg.BlockedDomains))
+	for _, domain := range cfg.BlockedDomains {
+		blocked[strings.ToLower(strings.TrimSpace(domain))] = struct{}{}
+	}
+
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+
+	return &Validator{
+		config:   cfg,
+		blocked:  blocked,
+		resolver: resolver,
+	}
+}
+
+// Validate splits recipients into deliverable and invalid ones.
+func (v *Validator) Validate(recipients []string) ([]string, []InvalidRecipient) {
+	valid := make([]string, 0, len(recipients))
+	var invalid []InvalidRecipient
+
+	for _, recipient := range recipients {
+		if err := v.validateRecipient(recipient); err != nil {
+			log.WithError(err).WithField("recipient", recipient).Warn("Invalid recipient")
+			invalid = append(invalid, InvalidRecipient{Address: recipient, Reason: err.Error()})
+			continue
+		}
+		valid = append(valid, recipient)
+	}
+
+	return valid, invalid
+}
+
+func (v *Validator) validateRecipient(recipient string) error {
+	addr, err := smtp.ParseAddress(recipient)
+	if err != nil {
+		return err
+	}
+
+	domain := strings.ToLower(addr.Address[strings.LastIndex(addr.Address, "@")+1:])
+	if !strings.Contains(domain, ".") {
+		return fmt.Errorf("domain %s is not fully qualified", domain)
+	}
+	if v.isBlocked(domain) {
+		return fmt.Errorf("domain %s is blocked", domain)
+	}
+
+	if v.config.CheckMX {
+		return v.checkMX(domain)
+	}
+	return nil
+}
+
+// isBlocked matches the domain itself and any of its parent domains.
+func (v *Validator) isBlocked(domain string) bool {
+	for {
+		if _, ok := v.blocked[domain]; ok {
+			return true
+		}
+		dot := strings.Index(domain, ".")
+		if dot < 0 {
+			return false
+		}
+		domain = domain[dot+1:]
+	}
+}
+
+// checkMX rejects domains that do not exist or publish a null MX (RFC 7505).
+// A domain without MX records but with an address still accepts mail through
+// the implicit MX (RFC 5321 section 5.1). Temporary DNS failures are not
+// treated as invalid recipients.
+func (v *Validator) checkMX(domain string) error {
+	timeout := time.Duration(v.config.MXTimeout) * time.Second
+	if timeout <= 0 {
+		timeout = defaultMXTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	records, err := v.resolver.LookupMX(ctx, domain)
+	if err != nil && !isNotFound(err) {
+		log.WithError(err).WithField("domain", domain).Warn("MX lookup failed, skipping check")
+		return nil
+	}
+	if len(records) == 0 {
+		return v.checkImplicitMX(ctx, domain)
+	}
+
+	if len(records) == 1 && records[0].Host == "." {
+		return fmt.Errorf("domain %s does not accept email", domain)
+	}
+	return nil
+}
+
+func (v *Validator) checkImplicitMX(ctx context.Context, domain string) error {
+	addrs, err := v.resolver.LookupHost(ctx, domain)
+	if err != nil && !isNotFound(err) {
+		log.WithError(err).WithField("domain", domain).Warn("Address lookup failed, skipping check")
+		return nil
+	}
+	if len(addrs) == 0 {
+		return fmt.Errorf("domain %s has no MX or address records", domain)
+	}
+	return nil
+}
+
+func isNotFound(err error) bool {
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr) && dnsErr.IsNotFound
+}
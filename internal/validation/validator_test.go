@@ -0,0 +1,122 @@
+package validation
+
+import (
+	"context"
+	"errors"
+	"handyhub-email-svc/internal/config"
+	"net"
+	"strings"
+	"testing"
+)
+
+// stubResolver answers from maps keyed by domain, missing domains are
+// NXDOMAIN.
+type stubResolver struct {
+	mx    map[string][]*net.MX
+	hosts map[string][]string
+	err   error
+	// expired is set when a lookup got an already expired context
+	expired bool
+}
+
+func (s *stubResolver) LookupMX(ctx context.Context, name string) ([]*net.MX, error) {
+	if err := ctx.Err(); err != nil {
+		s.expired = true
+		return nil, err
+	}
+	if s.err != nil {
+		return nil, s.err
+	}
+	if records, ok := s.mx[name]; ok {
+		return records, nil
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+}
+
+func (s *stubResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		s.expired = true
+		return nil, err
+	}
+	if addrs, ok := s.hosts[host]; ok {
+		return addrs, nil
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+}
+
+func TestValidateRecipient(t *testing.T) {
+	resolver := &stubResolver{
+		mx: map[string][]*net.MX{
+			"example.com": {{Host: "mx.example.com.", Pref: 10}},
+			"null-mx.com": {{Host: ".", Pref: 0}},
+		},
+		hosts: map[string][]string{
+			"implicit.com": {"192.0.2.1"},
+		},
+	}
+	cfg := config.ValidationConfig{CheckMX: true, BlockedDomains: []string{"mailinator.com"}}
+
+	tests := []struct {
+		name      string
+		recipient string
+		wantErr   string
+	}{
+		{name: "mx records", recipient: "ann@example.com"},
+		{name: "display name", recipient: "Ann <ann@example.com>"},
+		{name: "implicit mx", recipient: "bob@implicit.com"},
+		{name: "null mx", recipient: "bob@null-mx.com", wantErr: "does not accept email"},
+		{name: "no mx or address", recipient: "bob@missing.com", wantErr: "no MX or address records"},
+		{name: "blocked", recipient: "bob@mailinator.com", wantErr: "is blocked"},
+		{name: "blocked subdomain", recipient: "bob@eu.mailinator.com", wantErr: "is blocked"},
+		{name: "not fully qualified", recipient: "bob@localhost", wantErr: "not fully qualified"},
+		{name: "malformed", recipient: "bob", wantErr: "invalid address"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := NewValidator(cfg, resolver).validateRecipient(tt.recipient)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("validateRecipient(%q) = %v, want nil", tt.recipient, err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("validateRecipient(%q) = %v, want error containing %q", tt.recipient, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckMXSkipsTemporaryFailures(t *testing.T) {
+	resolver := &stubResolver{err: &net.DNSError{Err: "server misbehaving", Name: "example.com", IsTemporary: true}}
+	v := NewValidator(config.ValidationConfig{CheckMX: true}, resolver)
+
+	if err := v.checkMX("example.com"); err != nil {
+		t.Fatalf("checkMX = %v, want nil on a temporary DNS failure", err)
+	}
+}
+
+func TestCheckMXDefaultTimeout(t *testing.T) {
+	resolver := &stubResolver{mx: map[string][]*net.MX{"example.com": {{Host: "mx.example.com."}}}}
+	v := NewValidator(config.ValidationConfig{CheckMX: true, MXTimeout: 0}, resolver)
+
+	if err := v.checkMX("example.com"); err != nil {
+		t.Fatalf("checkMX = %v, want nil with mx-timeout 0", err)
+	}
+	if resolver.expired {
+		t.Fatal("lookup ran with an expired context")
+	}
+}
+
+func TestValidateSplitsRecipients(t *testing.T) {
+	resolver := &stubResolver{err: errors.New("unused")}
+	v := NewValidator(config.ValidationConfig{}, resolver)
+
+	valid, invalid := v.Validate([]string{"ann@example.com", "bob", "carl@example.org"})
+	if len(valid) != 2 || valid[0] != "ann@example.com" || valid[1] != "carl@example.org" {
+		t.Fatalf("valid = %v", valid)
+	}
+	if len(invalid) != 1 || invalid[0].Address != "bob" {
+		t.Fatalf("invalid = %v", invalid)
+	}
+}
@@ -0,0 +1,123 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"handyhub-email-svc/internal/config"
+	"handyhub-email-svc/internal/models"
+	"handyhub-email-svc/internal/smtp"
+	"math"
+	"net/http"
+	"time"
+)
+
+// MailgunSource handles Mailgun webhooks, signed with HMAC-SHA256 of the
+// timestamp and token using the webhook signing key.
+type MailgunSource struct {
+	signingKey []byte
+	maxAge     time.Duration
+}
+
+type mailgunPayload struct {
+	Signature struct {
+		Timestamp string `json:"timestamp"`
+		Token     string `json:"token"`
+		Signature string `json:"signature"`
+	} `json:"signature"`
+	EventData struct {
+		ID        string  `json:"id"`
+		Event     string  `json:"event"`
+		Severity  string  `json:"severity"`
+		Recipient string  `json:"recipient"`
+		Timestamp float64 `json:"timestamp"`
+		Reason    string  `json:"reason"`
+		Message   struct {
+			Headers struct {
+				MessageID string `json:"message-id"`
+			} `json:"headers"`
+		} `json:"message"`
+		DeliveryStatus struct {
+			Description string `json:"description"`
+			Message     string `json:"message"`
+		} `json:"delivery-status"`
+	} `json:"event-data"`
+}
+
+func NewMailgunSource(cfg config.MailgunWebhookConfig) *MailgunSource {
+	return &MailgunSource{
+		signingKey: []byte(cfg.SigningKey),
+		maxAge:     time.Duration(cfg.MaxAge) * time.Second,
+	}
+}
+
+func (s *MailgunSource) Name() string {
+	return "mailgun"
+}
+
+func (s *MailgunSource) Verify(r *http.Request, body []byte) error {
+	var payload mailgunPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return ErrUnauthorized
+	}
+
+	sig := payload.Signature
+	if err := checkAge(sig.Timestamp, s.maxAge); err != nil {
+		return err
+	}
+
+	mac := hmac.New(sha256.New, s.signingKey)
+	mac.Write([]byte(sig.Timestamp + sig.Token))
+	expected := hex.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(expected), []byte(sig.Signature)) {
+		return ErrUnauthorized
+	}
+	return nil
+}
+
+func (s *MailgunSource) Parse(body []byte) ([]models.DeliveryEvent, error) {
+	var payload mailgunPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, fmt.Errorf("invalid Mailgun payload: %w", err)
+	}
+	data := payload.EventData
+
+	var eventType string
+	switch data.Event {
+	case "delivered":
+		eventType = models.EventDelivered
+	case "failed":
+		eventType = models.EventDeferred
+		if data.Severity == "permanent" {
+			eventType = models.EventBounced
+		}
+	case "complained":
+		eventType = models.EventComplaint
+	case "opened":
+		eventType = models.EventOpened
+	case "clicked":
+		eventType = models.EventClicked
+	default:
+		return nil, nil
+	}
+
+	reason := data.DeliveryStatus.Message
+	if reason == "" {
+		reason = data.DeliveryStatus.Description
+	}
+	if reason == "" {
+		reason = data.Reason
+	}
+
+	seconds, fraction := math.Modf(data.Timestamp)
+	return []models.DeliveryEvent{{
+		Type:      eventType,
+		Provider:  s.Name(),
+		Recipient: data.Recipient,
+		MessageID: smtp.FormatMessageID(data.Message.Headers.MessageID),
+		Reason:    reason,
+		Timestamp: time.Unix(int64(seconds), int64(fraction*1e9)).UTC(),
+	}}, nil
+}
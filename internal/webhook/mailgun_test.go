@@ -0,0 +1,82 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"handyhub-email-svc/internal/config"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func mailgunBody(t *testing.T, key, timestamp, token, signature string) []byte {
+	t.Helper()
+	if signature == "" {
+		mac := hmac.New(sha256.New, []byte(key))
+		mac.Write([]byte(timestamp + token))
+		signature = hex.EncodeToString(mac.Sum(nil))
+	}
+	var payload mailgunPayload
+	payload.Signature.Timestamp = timestamp
+	payload.Signature.Token = token
+	payload.Signature.Signature = signature
+	payload.EventData.Event = "delivered"
+	payload.EventData.Recipient = "ann@example.com"
+	body, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return body
+}
+
+func TestMailgunVerify(t *testing.T) {
+	source := NewMailgunSource(config.MailgunWebhookConfig{SigningKey: "signing-key", MaxAge: 300})
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	stale := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+
+	tests := []struct {
+		name string
+		body []byte
+		ok   bool
+	}{
+		{"valid", mailgunBody(t, "signing-key", now, "token", ""), true},
+		{"wrong signing key", mailgunBody(t, "other-key", now, "token", ""), false},
+		{"tampered signature", mailgunBody(t, "signing-key", now, "token", "00"+hex.EncodeToString(make([]byte, 31))), false},
+		{"stale timestamp", mailgunBody(t, "signing-key", stale, "token", ""), false},
+		{"malformed timestamp", mailgunBody(t, "signing-key", "yesterday", "token", ""), false},
+		{"not JSON", []byte("event=delivered"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := source.Verify(httptest.NewRequest("POST", "/webhooks/mailgun", nil), tt.body)
+			if tt.ok && err != nil {
+				t.Errorf("Verify = %v, want nil", err)
+			}
+			if !tt.ok && !errors.Is(err, ErrUnauthorized) {
+				t.Errorf("Verify = %v, want ErrUnauthorized", err)
+			}
+		})
+	}
+}
+
+func TestMailgunVerifyTamperedToken(t *testing.T) {
+	source := NewMailgunSource(config.MailgunWebhookConfig{SigningKey: "signing-key", MaxAge: 300})
+	body := mailgunBody(t, "signing-key", strconv.FormatInt(time.Now().Unix(), 10), "token", "")
+
+	var payload mailgunPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		t.Fatal(err)
+	}
+	payload.Signature.Token = "other-token"
+	tampered, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := source.Verify(httptest.NewRequest("POST", "/webhooks/mailgun", nil), tampered); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("Verify = %v, want ErrUnauthorized", err)
+	}
+}
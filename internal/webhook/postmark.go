@@ -0,0 +1,106 @@
+package webhook
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"handyhub-email-svc/internal/config"
+	"handyhub-email-svc/internal/models"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// PostmarkSource handles Postmark webhooks. Postmark does not sign payloads,
+// the webhook URL is protected with HTTP basic auth instead.
+type PostmarkSource struct {
+	username string
+	password string
+}
+
+type postmarkEvent struct {
+	RecordType  string    `json:"RecordType"`
+	MessageID   string    `json:"MessageID"`
+	Recipient   string    `json:"Recipient"`
+	Email       string    `json:"Email"`
+	Type        string    `json:"Type"`
+	Description string    `json:"Description"`
+	Details     string    `json:"Details"`
+	DeliveredAt time.Time `json:"DeliveredAt"`
+	BouncedAt   time.Time `json:"BouncedAt"`
+	ReceivedAt  time.Time `json:"ReceivedAt"`
+}
+
+// postmarkSoftBounces are bounce types that don't mean the address is dead.
+var postmarkSoftBounces = map[string]bool{
+	"SoftBounce":    true,
+	"Transient":     true,
+	"DnsError":      true,
+	"AutoResponder": true,
+}
+
+func NewPostmarkSource(cfg config.PostmarkWebhookConfig) *PostmarkSource {
+	return &PostmarkSource{
+		username: cfg.Username,
+		password: cfg.Password,
+	}
+}
+
+func (s *PostmarkSource) Name() string {
+	return "postmark"
+}
+
+func (s *PostmarkSource) Verify(r *http.Request, body []byte) error {
+	username, password, ok := r.BasicAuth()
+	if !ok ||
+		subtle.ConstantTimeCompare([]byte(username), []byte(s.username)) != 1 ||
+		subtle.ConstantTimeCompare([]byte(password), []byte(s.password)) != 1 {
+		return ErrUnauthorized
+	}
+	return nil
+}
+
+func (s *PostmarkSource) Parse(body []byte) ([]models.DeliveryEvent, error) {
+	var e postmarkEvent
+	if err := json.Unmarshal(body, &e); err != nil {
+		return nil, fmt.Errorf("invalid Postmark payload: %w", err)
+	}
+
+	event := models.DeliveryEvent{
+		Provider:          s.Name(),
+		Recipient:         e.Recipient,
+		ProviderMessageID: e.MessageID,
+		Timestamp:         e.ReceivedAt,
+	}
+	if event.Recipient == "" {
+		event.Recipient = e.Email
+	}
+
+	switch e.RecordType {
+	case "Delivery":
+		event.Type = models.EventDelivered
+		event.Timestamp = e.DeliveredAt
+		event.Reason = e.Details
+	case "Bounce":
+		event.Type = models.EventBounced
+		if postmarkSoftBounces[e.Type] {
+			event.Type = models.EventDeferred
+		}
+		event.Timestamp = e.BouncedAt
+		event.Reason = strings.TrimSpace(e.Description + " " + e.Details)
+	case "SpamComplaint":
+		event.Type = models.EventComplaint
+		event.Timestamp = e.BouncedAt
+	case "Open":
+		event.Type = models.EventOpened
+	case "Click":
+		event.Type = models.EventClicked
+	default:
+		return nil, nil
+	}
+
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now().UTC()
+	}
+	return []models.DeliveryEvent{event}, nil
+}
@@ -0,0 +1,41 @@
+package webhook
+
+import (
+	"errors"
+	"handyhub-email-svc/internal/config"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPostmarkVerify(t *testing.T) {
+	source := NewPostmarkSource(config.PostmarkWebhookConfig{Username: "postmark", Password: "secret"})
+
+	tests := []struct {
+		name     string
+		auth     bool
+		username string
+		password string
+		ok       bool
+	}{
+		{"valid", true, "postmark", "secret", true},
+		{"wrong password", true, "postmark", "guess", false},
+		{"wrong username", true, "admin", "secret", false},
+		{"password prefix", true, "postmark", "secre", false},
+		{"no credentials", false, "", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/webhooks/postmark", nil)
+			if tt.auth {
+				r.SetBasicAuth(tt.username, tt.password)
+			}
+			err := source.Verify(r, []byte(`{"RecordType":"Delivery"}`))
+			if tt.ok && err != nil {
+				t.Errorf("Verify = %v, want nil", err)
+			}
+			if !tt.ok && !errors.Is(err, ErrUnauthorized) {
+				t.Errorf("Verify = %v, want ErrUnauthorized", err)
+			}
+		})
+	}
+}
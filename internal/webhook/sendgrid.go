@@ -0,0 +1,146 @@
+package webhook
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"handyhub-email-svc/internal/config"
+	"handyhub-email-svc/internal/models"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	sendGridSignatureHeader = "X-Twilio-Email-Event-Webhook-Signature"
+	sendGridTimestampHeader = "X-Twilio-Email-Event-Webhook-Timestamp"
+)
+
+// SendGridSource handles the SendGrid Event Webhook, signed with ECDSA over
+// the timestamp header followed by the raw body.
+type SendGridSource struct {
+	publicKey *ecdsa.PublicKey
+	maxAge    time.Duration
+}
+
+type sendGridEvent struct {
+	Email       string `json:"email"`
+	Timestamp   int64  `json:"timestamp"`
+	Event       string `json:"event"`
+	Type        string `json:"type"`
+	SGMessageID string `json:"sg_message_id"`
+	SMTPID      string `json:"smtp-id"`
+	Reason      string `json:"reason"`
+	Response    string `json:"response"`
+}
+
+var sendGridEventTypes = map[string]string{
+	"delivered":  models.EventDelivered,
+	"deferred":   models.EventDeferred,
+	"bounce":     models.EventBounced,
+	"blocked":    models.EventBounced,
+	"dropped":    models.EventDropped,
+	"spamreport": models.EventComplaint,
+	"open":       models.EventOpened,
+	"click":      models.EventClicked,
+}
+
+func NewSendGridSource(cfg config.SendGridWebhookConfig) (*SendGridSource, error) {
+	der, err := base64.StdEncoding.DecodeString(cfg.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SendGrid webhook public key: %w", err)
+	}
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SendGrid webhook public key: %w", err)
+	}
+	publicKey, ok := key.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("SendGrid webhook public key is not an ECDSA key")
+	}
+
+	return &SendGridSource{
+		publicKey: publicKey,
+		maxAge:    time.Duration(cfg.MaxAge) * time.Second,
+	}, nil
+}
+
+func (s *SendGridSource) Name() string {
+	return "sendgrid"
+}
+
+func (s *SendGridSource) Verify(r *http.Request, body []byte) error {
+	signature, err := base64.StdEncoding.DecodeString(r.Header.Get(sendGridSignatureHeader))
+	if err != nil || len(signature) == 0 {
+		return ErrUnauthorized
+	}
+
+	timestamp := r.Header.Get(sendGridTimestampHeader)
+	if err := checkAge(timestamp, s.maxAge); err != nil {
+		return err
+	}
+
+	hash := sha256.Sum256(append([]byte(timestamp), body...))
+	if !ecdsa.VerifyASN1(s.publicKey, hash[:], signature) {
+		return ErrUnauthorized
+	}
+	return nil
+}
+
+func (s *SendGridSource) Parse(body []byte) ([]models.DeliveryEvent, error) {
+	var raw []sendGridEvent
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil, fmt.Errorf("invalid SendGrid payload: %w", err)
+	}
+
+	events := make([]models.DeliveryEvent, 0, len(raw))
+	for _, e := range raw {
+		eventType, ok := sendGridEventTypes[e.Event]
+		if !ok {
+			continue
+		}
+
+		reason := e.Reason
+		if reason == "" {
+			reason = e.Response
+		}
+		events = append(events, models.DeliveryEvent{
+			Type:              eventType,
+			Provider:          s.Name(),
+			Recipient:         e.Email,
+			ProviderMessageID: sendGridMessageID(e.SGMessageID),
+			MessageID:         e.SMTPID,
+			Reason:            reason,
+			Timestamp:         time.Unix(e.Timestamp, 0).UTC(),
+		})
+	}
+	return events, nil
+}
+
+// sendGridMessageID strips the filter suffix SendGrid appends to the
+// X-Message-Id returned on send, e.g. "abc.filterdrecv-123.0" -> "abc".
+func sendGridMessageID(id string) string {
+	if dot := strings.IndexByte(id, '.'); dot > 0 {
+		return id[:dot]
+	}
+	return id
+}
+
+// checkAge rejects replayed payloads with a unix timestamp older than maxAge.
+func checkAge(timestamp string, maxAge time.Duration) error {
+	if maxAge <= 0 {
+		return nil
+	}
+	seconds, err := strconv.ParseInt(strings.SplitN(timestamp, ".", 2)[0], 10, 64)
+	if err != nil {
+		return ErrUnauthorized
+	}
+	if age := time.Since(time.Unix(seconds, 0)); age > maxAge || age < -maxAge {
+		return fmt.Errorf("%w: timestamp outside of allowed window", ErrUnauthorized)
+	}
+	return nil
+}
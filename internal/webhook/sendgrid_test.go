@@ -0,0 +1,91 @@
+package webhook
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"handyhub-email-svc/internal/config"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func newSendGridKey(t *testing.T) (*ecdsa.PrivateKey, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, base64.StdEncoding.EncodeToString(der)
+}
+
+func signSendGrid(t *testing.T, key *ecdsa.PrivateKey, timestamp string, body []byte) string {
+	t.Helper()
+	hash := sha256.Sum256(append([]byte(timestamp), body...))
+	signature, err := ecdsa.SignASN1(rand.Reader, key, hash[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(signature)
+}
+
+func TestSendGridVerify(t *testing.T) {
+	key, publicKey := newSendGridKey(t)
+	otherKey, _ := newSendGridKey(t)
+	source, err := NewSendGridSource(config.SendGridWebhookConfig{PublicKey: publicKey, MaxAge: 300})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := []byte(`[{"email":"ann@example.com","event":"delivered","sg_message_id":"abc.filter"}]`)
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	stale := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+
+	tests := []struct {
+		name      string
+		timestamp string
+		signature string
+		body      []byte
+		ok        bool
+	}{
+		{"valid", now, signSendGrid(t, key, now, body), body, true},
+		{"tampered body", now, signSendGrid(t, key, now, body), []byte(`[{"email":"ann@example.com","event":"bounce"}]`), false},
+		{"signed by other key", now, signSendGrid(t, otherKey, now, body), body, false},
+		{"stale timestamp", stale, signSendGrid(t, key, stale, body), body, false},
+		{"timestamp not signed", now, signSendGrid(t, key, stale, body), body, false},
+		{"missing signature", now, "", body, false},
+		{"malformed signature", now, "not base64!", body, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/webhooks/sendgrid", nil)
+			r.Header.Set(sendGridTimestampHeader, tt.timestamp)
+			r.Header.Set(sendGridSignatureHeader, tt.signature)
+
+			err := source.Verify(r, tt.body)
+			if tt.ok && err != nil {
+				t.Errorf("Verify = %v, want nil", err)
+			}
+			if !tt.ok && !errors.Is(err, ErrUnauthorized) {
+				t.Errorf("Verify = %v, want ErrUnauthorized", err)
+			}
+		})
+	}
+}
+
+func TestNewSendGridSourceRejectsNonECDSAKey(t *testing.T) {
+	for _, publicKey := range []string{"", "not base64!", base64.StdEncoding.EncodeToString([]byte("not a key"))} {
+		if _, err := NewSendGridSource(config.SendGridWebhookConfig{PublicKey: publicKey}); err == nil {
+			t.Errorf("NewSendGridSource(%q) succeeded, want an error", publicKey)
+		}
+	}
+}
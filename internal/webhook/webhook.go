@@ -0,0 +1,67 @@
+package webhook
+
+import (
+	"errors"
+	"handyhub-email-svc/internal/config"
+	"handyhub-email-svc/internal/delivery"
+	"handyhub-email-svc/internal/models"
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+)
+
+var log = logrus.StandardLogger()
+
+var ErrUnauthorized = errors.New("webhook signature verification failed")
+
+// Source verifies and parses the webhook payloads of one provider.
+type Source interface {
+	Name() string
+	Verify(r *http.Request, body []byte) error
+	Parse(body []byte) ([]models.DeliveryEvent, error)
+}
+
+// Service routes webhook payloads to their source and records the events.
+type Service struct {
+	recorder *delivery.Recorder
+	sources  map[string]Source
+}
+
+func NewService(cfg config.WebhooksConfig, recorder *delivery.Recorder) (*Service, error) {
+	sources := make(map[string]Source)
+
+	if cfg.SendGrid.Enabled {
+		source, err := NewSendGridSource(cfg.SendGrid)
+		if err != nil {
+			return nil, err
+		}
+		sources[source.Name()] = source
+	}
+	if cfg.Mailgun.Enabled {
+		source := NewMailgunSource(cfg.Mailgun)
+		sources[source.Name()] = source
+	}
+	if cfg.Postmark.Enabled {
+		source := NewPostmarkSource(cfg.Postmark)
+		sources[source.Name()] = source
+	}
+
+	for name := range sources {
+		log.WithField("provider", name).Info("Delivery webhook enabled")
+	}
+
+	return &Service{
+		recorder: recorder,
+		sources:  sources,
+	}, nil
+}
+
+func (s *Service) Source(name string) (Source, bool) {
+	source, ok := s.sources[name]
+	return source, ok
+}
+
+// Apply records the events of a verified payload.
+func (s *Service) Apply(events []models.DeliveryEvent) (int, error) {
+	return s.recorder.Record(events)
+}